@@ -0,0 +1,234 @@
+// Package apierror is the error model of the API. Handlers report errors
+// with c.Error(apierror.New(...)) and the error middleware renders them as
+// RFC 7807 problem details (application/problem+json), e.g.
+//
+//	{"type": "about:blank", "title": "Not Found", "status": 404,
+//	 "code": "not_found", "detail": "Service not found"}
+//
+// code is stable and meant for programs; detail is for people and may
+// change. The cause of an internal error is logged, never sent.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Error codes besides the ones derived from the status (see New)
+const (
+	CodeValidation      = "validation_failed"
+	CodeMalformedJSON   = "malformed_json"
+	CodeSlotUnavailable = "slot_unavailable"
+	CodeEmailTaken      = "email_taken"
+	CodeSlugTaken       = "slug_taken"
+	CodeHoldExpired     = "hold_expired"
+	CodeRouteNotFound   = "route_not_found"
+	CodeAccountLocked   = "account_locked"
+)
+
+// statusCodes are the default codes of the statuses the API uses
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   CodeValidation,
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+// Error is an error the API answers a request with
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Fields []FieldError // for validation errors
+	// RetryAfter is sent as the Retry-After header, e.g. for 429s
+	RetryAfter time.Duration
+
+	cause error // internal, for the log only
+}
+
+// FieldError is a problem with one field of a request body
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %v", e.Detail, e.cause)
+	}
+	return e.Detail
+}
+
+// Unwrap returns the internal cause, if any
+func (e *Error) Unwrap() error { return e.cause }
+
+// New is an error with the status's default code
+func New(status int, detail string) *Error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+	}
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// WithCode replaces the error's code
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// WithRetryAfter tells the client when to try again
+func (e *Error) WithRetryAfter(d time.Duration) *Error {
+	e.RetryAfter = d
+	return e
+}
+
+// Internal is a server-side failure. detail is what the client sees (e.g.
+// "Could not fetch services"); cause is only logged.
+func Internal(cause error, detail string) *Error {
+	e := New(http.StatusInternalServerError, detail)
+	e.cause = cause
+	return e
+}
+
+// Validation turns a request binding error into a 400 with the problems
+// of each field. Field names are the JSON names when the validator uses
+// them (see JSONFieldNames).
+func Validation(err error) *Error {
+	e := New(http.StatusBadRequest, "The request body is invalid").WithCode(CodeValidation)
+
+	var invalid validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &invalid):
+		for _, fe := range invalid {
+			e.Fields = append(e.Fields, FieldError{Field: fieldPath(fe), Message: message(fe)})
+		}
+	case errors.As(err, &typeErr):
+		e.Fields = []FieldError{{Field: typeErr.Field, Message: "must be a " + typeName(typeErr.Type)}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		e.Detail = "The request body is not valid JSON"
+		e.Code = CodeMalformedJSON
+	default:
+		e.Detail = "The request body is invalid: " + err.Error()
+	}
+	return e
+}
+
+// fieldPath is the field's name under the top-level request struct, e.g.
+// "cancellation_policy.free_until_hours"
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
+
+// message describes a failed validation rule
+func message(fe validator.FieldError) string {
+	unit := ""
+	if fe.Kind() == reflect.String {
+		unit = " characters"
+	} else if fe.Kind() == reflect.Slice || fe.Kind() == reflect.Map {
+		unit = " items"
+	}
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "min":
+		return "must be at least " + fe.Param() + unit
+	case "max":
+		return "must be at most " + fe.Param() + unit
+	case "len":
+		return "must be exactly " + fe.Param() + unit
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	case "oneof":
+		return "must be one of " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	}
+	return "failed the " + fe.Tag() + " check"
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Uint, reflect.Uint64, reflect.Uint32:
+		return "whole number"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return t.Kind().String()
+}
+
+// JSONFieldNames makes the validator report fields by their JSON names
+func JSONFieldNames(v *validator.Validate) {
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+}
+
+// Problem is the RFC 7807 body of an error response
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Code     string       `json:"code"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// Problem is the response body for the error; instance is the request
+// path
+func (e *Error) Problem(instance string) Problem {
+	return Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(e.Status),
+		Status:   e.Status,
+		Code:     e.Code,
+		Detail:   e.Detail,
+		Instance: instance,
+		Errors:   e.Fields,
+	}
+}
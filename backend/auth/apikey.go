@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/models"
+)
+
+// APIKeyPrefix starts every API key, which tells them apart from JWTs
+const APIKeyPrefix = "bk_"
+
+// Scopes an API key can be given
+const (
+	ScopeReadServices  = "read:services"
+	ScopeWriteServices = "write:services"
+	ScopeReadSlots     = "read:slots"
+	ScopeWriteSlots    = "write:slots"
+	ScopeReadBookings  = "read:bookings"
+	ScopeWriteBookings = "write:bookings"
+	ScopeReadWaitlist  = "read:waitlist"
+	ScopeReadLocations = "read:locations"
+)
+
+// Scopes are all scopes, in the order they are listed
+var Scopes = []string{
+	ScopeReadServices, ScopeWriteServices,
+	ScopeReadSlots, ScopeWriteSlots,
+	ScopeReadBookings, ScopeWriteBookings,
+	ScopeReadWaitlist, ScopeReadLocations,
+}
+
+// ErrInvalidAPIKey is returned for unknown and revoked keys
+var ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+
+// apiKeyTouchInterval limits how often last_used_at is written for a busy
+// key
+const apiKeyTouchInterval = time.Minute
+
+// ValidScope reports whether scope is one of Scopes
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAPIKey returns a new key, the hash that is stored and the prefix
+// shown in key lists
+func NewAPIKey() (key, hash, prefix string, err error) {
+	token, _, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + token
+	return key, HashToken(key), key[:len(APIKeyPrefix)+8], nil
+}
+
+// LookupAPIKey finds the unrevoked key and records that it was used
+func LookupAPIKey(q database.Querier, key string, now time.Time) (models.APIKey, error) {
+	var apiKey models.APIKey
+	var scopes string
+	err := q.QueryRow(
+		"SELECT id, business_id, name, prefix, scopes FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL",
+		HashToken(key),
+	).Scan(&apiKey.ID, &apiKey.BusinessID, &apiKey.Name, &apiKey.Prefix, &scopes)
+	if err == sql.ErrNoRows {
+		return apiKey, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return apiKey, err
+	}
+	apiKey.Scopes = ParseScopes(scopes)
+
+	_, err = q.Exec(
+		"UPDATE api_keys SET last_used_at = $1 WHERE id = $2 AND (last_used_at IS NULL OR last_used_at < $3)",
+		now, apiKey.ID, now.Add(-apiKeyTouchInterval),
+	)
+	return apiKey, err
+}
+
+// ParseScopes reads the stored, comma separated scopes of a key
+func ParseScopes(s string) []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(s, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
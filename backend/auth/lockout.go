@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"time"
+
+	"booking-backend/database"
+)
+
+// MaxFailedLogins is how many wrong passwords or authentication codes in a
+// row lock an account for the client IP they came from
+const MaxFailedLogins = 5
+
+// MaxAccountFailedLogins is how many, from any number of IPs, lock the
+// account for every IP. It is higher than MaxFailedLogins so that one
+// guesser can't lock the owner out, but stops guessing spread over many
+// addresses (credential stuffing).
+const MaxAccountFailedLogins = 20
+
+// LoginLockout is how long a lockout lasts. Failures older than this no
+// longer count.
+const LoginLockout = 15 * time.Minute
+
+// allIPs is the ip of the count of an account's failures from every IP
+const allIPs = ""
+
+// LockedUntil is when the user's account unlocks for logins from ip; the
+// zero time if it isn't locked
+func LockedUntil(q database.Querier, userID int, ip string, now time.Time) (time.Time, error) {
+	rows, err := q.Query(
+		"SELECT locked_until FROM login_failures WHERE user_id = $1 AND ip IN ($2, $3) AND locked_until > $4",
+		userID, ip, allIPs, now,
+	)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer rows.Close()
+
+	var locked time.Time
+	for rows.Next() {
+		var until time.Time
+		if err := rows.Scan(&until); err != nil {
+			return time.Time{}, err
+		}
+		if until.After(locked) {
+			locked = until
+		}
+	}
+	return locked, rows.Err()
+}
+
+// RecordFailedLogin counts a wrong password or code from ip, for the IP
+// and for the account. The one that reaches MaxFailedLogins locks the
+// account for that IP (MaxAccountFailedLogins: for all IPs) for
+// LoginLockout and starts the count over, so an attacker gets a limited
+// number of tries per lockout.
+func RecordFailedLogin(q database.Querier, userID int, ip string, now time.Time) error {
+	if err := recordFailure(q, userID, ip, MaxFailedLogins, now); err != nil {
+		return err
+	}
+	return recordFailure(q, userID, allIPs, MaxAccountFailedLogins, now)
+}
+
+func recordFailure(q database.Querier, userID int, ip string, max int, now time.Time) error {
+	_, err := q.Exec(
+		`INSERT INTO login_failures (user_id, ip, failed_count, updated_at) VALUES ($1, $2, 1, $3)
+		 ON CONFLICT (user_id, ip) DO UPDATE SET
+		   locked_until = CASE WHEN login_failures.updated_at >= $4 AND login_failures.failed_count + 1 >= $5
+		     THEN $6 ELSE login_failures.locked_until END,
+		   failed_count = CASE WHEN login_failures.updated_at < $4 THEN 1
+		     WHEN login_failures.failed_count + 1 >= $5 THEN 0
+		     ELSE login_failures.failed_count + 1 END,
+		   updated_at = $3`,
+		userID, ip, now, now.Add(-LoginLockout), max, now.Add(LoginLockout),
+	)
+	return err
+}
+
+// ResetFailedLogins clears the count and any lockout for ip after a
+// successful login. The account's count isn't cleared: the owner logging
+// in doesn't stop guessing from elsewhere.
+func ResetFailedLogins(q database.Querier, userID int, ip string) error {
+	_, err := q.Exec("DELETE FROM login_failures WHERE user_id = $1 AND ip = $2", userID, ip)
+	return err
+}
+
+// UnlockAccount clears the failures from every IP, after a password reset
+func UnlockAccount(q database.Querier, userID int) error {
+	_, err := q.Exec("DELETE FROM login_failures WHERE user_id = $1", userID)
+	return err
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+)
+
+func TestLockout(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO users (email, password_hash, full_name, role) VALUES ('ann@example.com', 'x', 'Ann', 'customer')")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const attacker, owner = "203.0.113.7", "198.51.100.1"
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	locked := func(ip string, at time.Time) bool {
+		t.Helper()
+		until, err := LockedUntil(db, 1, ip, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return !until.IsZero()
+	}
+	fail := func(ip string, at time.Time) {
+		t.Helper()
+		if err := RecordFailedLogin(db, 1, ip, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < MaxFailedLogins; i++ {
+		fail(attacker, now)
+	}
+	if locked(attacker, now) {
+		t.Fatalf("locked after %d failures", MaxFailedLogins-1)
+	}
+	fail(attacker, now)
+	if !locked(attacker, now) {
+		t.Fatalf("not locked after %d failures", MaxFailedLogins)
+	}
+	if locked(owner, now) {
+		t.Error("a lockout from one IP locks the account for another")
+	}
+	if locked(attacker, now.Add(LoginLockout)) {
+		t.Error("still locked after LoginLockout")
+	}
+
+	// Failures spread out over more than LoginLockout don't add up
+	for i := 0; i < MaxFailedLogins; i++ {
+		fail(owner, now.Add(time.Duration(i)*(LoginLockout+time.Minute)))
+	}
+	if locked(owner, now.Add(time.Duration(MaxFailedLogins-1)*(LoginLockout+time.Minute))) {
+		t.Error("old failures counted towards a lockout")
+	}
+
+	// Guessing from many IPs locks the account everywhere
+	for i := 0; i < MaxAccountFailedLogins; i++ {
+		fail(fmt.Sprintf("192.0.2.%d", i), now)
+	}
+	if !locked(owner, now) {
+		t.Errorf("not locked after %d failures from different IPs", MaxAccountFailedLogins)
+	}
+
+	// A password reset unlocks every IP
+	if err := UnlockAccount(db, 1); err != nil {
+		t.Fatal(err)
+	}
+	if locked(attacker, now) || locked(owner, now) {
+		t.Error("still locked after UnlockAccount")
+	}
+}
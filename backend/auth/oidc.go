@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/oidc"
+)
+
+// OIDCLoginTTL is how long a user has to sign in at the provider
+const OIDCLoginTTL = 10 * time.Minute
+
+var (
+	// ErrInvalidOIDCState is returned for unknown, expired or already used sign-ins
+	ErrInvalidOIDCState = errors.New("invalid or expired sign-in")
+	// ErrEmailNotVerified is returned when a new provider account can't be
+	// linked because the provider hasn't verified its email
+	ErrEmailNotVerified = errors.New("the provider hasn't verified this email address")
+)
+
+// StartOIDCLogin begins a sign-in with provider and stores what is needed
+// to finish it
+func StartOIDCLogin(q database.Querier, provider string, now time.Time) (oidc.AuthRequest, error) {
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		return req, err
+	}
+
+	// Abandoned sign-ins are cleaned up as new ones start
+	if _, err := q.Exec("DELETE FROM oidc_logins WHERE expires_at < $1", now); err != nil {
+		return req, err
+	}
+	_, err = q.Exec(
+		`INSERT INTO oidc_logins (provider, state_hash, nonce, code_verifier, expires_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		provider, HashToken(req.State), req.Nonce, req.Verifier, now.Add(OIDCLoginTTL), now,
+	)
+	return req, err
+}
+
+// FinishOIDCLogin takes the sign-in started with state, which can't be
+// used again
+func FinishOIDCLogin(q database.Querier, provider, state string, now time.Time) (oidc.AuthRequest, error) {
+	req := oidc.AuthRequest{State: state}
+	var id int
+	var expiresAt time.Time
+	err := q.QueryRow(
+		"SELECT id, nonce, code_verifier, expires_at FROM oidc_logins WHERE state_hash = $1 AND provider = $2",
+		HashToken(state), provider,
+	).Scan(&id, &req.Nonce, &req.Verifier, &expiresAt)
+	if err == sql.ErrNoRows {
+		return req, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return req, err
+	}
+
+	// Deleting first makes a concurrent second use fail
+	result, err := q.Exec("DELETE FROM oidc_logins WHERE id = $1", id)
+	if err != nil {
+		return req, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 || now.After(expiresAt) {
+		return req, ErrInvalidOIDCState
+	}
+	return req, nil
+}
+
+// LinkIdentity returns the user signed in as identity at provider:
+//  1. the user the provider account is linked to,
+//  2. else the user with the same email, if the provider verified it; the
+//     account is linked to them,
+//  3. else a new customer account.
+func LinkIdentity(tx *database.Tx, provider string, identity oidc.Identity, now time.Time) (int, error) {
+	var userID int
+	err := tx.QueryRow(
+		"SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2",
+		provider, identity.Subject,
+	).Scan(&userID)
+	if err == nil {
+		_, err = tx.Exec(
+			"UPDATE user_identities SET last_login_at = $1, email = $2 WHERE provider = $3 AND subject = $4",
+			now, identity.Email, provider, identity.Subject,
+		)
+		return userID, err
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// Without a verified email anyone could claim someone else's account
+	if identity.Email == "" || !identity.EmailVerified {
+		return 0, ErrEmailNotVerified
+	}
+
+	err = tx.QueryRow("SELECT id FROM users WHERE email = $1", identity.Email).Scan(&userID)
+	switch {
+	case err == nil:
+		// The provider vouches for the address
+		_, err = tx.Exec(
+			"UPDATE users SET email_verified_at = $1 WHERE id = $2 AND email_verified_at IS NULL",
+			now, userID,
+		)
+	case err == sql.ErrNoRows:
+		name := identity.Name
+		if name == "" {
+			name = identity.Email
+		}
+		err = tx.QueryRow(
+			`INSERT INTO users (email, password_hash, full_name, role, email_verified_at)
+			 VALUES ($1, '', $2, 'customer', $3) RETURNING id`,
+			identity.Email, name, now,
+		).Scan(&userID)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+		 VALUES ($1, $2, $3, $4, $5, $5)`,
+		userID, provider, identity.Subject, identity.Email, now,
+	)
+	return userID, err
+}
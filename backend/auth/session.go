@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"booking-backend/database"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented again. The whole session is revoked when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// CreateSession starts a new login session for a user and returns the
+// session ID together with its first refresh token
+func CreateSession(q database.Querier, userID int) (int, string, error) {
+	now := time.Now()
+
+	var sessionID int
+	err := q.QueryRow(
+		"INSERT INTO sessions (user_id, created_at, last_used_at) VALUES ($1, $2, $2) RETURNING id",
+		userID, now,
+	).Scan(&sessionID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	refreshToken, err := insertRefreshToken(q, sessionID, now)
+	if err != nil {
+		return 0, "", err
+	}
+	return sessionID, refreshToken, nil
+}
+
+func insertRefreshToken(q database.Querier, sessionID int, now time.Time) (string, error) {
+	token, hash, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = q.Exec(
+		"INSERT INTO refresh_tokens (session_id, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4)",
+		sessionID, hash, now.Add(RefreshTokenTTL), now,
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. The old token
+// is marked as used; presenting it again revokes the session.
+func RotateRefreshToken(db *database.Store, refreshToken string) (userID int, sessionID int, newToken string, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, "", err
+	}
+	defer tx.Rollback()
+
+	var tokenID int
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+	var isActive bool
+	err = tx.QueryRow(`
+		SELECT rt.id, rt.session_id, rt.expires_at, rt.used_at, s.revoked_at, s.user_id, u.is_active
+		FROM refresh_tokens rt
+		JOIN sessions s ON rt.session_id = s.id
+		JOIN users u ON s.user_id = u.id
+		WHERE rt.token_hash = $1
+		FOR UPDATE`,
+		HashToken(refreshToken),
+	).Scan(&tokenID, &sessionID, &expiresAt, &usedAt, &revokedAt, &userID, &isActive)
+	if err == sql.ErrNoRows {
+		return 0, 0, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	now := time.Now()
+	if usedAt.Valid {
+		// Someone is replaying a rotated token: assume it was stolen
+		if err := RevokeSession(tx, sessionID); err != nil {
+			return 0, 0, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, 0, "", err
+		}
+		return 0, 0, "", ErrRefreshTokenReused
+	}
+	if revokedAt.Valid || !isActive || now.After(expiresAt) {
+		return 0, 0, "", ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET used_at = $1 WHERE id = $2", now, tokenID); err != nil {
+		return 0, 0, "", err
+	}
+	if _, err := tx.Exec("UPDATE sessions SET last_used_at = $1 WHERE id = $2", now, sessionID); err != nil {
+		return 0, 0, "", err
+	}
+	newToken, err = insertRefreshToken(tx, sessionID, now)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, "", err
+	}
+	return userID, sessionID, newToken, nil
+}
+
+// RevokeSession ends a single session
+func RevokeSession(q database.Querier, sessionID int) error {
+	_, err := q.Exec(
+		"UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL",
+		time.Now(), sessionID,
+	)
+	return err
+}
+
+// RevokeUserSessions ends every session of a user except keepSessionID
+// (pass 0 to revoke them all)
+func RevokeUserSessions(q database.Querier, userID int, keepSessionID int) error {
+	_, err := q.Exec(
+		"UPDATE sessions SET revoked_at = $1 WHERE user_id = $2 AND id <> $3 AND revoked_at IS NULL",
+		time.Now(), userID, keepSessionID,
+	)
+	return err
+}
+
+// SessionActive reports whether a session is still valid: not revoked and
+// belonging to an active user
+func SessionActive(q database.Querier, sessionID int, userID int) (bool, error) {
+	var revokedAt sql.NullTime
+	var isActive bool
+	err := q.QueryRow(`
+		SELECT s.revoked_at, u.is_active
+		FROM sessions s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.id = $1 AND s.user_id = $2`,
+		sessionID, userID,
+	).Scan(&revokedAt, &isActive)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !revokedAt.Valid && isActive, nil
+}
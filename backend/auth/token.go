@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"booking-backend/models"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Secret key for JWT. Set JWT_SECRET in production!
+var jwtSecret = secretFromEnv()
+
+const (
+	// AccessTokenTTL is how long an access token (JWT) is valid
+	AccessTokenTTL = 15 * time.Minute
+	// RefreshTokenTTL is how long a refresh token can be used before the
+	// user has to log in again
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+func secretFromEnv() []byte {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte("gtm")
+}
+
+// IssueAccessToken creates a signed JWT for user, bound to a server-side session
+func IssueAccessToken(user models.User, sessionID int) (string, error) {
+	var businessIDValue int
+	if user.BusinessID != nil {
+		businessIDValue = *user.BusinessID
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     user.ID,
+		"email":       user.Email,
+		"role":        user.Role,
+		"business_id": businessIDValue,
+		"sid":         sessionID,
+		"exp":         time.Now().Add(AccessTokenTTL).Unix(),
+	})
+
+	return token.SignedString(jwtSecret)
+}
+
+// ParseAccessToken validates a JWT and returns its claims
+func ParseAccessToken(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate the signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.NewValidationError("Unexpected signing method", jwt.ValidationErrorSignatureInvalid)
+		}
+		return jwtSecret, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid or expired token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+// NewOpaqueToken returns a random token for the client and the hash that is
+// stored server-side. Only the hash is ever written to the database.
+func NewOpaqueToken() (token string, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the SHA-256 hex digest of an opaque token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClaimInt reads a numeric claim. JSON numbers decode as float64.
+func ClaimInt(claims jwt.MapClaims, key string) int {
+	switch v := claims[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
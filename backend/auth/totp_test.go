@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors of RFC 6238 (appendix B), truncated to 6 digits
+func TestTOTPCode(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	code, _ := TOTPCode(secret, TOTPStep(now))
+
+	step, ok := ValidateTOTP(secret, code, now, 0)
+	if !ok || step != TOTPStep(now) {
+		t.Fatalf("current code was rejected")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(30*time.Second), 0); !ok {
+		t.Error("code from the previous step was rejected")
+	}
+	if _, ok := ValidateTOTP(secret, code, now.Add(2*time.Minute), 0); ok {
+		t.Error("code from two minutes ago was accepted")
+	}
+	if _, ok := ValidateTOTP(secret, code, now, step); ok {
+		t.Error("a used code was accepted again")
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"booking-backend/database"
+)
+
+// PurposeMFAChallenge is the user token that stands between the password
+// (or provider sign-in) and the second factor
+const PurposeMFAChallenge = "mfa_challenge"
+
+// MFAChallengeTTL is how long a user has to enter their code
+const MFAChallengeTTL = 5 * time.Minute
+
+// RecoveryCodeCount is how many recovery codes a user gets
+const RecoveryCodeCount = 10
+
+var (
+	// ErrInvalidSecondFactor is returned for wrong, reused or expired codes
+	ErrInvalidSecondFactor = errors.New("invalid authentication code")
+	// ErrTOTPNotSetUp is returned when enabling without starting the setup
+	ErrTOTPNotSetUp = errors.New("two-factor authentication hasn't been set up")
+)
+
+// TwoFactorState is whether a user has two-factor authentication and
+// whether their business requires it
+type TwoFactorState struct {
+	Enabled  bool
+	Required bool
+}
+
+// LoadTwoFactorState reads a user's two-factor state. Only staff and admins
+// are subject to their business's requirement.
+func LoadTwoFactorState(q database.Querier, userID int) (TwoFactorState, error) {
+	var state TwoFactorState
+	var enabledAt sql.NullTime
+	var required sql.NullBool
+	err := q.QueryRow(
+		`SELECT u.totp_enabled_at, b.require_two_factor AND u.role IN ('staff', 'business_admin')
+		 FROM users u LEFT JOIN businesses b ON b.id = u.business_id
+		 WHERE u.id = $1`,
+		userID,
+	).Scan(&enabledAt, &required)
+	state.Enabled = enabledAt.Valid
+	state.Required = required.Valid && required.Bool
+	return state, err
+}
+
+// StartTOTPSetup gives the user a new secret to add to their authenticator
+// app. It takes effect with EnableTOTP.
+func StartTOTPSetup(q database.Querier, userID int) (string, error) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return "", err
+	}
+	_, err = q.Exec("UPDATE users SET totp_secret = $1, totp_last_step = 0 WHERE id = $2", secret, userID)
+	return secret, err
+}
+
+// EnableTOTP turns two-factor authentication on once code shows the
+// authenticator app has the secret, and returns the user's recovery codes
+func EnableTOTP(tx *database.Tx, userID int, code string, now time.Time) ([]string, error) {
+	var secret sql.NullString
+	err := tx.QueryRow("SELECT totp_secret FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&secret)
+	if err != nil {
+		return nil, err
+	}
+	if !secret.Valid || secret.String == "" {
+		return nil, ErrTOTPNotSetUp
+	}
+	step, ok := ValidateTOTP(secret.String, code, now, 0)
+	if !ok {
+		return nil, ErrInvalidSecondFactor
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET totp_enabled_at = $1, totp_last_step = $2 WHERE id = $3",
+		now, step, userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return NewRecoveryCodes(tx, userID, now)
+}
+
+// DisableTOTP turns two-factor authentication off and drops the recovery
+// codes
+func DisableTOTP(q database.Querier, userID int) error {
+	_, err := q.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID)
+	return err
+}
+
+// VerifySecondFactor checks a code from the user's authenticator app or
+// one of their recovery codes. Either can only be used once.
+func VerifySecondFactor(tx *database.Tx, userID int, code string, now time.Time) error {
+	var secret sql.NullString
+	var lastStep int64
+	err := tx.QueryRow(
+		"SELECT totp_secret, totp_last_step FROM users WHERE id = $1 AND totp_enabled_at IS NOT NULL FOR UPDATE",
+		userID,
+	).Scan(&secret, &lastStep)
+	if err == sql.ErrNoRows {
+		return ErrTOTPNotSetUp
+	}
+	if err != nil {
+		return err
+	}
+
+	if step, ok := ValidateTOTP(secret.String, code, now, lastStep); ok {
+		_, err = tx.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2", step, userID)
+		return err
+	}
+
+	// Not an authenticator code, maybe a recovery code
+	result, err := tx.Exec(
+		"UPDATE recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL",
+		now, userID, HashToken(normalizeRecoveryCode(code)),
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+// NewRecoveryCodes replaces the user's recovery codes. The codes are
+// returned once; only their hashes are kept.
+func NewRecoveryCodes(q database.Querier, userID int, now time.Time) ([]string, error) {
+	if _, err := q.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		_, err = q.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES ($1, $2, $3)",
+			userID, HashToken(normalizeRecoveryCode(code)), now,
+		)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+// recoveryAlphabet leaves out characters that are easily confused (0/O,
+// 1/I/L)
+const recoveryAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// newRecoveryCode returns a code like "7KQ4X-M2HNP"
+func newRecoveryCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = recoveryAlphabet[int(b)%len(recoveryAlphabet)]
+	}
+	return fmt.Sprintf("%s-%s", buf[:5], buf[5:]), nil
+}
+
+// normalizeRecoveryCode makes codes typed in lowercase or without the dash
+// match
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
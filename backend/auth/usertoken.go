@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"booking-backend/database"
+)
+
+// Purposes of single-use user tokens
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeEmailVerify   = "email_verify"
+)
+
+// ErrInvalidUserToken is returned for unknown, expired or already used tokens
+var ErrInvalidUserToken = errors.New("invalid or expired token")
+
+// CreateUserToken issues a single-use token for purpose, valid for ttl.
+// Earlier unused tokens for the same user and purpose stop working.
+func CreateUserToken(q database.Querier, userID int, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+
+	_, err := q.Exec(
+		"UPDATE user_tokens SET used_at = $1 WHERE user_id = $2 AND purpose = $3 AND used_at IS NULL",
+		now, userID, purpose,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	token, hash, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = q.Exec(
+		"INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at) VALUES ($1, $2, $3, $4, $5)",
+		userID, purpose, hash, now.Add(ttl), now,
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks a token as used and returns its user. Call it inside
+// the transaction that performs the action, so a failed action leaves the
+// token usable.
+func ConsumeUserToken(tx *database.Tx, purpose string, token string) (int, error) {
+	var tokenID, userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := tx.QueryRow(
+		"SELECT id, user_id, expires_at, used_at FROM user_tokens WHERE token_hash = $1 AND purpose = $2 FOR UPDATE",
+		HashToken(token), purpose,
+	).Scan(&tokenID, &userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidUserToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		return 0, ErrInvalidUserToken
+	}
+
+	if _, err := tx.Exec("UPDATE user_tokens SET used_at = $1 WHERE id = $2", time.Now(), tokenID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// CheckUserToken returns the user of a valid token without using it up
+func CheckUserToken(q database.Querier, purpose string, token string) (int, error) {
+	var userID int
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	err := q.QueryRow(
+		"SELECT user_id, expires_at, used_at FROM user_tokens WHERE token_hash = $1 AND purpose = $2",
+		HashToken(token), purpose,
+	).Scan(&userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidUserToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		return 0, ErrInvalidUserToken
+	}
+	return userID, nil
+}
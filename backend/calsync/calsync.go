@@ -0,0 +1,251 @@
+// Package calsync imports busy times from staff members' external
+// calendars (an ICS URL or an uploaded .ics file) so that public
+// availability leaves them out.
+//
+// Each import's events are expanded into busy_blocks covering a rolling
+// window; a Syncer refreshes URL imports regularly and re-expands uploaded
+// files as the window moves.
+package calsync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/ical"
+	"booking-backend/publicnet"
+)
+
+// Window of busy time kept for each import
+const (
+	History = 24 * time.Hour
+	Horizon = 180 * 24 * time.Hour
+)
+
+// MaxSize is the largest calendar that is imported
+const MaxSize = 5 << 20
+
+const leaseName = "calendar-sync"
+
+// NotBusy is the SQL condition that keeps slot s (the appointment_slots
+// alias) clear of busy time imported from the staff member's (or the whole
+// business's) external calendars
+const NotBusy = `NOT EXISTS (
+	SELECT 1 FROM busy_blocks bb
+	JOIN calendar_imports ci ON bb.import_id = ci.id
+	WHERE ci.business_id = s.business_id
+	AND (ci.staff_id IS NULL OR ci.staff_id = s.staff_id)
+	AND bb.start_time < s.end_time AND bb.end_time > s.start_time
+)`
+
+// Syncer periodically refreshes calendar imports. Only the replica holding
+// the "calendar-sync" lease does the work.
+type Syncer struct {
+	DB       *database.Store
+	Client   *http.Client
+	Interval time.Duration // how often to look for stale imports
+	MaxAge   time.Duration // refresh URL imports older than this
+	Holder   string        // lease holder ID of this process
+}
+
+// NewSyncer creates a Syncer that refreshes URL imports every 15 minutes
+// and uploaded files daily
+func NewSyncer(db *database.Store) *Syncer {
+	return &Syncer{
+		DB:       db,
+		Client:   NewClient(),
+		Interval: time.Minute,
+		MaxAge:   15 * time.Minute,
+		Holder:   database.NewHolderID(),
+	}
+}
+
+// Run refreshes imports until ctx is cancelled
+func (s *Syncer) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	defer database.ReleaseLease(s.DB, leaseName, s.Holder)
+
+	for {
+		if err := s.tick(ctx); err != nil {
+			log.Printf("calsync: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Syncer) tick(ctx context.Context) error {
+	ok, err := database.AcquireLease(s.DB, leaseName, s.Holder, 3*s.Interval)
+	if err != nil || !ok {
+		return err
+	}
+	return s.SyncStale(ctx, time.Now())
+}
+
+// SyncStale refreshes every import that is due: URL imports after MaxAge,
+// uploaded files once a day
+func (s *Syncer) SyncStale(ctx context.Context, now time.Time) error {
+	rows, err := s.DB.Query(
+		`SELECT id FROM calendar_imports
+		 WHERE last_synced_at IS NULL
+		 OR (url IS NOT NULL AND last_synced_at < $1)
+		 OR last_synced_at < $2
+		 ORDER BY last_synced_at`,
+		now.Add(-s.MaxAge), now.Add(-24*time.Hour),
+	)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err := Sync(ctx, s.DB, s.Client, id, now); err != nil {
+			// Recorded on the import for the owner to see
+			log.Printf("calsync: import %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Sync refreshes one import: it fetches the URL (or reads the stored file),
+// replaces the import's busy blocks and records the outcome. A failed fetch
+// keeps the previous blocks and returns ErrCalendar.
+func Sync(ctx context.Context, db *database.Store, client *http.Client, importID int, now time.Time) error {
+	var url, data sql.NullString
+	var timezone string
+	err := db.QueryRow(
+		`SELECT ci.url, ci.ics_data, bz.timezone FROM calendar_imports ci
+		 JOIN businesses bz ON ci.business_id = bz.id
+		 WHERE ci.id = $1`,
+		importID,
+	).Scan(&url, &data, &timezone)
+	if err != nil {
+		return err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	content := []byte(data.String)
+	if url.Valid {
+		content, err = Fetch(ctx, client, url.String)
+	}
+	var periods []ical.Period
+	if err == nil {
+		periods, err = ical.BusyPeriods(content, loc, now.Add(-History), now.Add(Horizon))
+	}
+	if err != nil {
+		db.Exec("UPDATE calendar_imports SET last_synced_at = $1, last_error = $2 WHERE id = $3", now, err.Error(), importID)
+		return fmt.Errorf("%w: %v", ErrCalendar, err)
+	}
+
+	return Store(db, importID, periods, now)
+}
+
+// ErrCalendar is returned by Sync when the calendar couldn't be fetched or
+// read. Why is recorded in the import's last_error; other errors are
+// internal.
+var ErrCalendar = errors.New("calendar could not be fetched or read")
+
+// Store replaces the busy blocks of an import
+func Store(db *database.Store, importID int, periods []ical.Period, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM busy_blocks WHERE import_id = $1", importID); err != nil {
+		return err
+	}
+	for _, p := range periods {
+		_, err := tx.Exec(
+			"INSERT INTO busy_blocks (import_id, start_time, end_time) VALUES ($1, $2, $3)",
+			importID, p.Start.Truncate(time.Second), p.End.Truncate(time.Second),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(
+		"UPDATE calendar_imports SET last_synced_at = $1, last_error = NULL, busy_count = $2 WHERE id = $3",
+		now, len(periods), importID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ErrFetch is returned when a calendar can't be downloaded. The cause is
+// only logged: it could tell the user what the server can reach.
+var ErrFetch = errors.New("could not download the calendar")
+
+// NewClient is the HTTP client calendars are fetched with. Calendar URLs
+// come from users, so it only connects to public addresses.
+func NewClient() *http.Client {
+	return publicnet.NewClient(20 * time.Second)
+}
+
+// Fetch downloads a calendar. webcal:// URLs are fetched over https.
+// Errors are safe to show to the user.
+func Fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	if strings.HasPrefix(url, "webcal://") {
+		url = "https://" + strings.TrimPrefix(url, "webcal://")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid calendar URL")
+	}
+	req.Header.Set("Accept", "text/calendar")
+	req.Header.Set("User-Agent", "booking-calendar-sync/1.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Printf("calsync: fetch %s: %v", url, err)
+		return nil, ErrFetch
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: the calendar server responded %d", ErrFetch, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxSize+1))
+	if err != nil {
+		log.Printf("calsync: fetch %s: %v", url, err)
+		return nil, ErrFetch
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("calendar is larger than %d MB", MaxSize>>20)
+	}
+	return data, nil
+}
@@ -0,0 +1,114 @@
+package calsync
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+)
+
+// TestSync imports testdata/staff.ics from a local calendar server, then
+// checks that a failed refresh keeps the blocks and records the error
+func TestSync(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var down int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		http.ServeFile(w, r, "testdata/staff.ics")
+	}))
+	defer server.Close()
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("INSERT INTO businesses (name, timezone) VALUES ('Acme', 'Europe/Berlin')")
+	exec("INSERT INTO calendar_imports (business_id, name, url) VALUES (1, 'Ann', $1)", server.URL+"/ann.ics")
+
+	now := time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if err := Sync(context.Background(), db, server.Client(), 1, now); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := db.Query("SELECT start_time, end_time FROM busy_blocks WHERE import_id = 1 ORDER BY start_time")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got [][2]time.Time
+	for rows.Next() {
+		var start, end time.Time
+		if err := rows.Scan(&start, &end); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, [2]time.Time{start, end})
+	}
+	rows.Close()
+	utc := func(s string) time.Time {
+		tm, _ := time.Parse("2006-01-02 15:04", s)
+		return tm
+	}
+	want := [][2]time.Time{
+		{utc("2026-03-02 08:00"), utc("2026-03-02 09:00")},
+		{utc("2026-03-03 17:00"), utc("2026-03-03 18:30")}, // 18:00 in Berlin
+		{utc("2026-03-10 17:00"), utc("2026-03-10 18:30")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got busy blocks %v, want %v", got, want)
+	}
+	for i := range want {
+		if !got[i][0].Equal(want[i][0]) || !got[i][1].Equal(want[i][1]) {
+			t.Errorf("block %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+
+	// A failed refresh keeps the blocks and records the error
+	atomic.StoreInt32(&down, 1)
+	if err := Sync(context.Background(), db, server.Client(), 1, now.Add(time.Hour)); !errors.Is(err, ErrCalendar) {
+		t.Fatalf("sync with the calendar server down: %v, want ErrCalendar", err)
+	}
+	var count int
+	var lastError sql.NullString
+	err = db.QueryRow(
+		"SELECT (SELECT COUNT(*) FROM busy_blocks WHERE import_id = 1), last_error FROM calendar_imports WHERE id = 1",
+	).Scan(&count, &lastError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(want) || !lastError.Valid {
+		t.Errorf("after a failed refresh: %d blocks, last_error %v; want %d blocks and an error", count, lastError, len(want))
+	}
+}
+
+// A calendar on the server's own network can't be fetched, and the error
+// doesn't say why
+func TestFetchRefusesLocalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "testdata/staff.ics")
+	}))
+	defer server.Close()
+	_, err := Fetch(context.Background(), NewClient(), server.URL)
+	if err != ErrFetch {
+		t.Errorf("fetching from %s: %v, want ErrFetch", server.URL, err)
+	}
+}
@@ -0,0 +1,104 @@
+// Package cancellation evaluates a business's cancellation policy: free
+// cancellation until some hours before the appointment, a percentage of
+// the price for later cancellations and another for no-shows.
+package cancellation
+
+import (
+	"fmt"
+	"time"
+
+	"booking-backend/models"
+)
+
+// Rules an outcome can come from
+const (
+	RuleFree              = "free"
+	RuleLateCancellation  = "late_cancellation"
+	RuleNoShow            = "no_show"
+	RuleCancelledBusiness = "cancelled_by_business"
+)
+
+// Limits on policy values
+const (
+	MaxFreeHours = 30 * 24
+	MaxPercent   = 100
+)
+
+// Validate checks that a policy's values are in range
+func Validate(p models.CancellationPolicy) error {
+	if p.FreeHours < 0 || p.FreeHours > MaxFreeHours {
+		return fmt.Errorf("free_until_hours must be between 0 and %d", MaxFreeHours)
+	}
+	if p.LateFeePercent < 0 || p.LateFeePercent > MaxPercent {
+		return fmt.Errorf("late_fee_percent must be between 0 and %d", MaxPercent)
+	}
+	if p.NoShowFeePercent < 0 || p.NoShowFeePercent > MaxPercent {
+		return fmt.Errorf("no_show_fee_percent must be between 0 and %d", MaxPercent)
+	}
+	return nil
+}
+
+// Cancel works out what a cancellation at "at" costs, as Text describes
+// it. Cancellations by the business are always free for the customer.
+func Cancel(p models.CancellationPolicy, byBusiness bool, start, at time.Time, priceCents int) models.CancellationOutcome {
+	switch {
+	case byBusiness:
+		return outcome(p, RuleCancelledBusiness, 0, priceCents)
+	case p.LateFeePercent == 0, p.FreeHours > 0 && start.Sub(at) >= time.Duration(p.FreeHours)*time.Hour:
+		return outcome(p, RuleFree, 0, priceCents)
+	default:
+		return outcome(p, RuleLateCancellation, p.LateFeePercent, priceCents)
+	}
+}
+
+// NoShow works out what missing an appointment costs
+func NoShow(p models.CancellationPolicy, priceCents int) models.CancellationOutcome {
+	return outcome(p, RuleNoShow, p.NoShowFeePercent, priceCents)
+}
+
+func outcome(p models.CancellationPolicy, rule string, percent, priceCents int) models.CancellationOutcome {
+	return models.CancellationOutcome{
+		Rule:       rule,
+		FeePercent: percent,
+		FeeCents:   (priceCents*percent + 50) / 100,
+		Policy:     Text(p),
+	}
+}
+
+// Text describes a policy to customers, e.g. "Free cancellation until 24
+// hours before the appointment; later cancellations are charged 50% of the
+// price. Missed appointments are charged the full price."
+func Text(p models.CancellationPolicy) string {
+	var text string
+	switch {
+	case p.LateFeePercent == 0:
+		text = "Free cancellation at any time before the appointment."
+	case p.FreeHours == 0:
+		text = fmt.Sprintf("Cancellations are charged %s.", share(p.LateFeePercent))
+	default:
+		text = fmt.Sprintf("Free cancellation until %s before the appointment; later cancellations are charged %s.",
+			hours(p.FreeHours), share(p.LateFeePercent))
+	}
+	if p.NoShowFeePercent > 0 {
+		text += fmt.Sprintf(" Missed appointments are charged %s.", share(p.NoShowFeePercent))
+	}
+	return text
+}
+
+func share(percent int) string {
+	if percent == 100 {
+		return "the full price"
+	}
+	return fmt.Sprintf("%d%% of the price", percent)
+}
+
+func hours(n int) string {
+	switch {
+	case n == 1:
+		return "1 hour"
+	case n%24 == 0 && n > 24:
+		return fmt.Sprintf("%d days", n/24)
+	default:
+		return fmt.Sprintf("%d hours", n)
+	}
+}
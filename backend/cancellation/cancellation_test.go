@@ -0,0 +1,42 @@
+package cancellation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"booking-backend/models"
+)
+
+// Cancel charges what Text promises
+func TestCancelMatchesText(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		freeHours, feePercent int
+		before                time.Duration
+		wantRule              string
+		wantFee               int
+		wantText              string
+	}{
+		{0, 0, 48 * time.Hour, RuleFree, 0, "Free cancellation at any time"},
+		{0, 0, time.Hour, RuleFree, 0, "Free cancellation at any time"},
+		{0, 50, 48 * time.Hour, RuleLateCancellation, 1000, "Cancellations are charged 50%"},
+		{0, 50, time.Hour, RuleLateCancellation, 1000, "Cancellations are charged 50%"},
+		{24, 0, 48 * time.Hour, RuleFree, 0, "Free cancellation at any time"},
+		{24, 0, time.Hour, RuleFree, 0, "Free cancellation at any time"},
+		{24, 50, 48 * time.Hour, RuleFree, 0, "Free cancellation until 24 hours"},
+		{24, 50, 24 * time.Hour, RuleFree, 0, "Free cancellation until 24 hours"},
+		{24, 50, time.Hour, RuleLateCancellation, 1000, "later cancellations are charged 50%"},
+	}
+	for _, tt := range tests {
+		p := models.CancellationPolicy{FreeHours: tt.freeHours, LateFeePercent: tt.feePercent}
+		got := Cancel(p, false, start, start.Add(-tt.before), 2000)
+		if got.Rule != tt.wantRule || got.FeeCents != tt.wantFee {
+			t.Errorf("free %dh, fee %d%%, %v before: got %s %d cents, want %s %d cents",
+				tt.freeHours, tt.feePercent, tt.before, got.Rule, got.FeeCents, tt.wantRule, tt.wantFee)
+		}
+		if !strings.Contains(got.Policy, tt.wantText) {
+			t.Errorf("free %dh, fee %d%%: policy %q doesn't say %q", tt.freeHours, tt.feePercent, got.Policy, tt.wantText)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Dialect describes how queries written in PostgreSQL syntax are adapted
+// to a particular database backend
+type Dialect interface {
+	// Name is the short name of the backend ("postgres" or "sqlite")
+	Name() string
+	// DriverName is the database/sql driver to open
+	DriverName() string
+	// Rebind rewrites a PostgreSQL-style query for this backend
+	Rebind(query string) string
+	// Args adapts query arguments for this backend
+	Args(args []interface{}) []interface{}
+}
+
+// postgresDialect is the native dialect; queries pass through unchanged
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string                          { return "postgres" }
+func (postgresDialect) DriverName() string                    { return "postgres" }
+func (postgresDialect) Rebind(query string) string            { return query }
+func (postgresDialect) Args(args []interface{}) []interface{} { return args }
+
+// sqliteDialect adapts queries for SQLite 3.35+.
+//
+//   - $1, $2 ... become ?1, ?2 ... so numbered parameters keep their meaning
+//     even when reused or out of order.
+//   - RETURNING is supported natively by SQLite and left alone.
+//   - Row locks (FOR UPDATE [OF ...] [SKIP LOCKED | NOWAIT]) are dropped; SQLite
+//     transactions are opened with _txlock=immediate instead, which
+//     serializes writers for the whole transaction.
+//   - Time arguments are converted to UTC because timestamps are stored as
+//     text and compared lexically.
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string       { return "sqlite" }
+func (sqliteDialect) DriverName() string { return "sqlite3" }
+
+var forUpdateClause = regexp.MustCompile(`(?i)\s+FOR\s+UPDATE(\s+OF\s+\w+(\s*,\s*\w+)*)?(\s+SKIP\s+LOCKED|\s+NOWAIT)?`)
+
+func (sqliteDialect) Rebind(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			ch = '?'
+		}
+		b.WriteByte(ch)
+	}
+
+	return forUpdateClause.ReplaceAllString(b.String(), "")
+}
+
+func (sqliteDialect) Args(args []interface{}) []interface{} {
+	return utcArgs(args)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSQLiteRebind(t *testing.T) {
+	tests := []struct {
+		name, query, want string
+	}{
+		{
+			name:  "numbered parameters",
+			query: "SELECT id FROM users WHERE email = $1 AND business_id = $2",
+			want:  "SELECT id FROM users WHERE email = ?1 AND business_id = ?2",
+		},
+		{
+			name:  "reused and out of order",
+			query: "UPDATE slots SET booked_count = booked_count + $2 WHERE id = $1 AND capacity >= $2",
+			want:  "UPDATE slots SET booked_count = booked_count + ?2 WHERE id = ?1 AND capacity >= ?2",
+		},
+		{
+			name:  "two-digit parameters",
+			query: "VALUES ($9, $10, $11)",
+			want:  "VALUES (?9, ?10, ?11)",
+		},
+		{
+			name:  "dollar signs in string literals are kept",
+			query: "SELECT '$1', \"$2\" FROM prices WHERE amount = $1",
+			want:  "SELECT '$1', \"$2\" FROM prices WHERE amount = ?1",
+		},
+		{
+			name:  "dollar sign without a digit is kept",
+			query: "SELECT price$ FROM t WHERE x = $1",
+			want:  "SELECT price$ FROM t WHERE x = ?1",
+		},
+		{
+			name:  "returning is left alone",
+			query: "INSERT INTO holds (slot_id) VALUES ($1) RETURNING id",
+			want:  "INSERT INTO holds (slot_id) VALUES (?1) RETURNING id",
+		},
+		{
+			name:  "for update",
+			query: "SELECT capacity FROM appointment_slots WHERE id = $1 FOR UPDATE",
+			want:  "SELECT capacity FROM appointment_slots WHERE id = ?1",
+		},
+		{
+			name:  "for update of several tables",
+			query: "SELECT s.id FROM appointment_slots s JOIN services sv ON sv.id = s.service_id WHERE s.id = $1 FOR UPDATE OF s, sv",
+			want:  "SELECT s.id FROM appointment_slots s JOIN services sv ON sv.id = s.service_id WHERE s.id = ?1",
+		},
+		{
+			name:  "for update skip locked",
+			query: "SELECT id FROM webhook_deliveries\n\t\t\t WHERE next_attempt_at <= $1\n\t\t\t FOR UPDATE SKIP LOCKED LIMIT 10",
+			want:  "SELECT id FROM webhook_deliveries\n\t\t\t WHERE next_attempt_at <= ?1 LIMIT 10",
+		},
+		{
+			name:  "lowercase for update nowait",
+			query: "select id from leases where name = $1 for update nowait",
+			want:  "select id from leases where name = ?1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (sqliteDialect{}).Rebind(tt.query); got != tt.want {
+				t.Errorf("Rebind(%q)\n got %q\nwant %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRebindIsIdentity(t *testing.T) {
+	query := "SELECT id FROM appointment_slots WHERE id = $1 FOR UPDATE"
+	if got := (postgresDialect{}).Rebind(query); got != query {
+		t.Errorf("Rebind(%q) = %q", query, got)
+	}
+}
+
+func TestSQLiteArgsAreUTC(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	at := time.Date(2026, time.March, 2, 9, 0, 0, 0, berlin)
+	args := (sqliteDialect{}).Args([]interface{}{at, &at, (*time.Time)(nil), 7})
+
+	if tm, ok := args[0].(time.Time); !ok || tm.Location() != time.UTC || !tm.Equal(at) {
+		t.Errorf("time.Time argument = %v, want %v in UTC", args[0], at)
+	}
+	if tm, ok := args[1].(time.Time); !ok || tm.Location() != time.UTC || !tm.Equal(at) {
+		t.Errorf("*time.Time argument = %v, want %v in UTC", args[1], at)
+	}
+	if args[2] != nil {
+		t.Errorf("nil *time.Time argument = %v, want nil", args[2])
+	}
+	if args[3] != 7 {
+		t.Errorf("int argument = %v, want 7", args[3])
+	}
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+// NewHolderID returns an identifier for this process to use when taking
+// leases, unique across restarts and replicas
+func NewHolderID() string {
+	host, _ := os.Hostname()
+	buf := make([]byte, 4)
+	rand.Read(buf)
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(buf))
+}
+
+// AcquireLease takes or renews the named lease for holder. It returns false
+// if another holder owns an unexpired lease. Background jobs use leases so
+// that only one replica runs them at a time.
+func AcquireLease(s *Store, name, holder string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	result, err := s.Exec(
+		`INSERT INTO scheduler_leases (name, holder, expires_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		 WHERE scheduler_leases.holder = EXCLUDED.holder OR scheduler_leases.expires_at < $4`,
+		name, holder, now.Add(ttl), now,
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected > 0, nil
+}
+
+// ReleaseLease gives up a lease early, e.g. on shutdown
+func ReleaseLease(s *Store, name, holder string) error {
+	_, err := s.Exec("DELETE FROM scheduler_leases WHERE name = $1 AND holder = $2", name, holder)
+	return err
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// Schema migrations live in migrations/<dialect>/NNNN_name.sql. Every
+// migration exists once per dialect with the same file name.
+//
+//go:embed migrations
+var migrations embed.FS
+
+// Migrate applies any migrations that have not been applied yet
+func Migrate(s *Store) error {
+	_, err := s.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version VARCHAR(255) PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("could not create schema_migrations: %v", err)
+	}
+
+	dir := "migrations/" + s.dialect.Name()
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".sql") {
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+
+	// Migrations run on one connection. On SQLite it has foreign keys off,
+	// as SQLite asks for when a table is rebuilt: dropping the old table
+	// would otherwise delete the rows referencing it. Each migration is
+	// checked for broken references before it commits.
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	sqlite := s.dialect.Name() == "sqlite"
+	if sqlite {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+	}
+
+	for _, name := range files {
+		version := strings.TrimSuffix(name, ".sql")
+
+		var applied int
+		err := conn.QueryRowContext(ctx, s.dialect.Rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = $1"), version).Scan(&applied)
+		if err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := migrations.ReadFile(dir + "/" + name)
+		if err != nil {
+			return err
+		}
+
+		sqlTx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		tx := &Tx{tx: sqlTx, dialect: s.dialect}
+		if _, err := tx.tx.Exec(string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s failed: %v", name, err)
+		}
+		if sqlite {
+			if err := foreignKeyCheck(tx); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %s failed: %v", name, err)
+			}
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		fmt.Printf("Applied migration %s\n", version)
+	}
+
+	return nil
+}
+
+// foreignKeyCheck fails if a SQLite migration left rows referencing rows
+// that don't exist
+func foreignKeyCheck(tx *Tx) error {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fk int
+		if err := rows.Scan(&table, &rowID, &parent, &fk); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s references a missing %s", rowID.Int64, table, parent)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,43 @@
+-- Public booking flow and the notification outbox
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS phone VARCHAR(50);
+
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS manage_token VARCHAR(64);
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS cancelled_at TIMESTAMPTZ;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_bookings_manage_token ON bookings (manage_token);
+CREATE INDEX IF NOT EXISTS idx_bookings_slot ON bookings (slot_id);
+
+-- Per-business overrides of the built-in notification templates
+CREATE TABLE IF NOT EXISTS notification_templates (
+    id SERIAL PRIMARY KEY,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body_text TEXT NOT NULL,
+    body_html TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (business_id, event, channel)
+);
+
+-- Rendered notifications waiting to be delivered
+CREATE TABLE IF NOT EXISTS notification_outbox (
+    id SERIAL PRIMARY KEY,
+    business_id INTEGER REFERENCES businesses(id) ON DELETE CASCADE,
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE SET NULL,
+    event VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body_text TEXT NOT NULL,
+    body_html TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until TIMESTAMPTZ,
+    last_error TEXT,
+    sent_at TIMESTAMPTZ,
+    failed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_outbox_pending ON notification_outbox (next_attempt_at) WHERE sent_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,21 @@
+-- Booking reminders
+
+-- Minutes before start_time at which reminders are sent, comma separated
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS reminder_offsets VARCHAR(255) NOT NULL DEFAULT '1440,120';
+
+-- One row per reminder sent (or skipped); the primary key makes sending
+-- exactly-once even with several schedulers
+CREATE TABLE IF NOT EXISTS booking_reminders (
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    offset_minutes INTEGER NOT NULL,
+    skipped BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (booking_id, offset_minutes)
+);
+
+-- Leases for background jobs that must only run on one replica at a time
+CREATE TABLE IF NOT EXISTS scheduler_leases (
+    name VARCHAR(100) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
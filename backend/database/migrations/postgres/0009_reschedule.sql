@@ -0,0 +1,25 @@
+-- Rescheduling and booking history
+
+-- Customers can't change a booking within reschedule_cutoff_minutes of its
+-- start, nor move it more than max_reschedules times
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS reschedule_cutoff_minutes INTEGER NOT NULL DEFAULT 720;
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS max_reschedules INTEGER NOT NULL DEFAULT 2;
+
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS reschedule_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS rescheduled_at TIMESTAMPTZ;
+
+-- What happened to each booking, and who did it
+CREATE TABLE IF NOT EXISTS booking_events (
+    id SERIAL PRIMARY KEY,
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    from_slot_id INTEGER,
+    to_slot_id INTEGER,
+    from_start TIMESTAMPTZ,
+    to_start TIMESTAMPTZ,
+    actor VARCHAR(20) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_events_booking ON booking_events (booking_id, id);
@@ -0,0 +1,13 @@
+-- Temporary slot holds during checkout
+
+-- A held slot is taken off public availability (is_available = false)
+-- until the customer books it with the token or the hold expires
+CREATE TABLE IF NOT EXISTS slot_holds (
+    id SERIAL PRIMARY KEY,
+    slot_id INTEGER NOT NULL UNIQUE REFERENCES appointment_slots(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_slot_holds_expires ON slot_holds (expires_at);
@@ -0,0 +1,17 @@
+-- Seat capacity for classes and group sessions
+
+-- New slots of a service get its capacity unless the generator overrides it
+ALTER TABLE services ADD COLUMN IF NOT EXISTS capacity INTEGER NOT NULL DEFAULT 1;
+
+-- booked_count counts the seats that are booked, held or offered to the
+-- waitlist; is_available stays false once it reaches capacity
+ALTER TABLE appointment_slots ADD COLUMN IF NOT EXISTS capacity INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE appointment_slots ADD COLUMN IF NOT EXISTS booked_count INTEGER NOT NULL DEFAULT 0;
+UPDATE appointment_slots SET booked_count = 1 WHERE is_available = false;
+
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS seats INTEGER NOT NULL DEFAULT 1;
+
+-- Several customers can hold seats in the same slot
+ALTER TABLE slot_holds ADD COLUMN IF NOT EXISTS seats INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE slot_holds DROP CONSTRAINT IF EXISTS slot_holds_slot_id_key;
+CREATE INDEX IF NOT EXISTS idx_slot_holds_slot ON slot_holds (slot_id);
@@ -0,0 +1,38 @@
+-- Bookings of several services back to back
+
+-- Time a service needs after it before the next service of the same
+-- booking can start (clean-up, changing rooms)
+ALTER TABLE services ADD COLUMN IF NOT EXISTS buffer_minutes INTEGER NOT NULL DEFAULT 0;
+
+-- End of the last service of a multi-service booking; NULL when the booking
+-- ends with its slot
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS ends_at TIMESTAMPTZ;
+
+-- The ordered services of a multi-service booking, or of a hold until it
+-- is booked. DeleteService refuses services of upcoming bookings and holds;
+-- past and cancelled bookings lose the deleted service from their list.
+CREATE TABLE IF NOT EXISTS booking_services (
+    id SERIAL PRIMARY KEY,
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE CASCADE,
+    hold_id INTEGER REFERENCES slot_holds(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    service_id INTEGER NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    start_time TIMESTAMPTZ NOT NULL,
+    end_time TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_booking_services_booking ON booking_services (booking_id, position);
+CREATE INDEX IF NOT EXISTS idx_booking_services_hold ON booking_services (hold_id);
+
+-- Slots of the same staff member taken in full because a multi-service
+-- booking (or hold) runs over them
+CREATE TABLE IF NOT EXISTS slot_blocks (
+    id SERIAL PRIMARY KEY,
+    slot_id INTEGER NOT NULL REFERENCES appointment_slots(id) ON DELETE CASCADE,
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE CASCADE,
+    hold_id INTEGER REFERENCES slot_holds(id) ON DELETE CASCADE,
+    seats INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_slot_blocks_booking ON slot_blocks (booking_id);
+CREATE INDEX IF NOT EXISTS idx_slot_blocks_hold ON slot_blocks (hold_id);
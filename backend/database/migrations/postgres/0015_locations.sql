@@ -0,0 +1,43 @@
+-- Businesses with several locations
+
+-- opening_hours is a JSON object of weekday ("mon" ... "sun") to a list of
+-- {"open": "09:00", "close": "17:00"} periods; NULL means not set
+CREATE TABLE IF NOT EXISTS locations (
+    id SERIAL PRIMARY KEY,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    address TEXT,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    opening_hours TEXT,
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_locations_business ON locations (business_id);
+
+-- Staff working at a location. Users assigned to locations (admins
+-- included) only see and manage those locations; users without any work
+-- across the whole business.
+CREATE TABLE IF NOT EXISTS location_staff (
+    location_id INTEGER NOT NULL REFERENCES locations(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (location_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_location_staff_user ON location_staff (user_id);
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES locations(id);
+ALTER TABLE appointment_slots ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES locations(id);
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS location_id INTEGER REFERENCES locations(id);
+
+-- Existing businesses get one location with their name and timezone
+INSERT INTO locations (business_id, name, timezone)
+    SELECT id, name, timezone FROM businesses
+    WHERE NOT EXISTS (SELECT 1 FROM locations l WHERE l.business_id = businesses.id);
+
+UPDATE services SET location_id = (SELECT MIN(l.id) FROM locations l WHERE l.business_id = services.business_id)
+    WHERE location_id IS NULL;
+UPDATE appointment_slots SET location_id = (SELECT sv.location_id FROM services sv WHERE sv.id = appointment_slots.service_id)
+    WHERE location_id IS NULL;
+UPDATE bookings SET location_id = (SELECT s.location_id FROM appointment_slots s WHERE s.id = bookings.slot_id)
+    WHERE location_id IS NULL;
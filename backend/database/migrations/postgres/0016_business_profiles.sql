@@ -0,0 +1,16 @@
+-- Public business profiles for the booking page
+
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS slug VARCHAR(64);
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS description TEXT;
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS address TEXT;
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS phone VARCHAR(32);
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS email VARCHAR(255);
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS website TEXT;
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS logo_url TEXT;
+-- Same JSON format as locations.opening_hours
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS opening_hours TEXT;
+
+-- Existing businesses get a placeholder slug their admins can change
+UPDATE businesses SET slug = 'business-' || id WHERE slug IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_businesses_slug ON businesses (slug);
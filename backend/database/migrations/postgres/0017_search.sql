@@ -0,0 +1,9 @@
+-- Business directory search
+
+-- category is a lowercase keyword such as "hair" or "massage"; city is
+-- where the business (or each of its locations) is
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS category VARCHAR(64);
+ALTER TABLE businesses ADD COLUMN IF NOT EXISTS city VARCHAR(128);
+ALTER TABLE locations ADD COLUMN IF NOT EXISTS city VARCHAR(128);
+
+CREATE INDEX IF NOT EXISTS idx_businesses_category ON businesses (category);
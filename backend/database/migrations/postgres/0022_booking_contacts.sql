@@ -0,0 +1,18 @@
+-- Public bookings and waitlist entries keep the contact details they were
+-- made with instead of being attached to whichever account has that email.
+-- customer_id links them to an account once its owner has verified the
+-- email.
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS customer_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS customer_email VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE bookings ADD COLUMN IF NOT EXISTS customer_phone VARCHAR(50);
+UPDATE bookings b SET customer_name = u.full_name, customer_email = u.email, customer_phone = u.phone
+    FROM users u WHERE b.customer_id = u.id;
+ALTER TABLE bookings ALTER COLUMN customer_id DROP NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_bookings_unlinked_email ON bookings (customer_email) WHERE customer_id IS NULL;
+
+ALTER TABLE waitlist_entries ADD COLUMN IF NOT EXISTS customer_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE waitlist_entries ADD COLUMN IF NOT EXISTS customer_email VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE waitlist_entries ADD COLUMN IF NOT EXISTS customer_phone VARCHAR(50);
+UPDATE waitlist_entries w SET customer_name = u.full_name, customer_email = u.email, customer_phone = u.phone
+    FROM users u WHERE w.customer_id = u.id;
+ALTER TABLE waitlist_entries ALTER COLUMN customer_id DROP NOT NULL;
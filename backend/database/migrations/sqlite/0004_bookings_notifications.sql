@@ -0,0 +1,43 @@
+-- Public booking flow and the notification outbox
+
+ALTER TABLE users ADD COLUMN phone VARCHAR(50);
+
+ALTER TABLE bookings ADD COLUMN manage_token VARCHAR(64);
+ALTER TABLE bookings ADD COLUMN cancelled_at TIMESTAMP;
+CREATE UNIQUE INDEX idx_bookings_manage_token ON bookings (manage_token);
+CREATE INDEX idx_bookings_slot ON bookings (slot_id);
+
+-- Per-business overrides of the built-in notification templates
+CREATE TABLE notification_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body_text TEXT NOT NULL,
+    body_html TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (business_id, event, channel)
+);
+
+-- Rendered notifications waiting to be delivered
+CREATE TABLE notification_outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    business_id INTEGER REFERENCES businesses(id) ON DELETE CASCADE,
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE SET NULL,
+    event VARCHAR(50) NOT NULL,
+    channel VARCHAR(20) NOT NULL,
+    recipient VARCHAR(255) NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    body_text TEXT NOT NULL,
+    body_html TEXT NOT NULL DEFAULT '',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP,
+    last_error TEXT,
+    sent_at TIMESTAMP,
+    failed_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notification_outbox_pending ON notification_outbox (next_attempt_at) WHERE sent_at IS NULL AND failed_at IS NULL;
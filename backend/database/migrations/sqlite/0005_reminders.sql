@@ -0,0 +1,21 @@
+-- Booking reminders
+
+-- Minutes before start_time at which reminders are sent, comma separated
+ALTER TABLE businesses ADD COLUMN reminder_offsets VARCHAR(255) NOT NULL DEFAULT '1440,120';
+
+-- One row per reminder sent (or skipped); the primary key makes sending
+-- exactly-once even with several schedulers
+CREATE TABLE booking_reminders (
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    offset_minutes INTEGER NOT NULL,
+    skipped BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (booking_id, offset_minutes)
+);
+
+-- Leases for background jobs that must only run on one replica at a time
+CREATE TABLE scheduler_leases (
+    name VARCHAR(100) PRIMARY KEY,
+    holder VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
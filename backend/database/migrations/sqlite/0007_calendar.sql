@@ -0,0 +1,17 @@
+-- Calendar feeds and staff assignment of slots
+
+ALTER TABLE appointment_slots ADD COLUMN staff_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+CREATE INDEX idx_appointment_slots_staff_start ON appointment_slots (staff_id, start_time);
+
+-- Secret feed URLs; staff_id is NULL for the whole business's feed
+CREATE TABLE calendar_feeds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    staff_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE INDEX idx_calendar_feeds_business ON calendar_feeds (business_id);
@@ -0,0 +1,27 @@
+-- Busy times imported from external calendars
+
+-- staff_id is NULL for imports that block the whole business (e.g. holidays).
+-- Either url is set (fetched periodically) or ics_data holds an uploaded file.
+CREATE TABLE calendar_imports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    staff_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    url TEXT,
+    ics_data TEXT,
+    busy_count INTEGER NOT NULL DEFAULT 0,
+    last_synced_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_calendar_imports_business ON calendar_imports (business_id);
+
+CREATE TABLE busy_blocks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    import_id INTEGER NOT NULL REFERENCES calendar_imports(id) ON DELETE CASCADE,
+    start_time TIMESTAMP NOT NULL,
+    end_time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_busy_blocks_import_start ON busy_blocks (import_id, start_time);
@@ -0,0 +1,25 @@
+-- Rescheduling and booking history
+
+-- Customers can't change a booking within reschedule_cutoff_minutes of its
+-- start, nor move it more than max_reschedules times
+ALTER TABLE businesses ADD COLUMN reschedule_cutoff_minutes INTEGER NOT NULL DEFAULT 720;
+ALTER TABLE businesses ADD COLUMN max_reschedules INTEGER NOT NULL DEFAULT 2;
+
+ALTER TABLE bookings ADD COLUMN reschedule_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE bookings ADD COLUMN rescheduled_at TIMESTAMP;
+
+-- What happened to each booking, and who did it
+CREATE TABLE booking_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    booking_id INTEGER NOT NULL REFERENCES bookings(id) ON DELETE CASCADE,
+    event VARCHAR(50) NOT NULL,
+    from_slot_id INTEGER,
+    to_slot_id INTEGER,
+    from_start TIMESTAMP,
+    to_start TIMESTAMP,
+    actor VARCHAR(20) NOT NULL,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_booking_events_booking ON booking_events (booking_id, id);
@@ -0,0 +1,15 @@
+-- Cancellation policies and fees
+
+-- Prices are in the smallest unit of the business's currency
+ALTER TABLE services ADD COLUMN price_cents INTEGER NOT NULL DEFAULT 0;
+
+-- Cancelling is free until cancel_free_hours before the start; later
+-- cancellations cost late_cancel_fee_percent of the price, and no-shows
+-- no_show_fee_percent
+ALTER TABLE businesses ADD COLUMN cancel_free_hours INTEGER NOT NULL DEFAULT 24;
+ALTER TABLE businesses ADD COLUMN late_cancel_fee_percent INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE businesses ADD COLUMN no_show_fee_percent INTEGER NOT NULL DEFAULT 0;
+
+-- The fee owed under the policy when the booking was cancelled or missed
+ALTER TABLE bookings ADD COLUMN fee_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE bookings ADD COLUMN fee_rule VARCHAR(30);
@@ -0,0 +1,24 @@
+-- Waitlist for fully booked days
+
+-- A customer waiting for a slot of a service between window_start and
+-- window_end. When a slot in the window frees up it is held for the first
+-- waiting customer (status 'offered') until offer_expires_at.
+CREATE TABLE waitlist_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    service_id INTEGER NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    customer_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    notes TEXT,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'offered', 'booked', 'expired', 'left')),
+    offered_slot_id INTEGER REFERENCES appointment_slots(id) ON DELETE SET NULL,
+    offered_at TIMESTAMP,
+    offer_expires_at TIMESTAMP,
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_waitlist_waiting ON waitlist_entries (business_id, service_id, status, created_at);
+CREATE INDEX idx_waitlist_offers ON waitlist_entries (status, offer_expires_at);
@@ -0,0 +1,13 @@
+-- Temporary slot holds during checkout
+
+-- A held slot is taken off public availability (is_available = false)
+-- until the customer books it with the token or the hold expires
+CREATE TABLE slot_holds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slot_id INTEGER NOT NULL UNIQUE REFERENCES appointment_slots(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_slot_holds_expires ON slot_holds (expires_at);
@@ -0,0 +1,30 @@
+-- Seat capacity for classes and group sessions
+
+-- New slots of a service get its capacity unless the generator overrides it
+ALTER TABLE services ADD COLUMN capacity INTEGER NOT NULL DEFAULT 1;
+
+-- booked_count counts the seats that are booked, held or offered to the
+-- waitlist; is_available stays false once it reaches capacity
+ALTER TABLE appointment_slots ADD COLUMN capacity INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE appointment_slots ADD COLUMN booked_count INTEGER NOT NULL DEFAULT 0;
+UPDATE appointment_slots SET booked_count = 1 WHERE is_available = false;
+
+ALTER TABLE bookings ADD COLUMN seats INTEGER NOT NULL DEFAULT 1;
+
+-- Several customers can hold seats in the same slot. SQLite can't drop a
+-- UNIQUE constraint, so the table is rebuilt without it.
+CREATE TABLE slot_holds_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slot_id INTEGER NOT NULL REFERENCES appointment_slots(id) ON DELETE CASCADE,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    seats INTEGER NOT NULL DEFAULT 1,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO slot_holds_new (id, slot_id, token, expires_at, created_at)
+    SELECT id, slot_id, token, expires_at, created_at FROM slot_holds;
+DROP TABLE slot_holds;
+ALTER TABLE slot_holds_new RENAME TO slot_holds;
+
+CREATE INDEX idx_slot_holds_expires ON slot_holds (expires_at);
+CREATE INDEX idx_slot_holds_slot ON slot_holds (slot_id);
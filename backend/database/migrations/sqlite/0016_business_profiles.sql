@@ -0,0 +1,16 @@
+-- Public business profiles for the booking page
+
+ALTER TABLE businesses ADD COLUMN slug VARCHAR(64);
+ALTER TABLE businesses ADD COLUMN description TEXT;
+ALTER TABLE businesses ADD COLUMN address TEXT;
+ALTER TABLE businesses ADD COLUMN phone VARCHAR(32);
+ALTER TABLE businesses ADD COLUMN email VARCHAR(255);
+ALTER TABLE businesses ADD COLUMN website TEXT;
+ALTER TABLE businesses ADD COLUMN logo_url TEXT;
+-- Same JSON format as locations.opening_hours
+ALTER TABLE businesses ADD COLUMN opening_hours TEXT;
+
+-- Existing businesses get a placeholder slug their admins can change
+UPDATE businesses SET slug = 'business-' || id WHERE slug IS NULL;
+
+CREATE UNIQUE INDEX idx_businesses_slug ON businesses (slug);
@@ -0,0 +1,9 @@
+-- Business directory search
+
+-- category is a lowercase keyword such as "hair" or "massage"; city is
+-- where the business (or each of its locations) is
+ALTER TABLE businesses ADD COLUMN category VARCHAR(64);
+ALTER TABLE businesses ADD COLUMN city VARCHAR(128);
+ALTER TABLE locations ADD COLUMN city VARCHAR(128);
+
+CREATE INDEX idx_businesses_category ON businesses (category);
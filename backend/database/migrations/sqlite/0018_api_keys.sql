@@ -0,0 +1,20 @@
+-- API keys for server-to-server integrations. Only the SHA-256 hash of a
+-- key is stored; prefix is its first characters, to tell keys apart.
+-- scopes is a comma separated list such as "read:slots,write:bookings".
+CREATE TABLE api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP,
+    revoked_at TIMESTAMP
+);
+
+CREATE INDEX idx_api_keys_business ON api_keys (business_id);
+
+-- Changes made with an API key are attributed to it in booking histories
+ALTER TABLE booking_events ADD COLUMN api_key_id INTEGER REFERENCES api_keys(id) ON DELETE SET NULL;
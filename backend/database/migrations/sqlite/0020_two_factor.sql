@@ -0,0 +1,40 @@
+-- Two-factor authentication with TOTP (authenticator apps). totp_secret is
+-- set when the user starts enrolling and totp_enabled_at once they have
+-- proven it works. totp_last_step is the time step of the last accepted
+-- code, so a code can't be used twice.
+ALTER TABLE users ADD COLUMN totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN totp_enabled_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+
+-- Single-use codes for when the authenticator app is lost. Only hashes are
+-- stored.
+CREATE TABLE recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_recovery_codes_user ON recovery_codes (user_id);
+
+-- The MFA token between the password and the code is a user token. SQLite
+-- can't change a CHECK constraint, so the table is rebuilt.
+CREATE TABLE user_tokens_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(32) NOT NULL CHECK (purpose IN ('password_reset', 'email_verify', 'mfa_challenge')),
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO user_tokens_new (id, user_id, purpose, token_hash, expires_at, used_at, created_at)
+    SELECT id, user_id, purpose, token_hash, expires_at, used_at, created_at FROM user_tokens;
+DROP TABLE user_tokens;
+ALTER TABLE user_tokens_new RENAME TO user_tokens;
+
+CREATE INDEX idx_user_tokens_user ON user_tokens (user_id, purpose);
+
+-- Businesses can require two-factor authentication of all their staff
+ALTER TABLE businesses ADD COLUMN require_two_factor BOOLEAN NOT NULL DEFAULT FALSE;
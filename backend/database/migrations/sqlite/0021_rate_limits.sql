@@ -0,0 +1,20 @@
+-- Token buckets of the database rate limit store (--rate-limit=database),
+-- shared by all instances. bucket is e.g. "login:ip:203.0.113.7".
+CREATE TABLE rate_limits (
+    bucket VARCHAR(255) PRIMARY KEY,
+    tokens REAL NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- Failed logins in a row per account and client IP, so that guessing
+-- from one address can't lock the owner out everywhere else, and per
+-- account from all IPs (ip is ''). Too many lock the account for that IP,
+-- or for every IP, until locked_until.
+CREATE TABLE login_failures (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip VARCHAR(45) NOT NULL,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, ip)
+);
@@ -0,0 +1,70 @@
+-- Public bookings and waitlist entries keep the contact details they were
+-- made with instead of being attached to whichever account has that email.
+-- customer_id links them to an account once its owner has verified the
+-- email. SQLite can't drop NOT NULL, so both tables are rebuilt (migrations
+-- run with foreign keys off, so dropping them doesn't cascade).
+CREATE TABLE bookings_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    customer_name VARCHAR(255) NOT NULL DEFAULT '',
+    customer_email VARCHAR(255) NOT NULL DEFAULT '',
+    customer_phone VARCHAR(50),
+    slot_id INTEGER NOT NULL REFERENCES appointment_slots(id) ON DELETE CASCADE,
+    status VARCHAR(50) NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'completed', 'cancelled', 'no-show')),
+    notes TEXT,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    manage_token VARCHAR(64),
+    cancelled_at TIMESTAMP,
+    reschedule_count INTEGER NOT NULL DEFAULT 0,
+    rescheduled_at TIMESTAMP,
+    fee_cents INTEGER NOT NULL DEFAULT 0,
+    fee_rule VARCHAR(30),
+    seats INTEGER NOT NULL DEFAULT 1,
+    ends_at TIMESTAMP,
+    location_id INTEGER REFERENCES locations(id)
+);
+INSERT INTO bookings_new (id, customer_id, customer_name, customer_email, customer_phone, slot_id, status, notes,
+        business_id, created_at, manage_token, cancelled_at, reschedule_count, rescheduled_at, fee_cents, fee_rule,
+        seats, ends_at, location_id)
+    SELECT b.id, b.customer_id, u.full_name, u.email, u.phone, b.slot_id, b.status, b.notes,
+        b.business_id, b.created_at, b.manage_token, b.cancelled_at, b.reschedule_count, b.rescheduled_at, b.fee_cents, b.fee_rule,
+        b.seats, b.ends_at, b.location_id
+    FROM bookings b JOIN users u ON b.customer_id = u.id;
+DROP TABLE bookings;
+ALTER TABLE bookings_new RENAME TO bookings;
+
+CREATE INDEX idx_bookings_business ON bookings (business_id);
+CREATE UNIQUE INDEX idx_bookings_manage_token ON bookings (manage_token);
+CREATE INDEX idx_bookings_slot ON bookings (slot_id);
+CREATE INDEX idx_bookings_unlinked_email ON bookings (customer_email) WHERE customer_id IS NULL;
+
+CREATE TABLE waitlist_entries_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    business_id INTEGER NOT NULL REFERENCES businesses(id) ON DELETE CASCADE,
+    service_id INTEGER NOT NULL REFERENCES services(id) ON DELETE CASCADE,
+    customer_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    customer_name VARCHAR(255) NOT NULL DEFAULT '',
+    customer_email VARCHAR(255) NOT NULL DEFAULT '',
+    customer_phone VARCHAR(50),
+    window_start TIMESTAMP NOT NULL,
+    window_end TIMESTAMP NOT NULL,
+    notes TEXT,
+    token VARCHAR(64) NOT NULL UNIQUE,
+    status VARCHAR(20) NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'offered', 'booked', 'expired', 'left')),
+    offered_slot_id INTEGER REFERENCES appointment_slots(id) ON DELETE SET NULL,
+    offered_at TIMESTAMP,
+    offer_expires_at TIMESTAMP,
+    booking_id INTEGER REFERENCES bookings(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO waitlist_entries_new (id, business_id, service_id, customer_id, customer_name, customer_email, customer_phone,
+        window_start, window_end, notes, token, status, offered_slot_id, offered_at, offer_expires_at, booking_id, created_at)
+    SELECT w.id, w.business_id, w.service_id, w.customer_id, u.full_name, u.email, u.phone,
+        w.window_start, w.window_end, w.notes, w.token, w.status, w.offered_slot_id, w.offered_at, w.offer_expires_at, w.booking_id, w.created_at
+    FROM waitlist_entries w JOIN users u ON w.customer_id = u.id;
+DROP TABLE waitlist_entries;
+ALTER TABLE waitlist_entries_new RENAME TO waitlist_entries;
+
+CREATE INDEX idx_waitlist_waiting ON waitlist_entries (business_id, service_id, status, created_at);
+CREATE INDEX idx_waitlist_offers ON waitlist_entries (status, offer_expires_at);
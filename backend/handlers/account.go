@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/mailer"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	emailVerifyTTL   = 48 * time.Hour
+)
+
+// AccountOptions configures the account email flows
+type AccountOptions struct {
+	Mailer               mailer.Mailer
+	AppURL               string // base URL of the frontend, used for links in emails
+	RequireVerifiedEmail bool   // refuse to log in until the email is verified
+}
+
+// ForgotPassword emails a password reset link. It answers the same way,
+// and as fast, whether or not the address exists, so it can't be used to
+// find accounts: the lookup and the email happen after the response.
+func ForgotPassword(db *database.Store, opts AccountOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var forgotReq models.ForgotPasswordRequest
+		if err := c.ShouldBindJSON(&forgotReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		go sendPasswordReset(db, opts, forgotReq.Email)
+
+		c.JSON(http.StatusOK, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+	}
+}
+
+// sendPasswordReset emails a reset link if email belongs to an active
+// account. Errors are only logged; nobody is waiting for them.
+func sendPasswordReset(db *database.Store, opts AccountOptions, email string) {
+	var userID int
+	var isActive bool
+	err := db.QueryRow("SELECT id, is_active FROM users WHERE email = $1", email).Scan(&userID, &isActive)
+	if err == sql.ErrNoRows || (err == nil && !isActive) {
+		return
+	}
+	if err != nil {
+		log.Printf("password reset for %s: %v", email, err)
+		return
+	}
+
+	token, err := auth.CreateUserToken(db, userID, auth.PurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		log.Printf("password reset for %s: could not create token: %v", email, err)
+		return
+	}
+
+	link := opts.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	err = opts.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Text: fmt.Sprintf("Someone asked to reset the password for your account.\n\n"+
+			"Open this link to choose a new password (valid for %d minutes):\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.\n", int(passwordResetTTL.Minutes()), link),
+	})
+	if err != nil {
+		log.Printf("password reset email to %s failed: %v", email, err)
+	}
+}
+
+// ResetPassword sets a new password using a reset token and logs the user
+// out everywhere
+func ResetPassword(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var resetReq models.ResetPasswordRequest
+		if err := c.ShouldBindJSON(&resetReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(resetReq.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not hash password"))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		userID, err := auth.ConsumeUserToken(tx, auth.PurposePasswordReset, resetReq.Token)
+		if err == auth.ErrInvalidUserToken {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid or expired reset token"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+
+		// The reset link proves the user can read mail at this address
+		_, err = tx.Exec(
+			"UPDATE users SET password_hash = $1, email_verified_at = COALESCE(email_verified_at, $2) WHERE id = $3",
+			string(hashedPassword), time.Now(), userID,
+		)
+		if err == nil {
+			err = linkVerifiedCustomer(tx, userID)
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not update password"))
+			return
+		}
+		if err := auth.RevokeUserSessions(tx, userID, 0); err != nil {
+			c.Error(apierror.Internal(err, "Could not revoke sessions"))
+			return
+		}
+		// and unlocks the account if someone was guessing the old one
+		if err := auth.UnlockAccount(tx, userID); err != nil {
+			c.Error(apierror.Internal(err, "Could not update password"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in"})
+	}
+}
+
+// VerifyEmail marks a user's email address as verified
+func VerifyEmail(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var verifyReq models.VerifyEmailRequest
+		if err := c.ShouldBindJSON(&verifyReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		userID, err := auth.ConsumeUserToken(tx, auth.PurposeEmailVerify, verifyReq.Token)
+		if err == auth.ErrInvalidUserToken {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid or expired verification token"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+
+		_, err = tx.Exec(
+			"UPDATE users SET email_verified_at = COALESCE(email_verified_at, $1) WHERE id = $2",
+			time.Now(), userID,
+		)
+		if err == nil {
+			err = linkVerifiedCustomer(tx, userID)
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not verify email"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+	}
+}
+
+// ResendVerification sends a new verification email to the current user
+func ResendVerification(db *database.Store, opts AccountOptions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+		currentUser := user.(models.User)
+
+		var verifiedAt sql.NullTime
+		err := db.QueryRow("SELECT email_verified_at FROM users WHERE id = $1", currentUser.ID).Scan(&verifiedAt)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+		if verifiedAt.Valid {
+			c.Error(apierror.New(http.StatusConflict, "Email is already verified"))
+			return
+		}
+
+		if err := sendVerificationEmail(db, opts, currentUser.ID, currentUser.Email); err != nil {
+			c.Error(apierror.Internal(err, "Could not send verification email"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+	}
+}
+
+// sendVerificationEmail creates a verification token and emails the link
+func sendVerificationEmail(q database.Querier, opts AccountOptions, userID int, email string) error {
+	token, err := auth.CreateUserToken(q, userID, auth.PurposeEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	link := opts.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+	return opts.Mailer.Send(mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Welcome! Please confirm your email address by opening this link:\n%s\n\n"+
+			"The link is valid for %d hours.\n", link, int(emailVerifyTTL.Hours())),
+	})
+}
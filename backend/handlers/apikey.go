@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const apiKeySelect = "SELECT id, name, prefix, scopes, created_by, created_at, last_used_at, revoked_at FROM api_keys"
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var apiKey models.APIKey
+	var scopes string
+	var createdBy sql.NullInt64
+	var lastUsedAt, revokedAt sql.NullTime
+	err := row.Scan(&apiKey.ID, &apiKey.Name, &apiKey.Prefix, &scopes, &createdBy, &apiKey.CreatedAt, &lastUsedAt, &revokedAt)
+	apiKey.Scopes = auth.ParseScopes(scopes)
+	apiKey.CreatedBy = nullIntPtr(createdBy)
+	if lastUsedAt.Valid {
+		apiKey.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		apiKey.RevokedAt = &revokedAt.Time
+	}
+	return apiKey, err
+}
+
+// CreateAPIKey issues a key for the admin's business. The response
+// includes the key itself, which isn't shown again.
+func CreateAPIKey(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		// 1. Bind and validate the request data
+		var keyReq models.CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&keyReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+		for _, s := range keyReq.Scopes {
+			if !auth.ValidScope(s) {
+				c.Error(apierror.New(http.StatusBadRequest, "Unknown scope "+strconv.Quote(s)+", expected one of "+strings.Join(auth.Scopes, ", ")))
+				return
+			}
+		}
+
+		// 2. Create the key; only its hash is stored
+		key, hash, prefix, err := auth.NewAPIKey()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create API key"))
+			return
+		}
+		var keyID int
+		err = db.QueryRow(
+			`INSERT INTO api_keys (business_id, name, prefix, key_hash, scopes, created_by, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+			businessID, keyReq.Name, prefix, hash, strings.Join(keyReq.Scopes, ","), currentUser.ID, time.Now(),
+		).Scan(&keyID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create API key"))
+			return
+		}
+
+		apiKey, err := scanAPIKey(db.QueryRow(apiKeySelect+" WHERE id = $1", keyID))
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load API key"))
+			return
+		}
+		apiKey.Key = key
+
+		c.JSON(http.StatusCreated, apiKey)
+	}
+}
+
+// GetAPIKeys lists the API keys of the admin's business, revoked ones
+// included
+func GetAPIKeys(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		rows, err := db.Query(apiKeySelect+" WHERE business_id = $1 ORDER BY id", businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch API keys"))
+			return
+		}
+		defer rows.Close()
+
+		apiKeys := []models.APIKey{}
+		for rows.Next() {
+			apiKey, err := scanAPIKey(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading API keys"))
+				return
+			}
+			apiKeys = append(apiKeys, apiKey)
+		}
+
+		c.JSON(http.StatusOK, apiKeys)
+	}
+}
+
+// RevokeAPIKey stops a key from working. The key stays in the list (and
+// in booking histories) as revoked.
+func RevokeAPIKey(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		keyID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid API key ID"))
+			return
+		}
+
+		result, err := db.Exec(
+			"UPDATE api_keys SET revoked_at = $1 WHERE id = $2 AND business_id = $3 AND revoked_at IS NULL",
+			time.Now(), keyID, businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not revoke API key"))
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			c.Error(apierror.New(http.StatusNotFound, "API key not found or already revoked"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+	}
+}
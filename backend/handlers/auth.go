@@ -2,87 +2,132 @@ package handlers
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 	"time"
 
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
 	"booking-backend/models"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Secret key for JWT (use environment variable in production!)
-var jwtSecret = []byte("gtm") // Change this to a random string!
-
 // Login handles user authentication
-func Login(db *sql.DB) gin.HandlerFunc {
+func Login(db *database.Store, opts AccountOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Bind JSON input to LoginRequest struct
 		var loginReq models.LoginRequest
 		if err := c.ShouldBindJSON(&loginReq); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid input"))
 			return
 		}
 
 		// 2. Find user by email
 		var user models.User
-		query := `SELECT id, email, password_hash, full_name, role, business_id FROM users WHERE email = $1`
+		var verifiedAt sql.NullTime
+		query := `SELECT id, email, password_hash, full_name, role, business_id, is_active, email_verified_at FROM users WHERE email = $1`
 		err := db.QueryRow(query, loginReq.Email).Scan(
-			&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.Role, &user.BusinessID,
+			&user.ID, &user.Email, &user.PasswordHash, &user.FullName, &user.Role, &user.BusinessID, &user.IsActive, &verifiedAt,
 		)
+		user.EmailVerified = verifiedAt.Valid
 
+		if err == sql.ErrNoRows {
+			// Take as long as a wrong password so response times don't
+			// tell which emails have an account
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(loginReq.Password))
+			c.Error(apierror.New(http.StatusUnauthorized, "Invalid email or password"))
+			return
+		}
 		if err != nil {
-			if err == sql.ErrNoRows {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-			}
+			c.Error(apierror.Internal(err, "Database error"))
 			return
 		}
 
-		// 3. Check password
+		// 3. Check the password, counting wrong ones towards a lockout of
+		// this account from this IP. While locked every password is
+		// refused the same way, so the lockout doesn't tell a guesser
+		// anything.
+		now := time.Now()
+		ip := c.ClientIP()
+		lockedUntil, err := auth.LockedUntil(db, user.ID, ip, now)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
 		err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginReq.Password))
+		if !lockedUntil.IsZero() {
+			c.Error(apierror.New(http.StatusUnauthorized, "Invalid email or password"))
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			if err := auth.RecordFailedLogin(db, user.ID, ip, now); err != nil {
+				c.Error(apierror.Internal(err, "Database error"))
+				return
+			}
+			c.Error(apierror.New(http.StatusUnauthorized, "Invalid email or password"))
 			return
 		}
 
-		var businessIDValue int
-		if user.BusinessID != nil {
-			businessIDValue = *user.BusinessID
-		} else {
-			businessIDValue = 0 // or -1, or some value that means "no business"
+		if !user.IsActive {
+			c.Error(apierror.New(http.StatusForbidden, "Account is deactivated"))
+			return
+		}
+		if opts.RequireVerifiedEmail && !user.EmailVerified {
+			c.Error(apierror.New(http.StatusForbidden, "Please verify your email address before logging in"))
+			return
 		}
-		// 4. Create JWT token
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id":     user.ID,
-			"email":       user.Email,
-			"role":        user.Role,
-			"business_id": businessIDValue, // ← Use the concrete value
-			"exp":         time.Now().Add(time.Hour * 24).Unix(),
-		})
 
-		tokenString, err := token.SignedString(jwtSecret)
+		// 4. Start a session, or ask for the second factor first
+		response, err := finishLogin(db, user, ip)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			c.Error(apierror.Internal(err, "Could not generate token"))
 			return
 		}
 
 		// 5. Return success response
-		c.JSON(http.StatusOK, models.LoginResponse{
-			Message: "Login successful",
-			Token:   tokenString,
-			User:    user,
-		})
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// dummyPasswordHash is compared against for unknown emails
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+// accountLocked is the error for 2FA codes sent while the account is locked
+// for the client's IP by auth.RecordFailedLogin
+func accountLocked(until, now time.Time) *apierror.Error {
+	return apierror.New(http.StatusTooManyRequests, "Too many failed logins, please try again later").
+		WithCode(apierror.CodeAccountLocked).
+		WithRetryAfter(until.Sub(now))
+}
+
+// startSession creates a server-side session for user and returns an
+// access token bound to it plus the session's first refresh token
+func startSession(q database.Querier, user models.User) (models.TokenResponse, error) {
+	sessionID, refreshToken, err := auth.CreateSession(q, user.ID)
+	if err != nil {
+		return models.TokenResponse{}, err
+	}
+
+	accessToken, err := auth.IssueAccessToken(user, sessionID)
+	if err != nil {
+		return models.TokenResponse{}, err
 	}
+
+	return models.TokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+	}, nil
 }
 
 func ProtectedProfile(c *gin.Context) {
 	// Get the user from the context (set by the middleware)
 	user, exists := c.Get("user")
 	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found in context"})
+		c.Error(apierror.New(http.StatusInternalServerError, "User not found in context"))
 		return
 	}
 
@@ -95,20 +140,21 @@ func ProtectedProfile(c *gin.Context) {
 	})
 }
 
-// Register handles business registration
-func Register(db *sql.DB) gin.HandlerFunc {
+// Register handles business registration. A verification email is sent to
+// the new admin.
+func Register(db *database.Store, opts AccountOptions) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Bind JSON input to RegistrationRequest struct
 		var regReq models.RegistrationRequest
 		if err := c.ShouldBindJSON(&regReq); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+			c.Error(apierror.Validation(err))
 			return
 		}
 
 		// Start a database transaction
 		tx, err := db.Begin()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start transaction"})
+			c.Error(apierror.Internal(err, "Could not start transaction"))
 			return
 		}
 		defer tx.Rollback() // This will be a no-op if tx.Commit() is successful
@@ -117,25 +163,39 @@ func Register(db *sql.DB) gin.HandlerFunc {
 		var existingUser models.User
 		err = tx.QueryRow("SELECT id FROM users WHERE email = $1", regReq.Email).Scan(&existingUser.ID)
 		if err == nil {
-			c.JSON(http.StatusConflict, gin.H{"error": "Email already exists"})
+			c.Error(apierror.New(http.StatusConflict, "Email already exists").WithCode(apierror.CodeEmailTaken))
 			return
 		}
 
-		// 3. Create the business
+		// 3. Create the business, with a slug for its booking page
+		slug, err := uniqueSlug(tx, regReq.BusinessName)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create business"))
+			return
+		}
 		var businessID int
 		err = tx.QueryRow(
-			"INSERT INTO businesses (name) VALUES ($1) RETURNING id",
-			regReq.BusinessName,
+			"INSERT INTO businesses (name, slug) VALUES ($1, $2) RETURNING id",
+			regReq.BusinessName, slug,
 		).Scan(&businessID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create business"})
+			c.Error(apierror.Internal(err, "Could not create business"))
+			return
+		}
+		// Every business starts with one location; more can be added later
+		_, err = tx.Exec(
+			"INSERT INTO locations (business_id, name, timezone) VALUES ($1, $2, 'UTC')",
+			businessID, regReq.BusinessName,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create business"))
 			return
 		}
 
 		// 4. Hash the password
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(regReq.Password), bcrypt.DefaultCost)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+			c.Error(apierror.Internal(err, "Could not hash password"))
 			return
 		}
 
@@ -147,45 +207,48 @@ func Register(db *sql.DB) gin.HandlerFunc {
 			regReq.Email, string(hashedPassword), regReq.FullName, "business_admin", businessID,
 		).Scan(&userID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create user"})
+			c.Error(apierror.Internal(err, "Could not create user"))
 			return
 		}
 
-		// 6. Generate JWT token (same as login)
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-			"user_id":     userID,
-			"email":       regReq.Email,
-			"role":        "business_admin",
-			"business_id": businessID, // ← ADD THIS LINE
-			"exp":         time.Now().Add(time.Hour * 24).Unix(),
-		})
+		user := models.User{
+			ID:         userID,
+			Email:      regReq.Email,
+			FullName:   regReq.FullName,
+			Role:       "business_admin",
+			BusinessID: &businessID,
+			IsActive:   true,
+		}
 
-		tokenString, err := token.SignedString(jwtSecret)
+		// 6. Start a session (same as login)
+		tokens, err := startSession(tx, user)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			c.Error(apierror.Internal(err, "Could not generate token"))
 			return
 		}
 
 		// 7. Commit the transaction
 		if err := tx.Commit(); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Transaction failed"})
+			c.Error(apierror.Internal(err, "Transaction failed"))
 			return
 		}
 
-		// 8. Return success response
+		// 8. Send the verification email (registration succeeds even if this fails)
+		if err := sendVerificationEmail(db, opts, userID, regReq.Email); err != nil {
+			log.Printf("verification email to %s failed: %v", regReq.Email, err)
+		}
+
+		// 9. Return success response
 		c.JSON(http.StatusCreated, models.RegistrationResponse{
-			Message: "Registration successful",
-			Token:   tokenString,
-			User: models.User{
-				ID:         userID,
-				Email:      regReq.Email,
-				FullName:   regReq.FullName,
-				Role:       "business_admin",
-				BusinessID: &businessID,
-			},
+			Message:      "Registration successful",
+			Token:        tokens.Token,
+			RefreshToken: tokens.RefreshToken,
+			ExpiresIn:    tokens.ExpiresIn,
+			User:         user,
 			Business: models.Business{
 				ID:   businessID,
 				Name: regReq.BusinessName,
+				Slug: slug,
 			},
 		})
 	}
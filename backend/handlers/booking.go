@@ -0,0 +1,616 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/cancellation"
+	"booking-backend/database"
+	"booking-backend/models"
+	"booking-backend/notify"
+	"booking-backend/page"
+	"booking-backend/slots"
+	"booking-backend/waitlist"
+	"booking-backend/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bookingSelect is the common SELECT for reading bookings with their slot,
+// service and customer
+const bookingSelect = `
+	SELECT b.id, b.slot_id, s.service_id, sv.name, s.start_time, s.end_time, b.ends_at, b.status, b.notes,
+	       b.customer_id, b.customer_name, b.customer_email, b.customer_phone, b.business_id, b.location_id, b.seats, b.reschedule_count, b.fee_cents, b.fee_rule, b.created_at
+	FROM bookings b
+	JOIN appointment_slots s ON b.slot_id = s.id
+	JOIN services sv ON s.service_id = sv.id
+`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBooking(row rowScanner) (models.Booking, error) {
+	var booking models.Booking
+	var notes, phone, feeRule sql.NullString
+	var endsAt sql.NullTime
+	var locationID, customerID sql.NullInt64
+	err := row.Scan(
+		&booking.ID, &booking.SlotID, &booking.ServiceID, &booking.ServiceName, &booking.StartTime, &booking.EndTime, &endsAt,
+		&booking.Status, &notes, &customerID, &booking.CustomerName, &booking.CustomerEmail, &phone,
+		&booking.BusinessID, &locationID, &booking.Seats, &booking.RescheduleCount, &booking.FeeCents, &feeRule, &booking.CreatedAt,
+	)
+	booking.Notes = notes.String
+	booking.CustomerPhone = phone.String
+	booking.FeeRule = feeRule.String
+	booking.LocationID = nullIntPtr(locationID)
+	booking.CustomerID = nullIntPtr(customerID)
+	if endsAt.Valid {
+		// A multi-service booking runs on after its slot
+		booking.EndTime = endsAt.Time
+	}
+	return booking, err
+}
+
+// loadBookingServices adds the services of a multi-service booking
+func loadBookingServices(q database.Querier, booking *models.Booking) error {
+	plan, err := slots.LoadPlan(q, slots.Booking(booking.ID))
+	booking.Services = plan
+	return err
+}
+
+// bookingActor says who changed a booking, for its history
+type bookingActor struct {
+	kind     string // customer or business
+	userID   *int
+	apiKeyID *int // the business's integration, instead of a user
+}
+
+var customerActor = bookingActor{kind: "customer"}
+
+// businessActor is the signed-in staff member or admin, or the API key
+// the request was made with
+func businessActor(user models.User) bookingActor {
+	if user.APIKeyID != nil {
+		return bookingActor{kind: "business", apiKeyID: user.APIKeyID}
+	}
+	return bookingActor{kind: "business", userID: &user.ID}
+}
+
+// recordBookingEvent adds an entry to a booking's history. from and to are
+// the slots the booking moved between, when that applies.
+func recordBookingEvent(tx *database.Tx, bookingID int, event string, actor bookingActor, from, to *models.TimeSlot) error {
+	var fromID, toID, fromStart, toStart interface{}
+	if from != nil {
+		fromID, fromStart = from.ID, from.StartTime
+	}
+	if to != nil {
+		toID, toStart = to.ID, to.StartTime
+	}
+	_, err := tx.Exec(
+		`INSERT INTO booking_events (booking_id, event, from_slot_id, to_slot_id, from_start, to_start, actor, user_id, api_key_id, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		bookingID, event, fromID, toID, fromStart, toStart, actor.kind, actor.userID, actor.apiKeyID, time.Now(),
+	)
+	return err
+}
+
+// CreatePublicBooking lets a customer book a slot they are holding
+func CreatePublicBooking(db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. Bind and validate the request data
+		var bookingReq models.CreateBookingRequest
+		if err := c.ShouldBindJSON(&bookingReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		// 2. Find the customer's hold. The held seats (and the time for any
+		// following services) were taken when it was made, so nobody else
+		// can have them.
+		var holdID, seats int
+		err = tx.QueryRow(
+			`SELECT h.id, h.seats FROM slot_holds h
+			 JOIN appointment_slots s ON h.slot_id = s.id
+			 WHERE h.slot_id = $1 AND h.token = $2 AND h.expires_at > $3 AND s.business_id = $4
+			 FOR UPDATE OF h`,
+			bookingReq.SlotID, bookingReq.HoldToken, time.Now(), bookingReq.BusinessID,
+		).Scan(&holdID, &seats)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusConflict, "Your hold on this slot has expired, please pick a slot again").WithCode(apierror.CodeHoldExpired))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not reserve slot"))
+			return
+		}
+
+		// 3. Create the booking with the contact details given and use up
+		// the hold
+		customer := contact{bookingReq.CustomerName, bookingReq.CustomerEmail, bookingReq.CustomerPhone}
+		bookingID, manageToken, err := insertBooking(tx, customer, bookingReq.SlotID, seats, bookingReq.Notes, bookingReq.BusinessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create booking"))
+			return
+		}
+		if err := slots.Transfer(tx, holdID, bookingID); err != nil {
+			c.Error(apierror.Internal(err, "Could not create booking"))
+			return
+		}
+		result, err := tx.Exec("DELETE FROM slot_holds WHERE id = $1", holdID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create booking"))
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			c.Error(apierror.New(http.StatusConflict, "Your hold on this slot has expired, please pick a slot again").WithCode(apierror.CodeHoldExpired))
+			return
+		}
+
+		booking, err := scanBooking(tx.QueryRow(bookingSelect+" WHERE b.id = $1", bookingID))
+		if err == nil {
+			err = loadBookingServices(tx, &booking)
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load booking"))
+			return
+		}
+		slot := models.TimeSlot{ID: booking.SlotID, StartTime: booking.StartTime}
+		if err := recordBookingEvent(tx, bookingID, "created", customerActor, nil, &slot); err != nil {
+			c.Error(apierror.Internal(err, "Could not create booking"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		// 4. Queue the confirmation, the business alert and webhooks
+		outbox.Notify(notify.EventBookingCreated, bookingID)
+		hooks.Publish(booking.BusinessID, webhook.EventBookingCreated, booking)
+
+		c.JSON(http.StatusCreated, models.PublicBookingResponse{
+			Message:     "Booking confirmed",
+			Booking:     booking,
+			ManageToken: manageToken,
+		})
+	}
+}
+
+// contact is who a public booking or waitlist entry is for. It is kept on
+// the row rather than on an account: the request isn't authenticated, so
+// it mustn't change (or add bookings to) whichever account has the email.
+// linkVerifiedCustomer attaches the rows once the email is verified.
+type contact struct {
+	name, email, phone string
+}
+
+// insertBooking creates a scheduled booking for seats the caller has
+// already claimed and returns its ID and manage token
+func insertBooking(tx *database.Tx, customer contact, slotID, seats int, notes string, businessID int) (int, string, error) {
+	manageToken, _, err := auth.NewOpaqueToken()
+	if err != nil {
+		return 0, "", err
+	}
+	var bookingID int
+	err = tx.QueryRow(
+		`INSERT INTO bookings (customer_name, customer_email, customer_phone, slot_id, seats, status, notes, business_id, manage_token, location_id, created_at)
+		 VALUES ($1, $2, $3, $4, $5, 'scheduled', $6, $7, $8, (SELECT location_id FROM appointment_slots WHERE id = $4), $9) RETURNING id`,
+		customer.name, customer.email, customer.phone, slotID, seats, notes, businessID, manageToken, time.Now(),
+	).Scan(&bookingID)
+	return bookingID, manageToken, err
+}
+
+// linkVerifiedCustomer attaches the bookings and waitlist entries made
+// with a user's email to their account, once they have proven they read
+// mail at that address
+func linkVerifiedCustomer(q database.Querier, userID int) error {
+	var email string
+	if err := q.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		return err
+	}
+	for _, table := range []string{"bookings", "waitlist_entries"} {
+		_, err := q.Exec(
+			"UPDATE "+table+" SET customer_id = $1 WHERE customer_id IS NULL AND LOWER(customer_email) = LOWER($2)",
+			userID, email,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetPublicBooking shows a booking to the customer holding its manage token
+func GetPublicBooking(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		booking, err := scanBooking(db.QueryRow(bookingSelect+" WHERE b.manage_token = $1", c.Param("token")))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.Error(apierror.New(http.StatusNotFound, "Booking not found"))
+			} else {
+				c.Error(apierror.Internal(err, "Could not fetch booking"))
+			}
+			return
+		}
+		if err := loadBookingServices(db, &booking); err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch booking"))
+			return
+		}
+
+		c.JSON(http.StatusOK, booking)
+	}
+}
+
+// CancelPublicBooking lets a customer cancel their own upcoming booking
+func CancelPublicBooking(db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher, wl *waitlist.Waitlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var bookingID, businessID int
+		var startTime time.Time
+		err := db.QueryRow(
+			`SELECT b.id, b.business_id, s.start_time FROM bookings b
+			 JOIN appointment_slots s ON b.slot_id = s.id
+			 WHERE b.manage_token = $1`,
+			c.Param("token"),
+		).Scan(&bookingID, &businessID, &startTime)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.Error(apierror.New(http.StatusNotFound, "Booking not found"))
+			} else {
+				c.Error(apierror.Internal(err, "Could not fetch booking"))
+			}
+			return
+		}
+		if !startTime.After(time.Now()) {
+			c.Error(apierror.New(http.StatusConflict, "Past bookings can't be cancelled"))
+			return
+		}
+
+		cancelAndRespond(c, db, outbox, hooks, wl, bookingID, businessID, customerActor)
+	}
+}
+
+// bookingSortKeys are the orders the business's booking list can be
+// sorted in
+var bookingSortKeys = map[string]page.Key{
+	"start_time": {Column: "s.start_time", Kind: page.Time},
+	"created_at": {Column: "b.created_at", Kind: page.Time},
+	"id":         {Column: "b.id", Kind: page.Int},
+}
+
+// GetBookings lists a page of the bookings of the admin's business, sorted
+// by ?sort=start_time (default), created_at or id. ?status=, ?service_id=
+// and ?from=/?to= (on the start time) filter it.
+func GetBookings(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		filter, args, ok := locationFilter(c, "b.location_id", scope, []interface{}{businessID})
+		if !ok {
+			return
+		}
+		if status := c.Query("status"); status != "" {
+			args = append(args, status)
+			filter += fmt.Sprintf(" AND b.status = $%d", len(args))
+		}
+		more, args, ok := intFilter(c, "service_id", "s.service_id", args)
+		if !ok {
+			return
+		}
+		filter += more
+		loc, _ := businessLocation(db, businessID)
+		more, args, ok = timeRangeFilter(c, "s.start_time", loc, args)
+		if !ok {
+			return
+		}
+		filter += more
+
+		req, ok := pageRequest(c, bookingSortKeys, "start_time", "b.id")
+		if !ok {
+			return
+		}
+		var total int
+		err := db.QueryRow(
+			"SELECT COUNT(*) FROM bookings b JOIN appointment_slots s ON b.slot_id = s.id WHERE b.business_id = $1"+filter,
+			args...,
+		).Scan(&total)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch bookings"))
+			return
+		}
+		after, args, err := req.Where(args)
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		rows, err := db.Query(bookingSelect+" WHERE b.business_id = $1"+filter+after+req.OrderBy(), args...)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch bookings"))
+			return
+		}
+		defer rows.Close()
+
+		result := models.Page{Total: total}
+		bookings := []models.Booking{}
+		for rows.Next() {
+			booking, err := scanBooking(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading bookings"))
+				return
+			}
+			if len(bookings) == req.Limit {
+				last := bookings[len(bookings)-1]
+				result.NextCursor = req.Next(map[string]interface{}{
+					"start_time": last.StartTime, "created_at": last.CreatedAt, "id": last.ID,
+				}, last.ID)
+				break
+			}
+			bookings = append(bookings, booking)
+		}
+		result.Items = bookings
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// CancelBooking lets the business cancel one of its bookings
+func CancelBooking(db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher, wl *waitlist.Waitlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		bookingID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid booking ID"))
+			return
+		}
+
+		if !bookingInScope(c, db, currentUser, bookingID) {
+			return
+		}
+
+		cancelAndRespond(c, db, outbox, hooks, wl, bookingID, businessID, businessActor(currentUser))
+	}
+}
+
+// cancelAndRespond cancels a scheduled booking, frees its slot, applies the
+// cancellation policy and queues the cancellation notifications and
+// webhooks. The freed slot is offered to the waitlist.
+func cancelAndRespond(c *gin.Context, db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher, wl *waitlist.Waitlist, bookingID, businessID int, actor bookingActor) {
+	tx, err := db.Begin()
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var slotID, seats int
+	err = tx.QueryRow(
+		`UPDATE bookings SET status = 'cancelled', cancelled_at = $1
+		 WHERE id = $2 AND business_id = $3 AND status = 'scheduled'
+		 RETURNING slot_id, seats`,
+		now, bookingID, businessID,
+	).Scan(&slotID, &seats)
+	if err == sql.ErrNoRows {
+		c.Error(apierror.New(http.StatusNotFound, "Booking not found or not cancellable"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not cancel booking"))
+		return
+	}
+
+	// Free the seats, and the time held for any following services, for
+	// other customers
+	if err := slots.Release(tx, slotID, seats); err != nil {
+		c.Error(apierror.Internal(err, "Could not release slot"))
+		return
+	}
+	blocked, err := slots.ReleaseBlocks(tx, slots.Booking(bookingID))
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not release slot"))
+		return
+	}
+
+	// Work out and record what the cancellation costs
+	policy, price, start, err := loadCancellationTerms(tx, bookingID)
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not cancel booking"))
+		return
+	}
+	outcome := cancellation.Cancel(policy, actor.kind == "business", start, now, price)
+	if err := recordFee(tx, bookingID, outcome); err != nil {
+		c.Error(apierror.Internal(err, "Could not cancel booking"))
+		return
+	}
+
+	booking, err := scanBooking(tx.QueryRow(bookingSelect+" WHERE b.id = $1", bookingID))
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not load booking"))
+		return
+	}
+	slot := models.TimeSlot{ID: slotID, StartTime: booking.StartTime}
+	if err := recordBookingEvent(tx, bookingID, "cancelled", actor, &slot, nil); err != nil {
+		c.Error(apierror.Internal(err, "Could not cancel booking"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.Error(apierror.Internal(err, "Transaction failed"))
+		return
+	}
+
+	outbox.Notify(notify.EventBookingCancelled, bookingID)
+	hooks.Publish(businessID, webhook.EventBookingCancelled, booking)
+	wl.SlotFreed(slotID)
+	for _, id := range blocked {
+		wl.SlotFreed(id)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Booking cancelled",
+		"booking": booking,
+		"outcome": outcome,
+	})
+}
+
+// loadCancellationTerms reads the policy of a booking's business, its
+// price (the price of its services for each seat) and its start time
+func loadCancellationTerms(q database.Querier, bookingID int) (models.CancellationPolicy, int, time.Time, error) {
+	var policy models.CancellationPolicy
+	var price int
+	var start time.Time
+	err := q.QueryRow(
+		`SELECT bz.cancel_free_hours, bz.late_cancel_fee_percent, bz.no_show_fee_percent,
+		        (sv.price_cents + COALESCE((
+		            SELECT SUM(bsv.price_cents) FROM booking_services bs
+		            JOIN services bsv ON bs.service_id = bsv.id
+		            WHERE bs.booking_id = b.id AND bs.position > 0
+		        ), 0)) * b.seats,
+		        s.start_time
+		 FROM bookings b
+		 JOIN appointment_slots s ON b.slot_id = s.id
+		 JOIN services sv ON s.service_id = sv.id
+		 JOIN businesses bz ON b.business_id = bz.id
+		 WHERE b.id = $1`,
+		bookingID,
+	).Scan(&policy.FreeHours, &policy.LateFeePercent, &policy.NoShowFeePercent, &price, &start)
+	return policy, price, start, err
+}
+
+// recordFee stores the fee a cancellation or no-show owes on the booking
+func recordFee(tx *database.Tx, bookingID int, outcome models.CancellationOutcome) error {
+	_, err := tx.Exec("UPDATE bookings SET fee_cents = $1, fee_rule = $2 WHERE id = $3", outcome.FeeCents, outcome.Rule, bookingID)
+	return err
+}
+
+// MarkNoShow records that the customer didn't turn up and applies the
+// no-show fee of the cancellation policy. Only bookings that have started
+// can be marked.
+func MarkNoShow(db *database.Store, hooks *webhook.Publisher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		bookingID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid booking ID"))
+			return
+		}
+		if !bookingInScope(c, db, currentUser, bookingID) {
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		// 1. Mark the booking, if it is scheduled and has started
+		now := time.Now()
+		var slotID int
+		err = tx.QueryRow(
+			`UPDATE bookings SET status = 'no-show'
+			 WHERE id = $1 AND business_id = $2 AND status = 'scheduled'
+			 AND slot_id IN (SELECT id FROM appointment_slots WHERE start_time <= $3)
+			 RETURNING slot_id`,
+			bookingID, businessID, now,
+		).Scan(&slotID)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Booking not found or not started yet"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not update booking"))
+			return
+		}
+
+		// 2. Apply the no-show fee
+		policy, price, start, err := loadCancellationTerms(tx, bookingID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not update booking"))
+			return
+		}
+		outcome := cancellation.NoShow(policy, price)
+		if err := recordFee(tx, bookingID, outcome); err != nil {
+			c.Error(apierror.Internal(err, "Could not update booking"))
+			return
+		}
+		slot := models.TimeSlot{ID: slotID, StartTime: start}
+		if err := recordBookingEvent(tx, bookingID, "no-show", businessActor(currentUser), &slot, nil); err != nil {
+			c.Error(apierror.Internal(err, "Could not update booking"))
+			return
+		}
+
+		booking, err := scanBooking(tx.QueryRow(bookingSelect+" WHERE b.id = $1", bookingID))
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load booking"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		hooks.Publish(businessID, webhook.EventBookingNoShow, booking)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Booking marked as no-show",
+			"booking": booking,
+			"outcome": outcome,
+		})
+	}
+}
@@ -0,0 +1,498 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/cancellation"
+	"booking-backend/database"
+	"booking-backend/hours"
+	"booking-backend/models"
+	"booking-backend/reminder"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxRescheduleCutoff is the longest reschedule cutoff, 30 days in minutes
+const maxRescheduleCutoff = 30 * 24 * 60
+
+// loadBusinessSettings reads the settings of a business
+func loadBusinessSettings(q database.Querier, businessID int) (models.BusinessSettings, error) {
+	var settings models.BusinessSettings
+	var offsets string
+	err := q.QueryRow(
+		`SELECT timezone, reminder_offsets, reschedule_cutoff_minutes, max_reschedules,
+		        cancel_free_hours, late_cancel_fee_percent, no_show_fee_percent, require_two_factor
+		 FROM businesses WHERE id = $1`,
+		businessID,
+	).Scan(&settings.Timezone, &offsets, &settings.RescheduleCutoff, &settings.MaxReschedules,
+		&settings.CancellationPolicy.FreeHours, &settings.CancellationPolicy.LateFeePercent, &settings.CancellationPolicy.NoShowFeePercent,
+		&settings.RequireTwoFactor)
+	if err != nil {
+		return settings, err
+	}
+	settings.CancellationText = cancellation.Text(settings.CancellationPolicy)
+	settings.ReminderOffsets, _ = reminder.ParseOffsets(offsets)
+	if settings.ReminderOffsets == nil {
+		settings.ReminderOffsets = []int{}
+	}
+	return settings, nil
+}
+
+// GetBusinessSettings returns the settings of the admin's business
+func GetBusinessSettings(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+
+		settings, err := loadBusinessSettings(db, *currentUser.BusinessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch settings"))
+			return
+		}
+
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// UpdateBusinessSettings changes the settings of the admin's business
+func UpdateBusinessSettings(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		// 1. Bind and validate the request data
+		var settingsReq models.UpdateBusinessSettingsRequest
+		if err := c.ShouldBindJSON(&settingsReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		// 2. Merge with the current settings
+		settings, err := loadBusinessSettings(db, businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch settings"))
+			return
+		}
+		if settingsReq.Timezone != nil {
+			if _, err := time.LoadLocation(*settingsReq.Timezone); err != nil || *settingsReq.Timezone == "" {
+				c.Error(apierror.New(http.StatusBadRequest, "Unknown timezone"))
+				return
+			}
+			settings.Timezone = *settingsReq.Timezone
+		}
+		if settingsReq.ReminderOffsets != nil {
+			if err := reminder.ValidateOffsets(*settingsReq.ReminderOffsets); err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+				return
+			}
+			settings.ReminderOffsets = *settingsReq.ReminderOffsets
+		}
+		if settingsReq.RescheduleCutoff != nil {
+			if *settingsReq.RescheduleCutoff < 0 || *settingsReq.RescheduleCutoff > maxRescheduleCutoff {
+				c.Error(apierror.New(http.StatusBadRequest, "reschedule_cutoff_minutes must be between 0 and 43200"))
+				return
+			}
+			settings.RescheduleCutoff = *settingsReq.RescheduleCutoff
+		}
+		if settingsReq.MaxReschedules != nil {
+			if *settingsReq.MaxReschedules < 0 || *settingsReq.MaxReschedules > 100 {
+				c.Error(apierror.New(http.StatusBadRequest, "max_reschedules must be between 0 and 100"))
+				return
+			}
+			settings.MaxReschedules = *settingsReq.MaxReschedules
+		}
+		if settingsReq.CancellationPolicy != nil {
+			if err := cancellation.Validate(*settingsReq.CancellationPolicy); err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+				return
+			}
+			settings.CancellationPolicy = *settingsReq.CancellationPolicy
+		}
+		requireTwoFactor := settingsReq.RequireTwoFactor != nil && *settingsReq.RequireTwoFactor && !settings.RequireTwoFactor
+		if requireTwoFactor {
+			// The admin would lock themselves out otherwise
+			state, err := auth.LoadTwoFactorState(db, currentUser.ID)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Could not fetch settings"))
+				return
+			}
+			if !state.Enabled {
+				c.Error(apierror.New(http.StatusConflict, "Turn on two-factor authentication for your own account first"))
+				return
+			}
+		}
+		if settingsReq.RequireTwoFactor != nil {
+			settings.RequireTwoFactor = *settingsReq.RequireTwoFactor
+		}
+
+		// 3. Save
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(
+			`UPDATE businesses SET timezone = $1, reminder_offsets = $2, reschedule_cutoff_minutes = $3, max_reschedules = $4,
+			 cancel_free_hours = $5, late_cancel_fee_percent = $6, no_show_fee_percent = $7, require_two_factor = $8
+			 WHERE id = $9`,
+			settings.Timezone, reminder.FormatOffsets(settings.ReminderOffsets),
+			settings.RescheduleCutoff, settings.MaxReschedules,
+			settings.CancellationPolicy.FreeHours, settings.CancellationPolicy.LateFeePercent, settings.CancellationPolicy.NoShowFeePercent,
+			settings.RequireTwoFactor, businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not save settings"))
+			return
+		}
+
+		// 4. Staff without two-factor authentication are logged out, and
+		// set it up when they log in again
+		if requireTwoFactor {
+			_, err = tx.Exec(
+				`UPDATE sessions SET revoked_at = $1
+				 WHERE revoked_at IS NULL AND user_id IN (
+				     SELECT id FROM users WHERE business_id = $2 AND totp_enabled_at IS NULL)`,
+				time.Now(), businessID,
+			)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Could not save settings"))
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		settings, err = loadBusinessSettings(db, businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch settings"))
+			return
+		}
+		c.JSON(http.StatusOK, settings)
+	}
+}
+
+// validSlug is a lowercase URL path segment: letters, digits and single
+// dashes between them
+var validSlug = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+const maxSlugLength = 64
+
+// slugify turns a business name into a slug, e.g. "Anna's Hair & Co" into
+// "anna-s-hair-co"
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimSuffix(b.String(), "-")
+	if len(slug) > maxSlugLength-8 {
+		// Leave room for the number uniqueSlug may add
+		slug = strings.TrimSuffix(slug[:maxSlugLength-8], "-")
+	}
+	if slug == "" {
+		slug = "business"
+	}
+	return slug
+}
+
+// uniqueSlug is the slug of a new business: the name's slug, numbered if
+// another business has it already
+func uniqueSlug(q database.Querier, name string) (string, error) {
+	base := slugify(name)
+	slug := base
+	for n := 2; ; n++ {
+		var found int
+		err := q.QueryRow("SELECT 1 FROM businesses WHERE slug = $1", slug).Scan(&found)
+		if err == sql.ErrNoRows {
+			return slug, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		slug = base + "-" + strconv.Itoa(n)
+	}
+}
+
+// publicBusinessID resolves the business of a public request: the :slug
+// path parameter, the business query parameter (a slug) or the older
+// numeric business_id. On error it answers the request and returns
+// ok == false.
+func publicBusinessID(c *gin.Context, db *database.Store) (int, bool) {
+	slug := c.Param("slug")
+	if slug == "" {
+		slug = c.Query("business")
+	}
+	if slug != "" {
+		var businessID int
+		err := db.QueryRow("SELECT id FROM businesses WHERE slug = $1", slug).Scan(&businessID)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Business not found"))
+			return 0, false
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch business"))
+			return 0, false
+		}
+		return businessID, true
+	}
+
+	value := c.Query("business_id")
+	if value == "" {
+		c.Error(apierror.New(http.StatusBadRequest, "business or business_id is required"))
+		return 0, false
+	}
+	businessID, err := strconv.Atoi(value)
+	if err != nil {
+		c.Error(apierror.New(http.StatusBadRequest, "Invalid business_id"))
+		return 0, false
+	}
+	return businessID, true
+}
+
+// loadBusinessProfile reads the profile of a business
+func loadBusinessProfile(q database.Querier, where string, arg interface{}) (models.BusinessProfile, error) {
+	var profile models.BusinessProfile
+	var slug, description, category, address, city, phone, email, website, logoURL, openingHours sql.NullString
+	err := q.QueryRow(
+		`SELECT id, slug, name, description, category, address, city, phone, email, website, logo_url, timezone, opening_hours
+		 FROM businesses WHERE `+where,
+		arg,
+	).Scan(&profile.ID, &slug, &profile.Name, &description, &category, &address, &city, &phone, &email, &website, &logoURL,
+		&profile.Timezone, &openingHours)
+	if err != nil {
+		return profile, err
+	}
+	profile.Slug = slug.String
+	profile.Description = description.String
+	profile.Category = category.String
+	profile.Address = address.String
+	profile.City = city.String
+	profile.Phone = phone.String
+	profile.Email = email.String
+	profile.Website = website.String
+	profile.LogoURL = logoURL.String
+	profile.OpeningHours, err = hours.Parse(openingHours.String)
+	return profile, err
+}
+
+// validHTTPURL accepts absolute http(s) URLs, for links the server doesn't
+// request itself
+func validHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// validateProfile checks an edited profile
+func validateProfile(profile models.BusinessProfile) error {
+	switch {
+	case strings.TrimSpace(profile.Name) == "":
+		return fmt.Errorf("name can't be empty")
+	case len(profile.Slug) > maxSlugLength || !validSlug.MatchString(profile.Slug):
+		return fmt.Errorf("slug must be up to %d lowercase letters, digits and dashes", maxSlugLength)
+	case len(profile.Description) > 5000:
+		return fmt.Errorf("description is longer than 5000 characters")
+	case len(profile.Category) > 64 || (profile.Category != "" && !validSlug.MatchString(profile.Category)):
+		return fmt.Errorf("category must be a lowercase keyword such as \"hair\" or \"yoga-studio\"")
+	case len(profile.City) > 128:
+		return fmt.Errorf("city is longer than 128 characters")
+	case profile.Email != "" && !strings.Contains(profile.Email, "@"):
+		return fmt.Errorf("invalid email")
+	case profile.Website != "" && !validHTTPURL(profile.Website):
+		return fmt.Errorf("website must be an http(s) URL")
+	case profile.LogoURL != "" && !validHTTPURL(profile.LogoURL):
+		return fmt.Errorf("logo_url must be an http(s) URL")
+	}
+	return hours.Validate(profile.OpeningHours)
+}
+
+// GetBusinessProfile returns the public profile of the admin's business
+func GetBusinessProfile(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+
+		profile, err := loadBusinessProfile(db, "id = $1", *currentUser.BusinessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch profile"))
+			return
+		}
+
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+// UpdateBusinessProfile changes the public profile of the admin's business.
+// Only admins of the whole business can change it.
+func UpdateBusinessProfile(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		if scope != nil {
+			c.Error(apierror.New(http.StatusForbidden, "Only admins of the whole business can edit its profile"))
+			return
+		}
+
+		// 1. Bind the request data
+		var profileReq models.UpdateBusinessProfileRequest
+		if err := c.ShouldBindJSON(&profileReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		// 2. Merge with the current profile and validate
+		profile, err := loadBusinessProfile(db, "id = $1", businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch profile"))
+			return
+		}
+		for _, field := range []struct {
+			value *string
+			dest  *string
+		}{
+			{profileReq.Slug, &profile.Slug},
+			{profileReq.Name, &profile.Name},
+			{profileReq.Description, &profile.Description},
+			{profileReq.Category, &profile.Category},
+			{profileReq.Address, &profile.Address},
+			{profileReq.City, &profile.City},
+			{profileReq.Phone, &profile.Phone},
+			{profileReq.Email, &profile.Email},
+			{profileReq.Website, &profile.Website},
+			{profileReq.LogoURL, &profile.LogoURL},
+		} {
+			if field.value != nil {
+				*field.dest = strings.TrimSpace(*field.value)
+			}
+		}
+		profile.Category = strings.ToLower(profile.Category)
+		if profileReq.OpeningHours != nil {
+			profile.OpeningHours = *profileReq.OpeningHours
+		}
+		if err := validateProfile(profile); err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		// 3. Save; the slug must not belong to another business
+		var taken int
+		err = db.QueryRow("SELECT 1 FROM businesses WHERE slug = $1 AND id <> $2", profile.Slug, businessID).Scan(&taken)
+		if err == nil {
+			c.Error(apierror.New(http.StatusConflict, "Slug is already taken").WithCode(apierror.CodeSlugTaken))
+			return
+		}
+		if err != sql.ErrNoRows {
+			c.Error(apierror.Internal(err, "Could not save profile"))
+			return
+		}
+		_, err = db.Exec(
+			`UPDATE businesses SET slug = $1, name = $2, description = $3, category = $4, address = $5, city = $6,
+			 phone = $7, email = $8, website = $9, logo_url = $10, opening_hours = $11
+			 WHERE id = $12`,
+			profile.Slug, profile.Name, profile.Description, profile.Category, profile.Address, profile.City,
+			profile.Phone, profile.Email, profile.Website, profile.LogoURL, hours.Format(profile.OpeningHours), businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not save profile"))
+			return
+		}
+
+		c.JSON(http.StatusOK, profile)
+	}
+}
+
+// GetPublicBusiness returns a business's booking-page profile with its
+// active locations
+func GetPublicBusiness(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		profile, err := loadBusinessProfile(db, "slug = $1", c.Param("slug"))
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Business not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch business"))
+			return
+		}
+
+		rows, err := db.Query(locationSelect+" WHERE business_id = $1 AND is_active = true ORDER BY name", profile.ID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch business"))
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			location, err := scanLocation(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Could not fetch business"))
+				return
+			}
+			profile.Locations = append(profile.Locations, location)
+		}
+
+		c.JSON(http.StatusOK, profile)
+	}
+}
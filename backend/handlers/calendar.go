@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/ical"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// isBusinessAdmin reports whether the user manages their whole business
+func isBusinessAdmin(user models.User) bool {
+	return user.Role == "business_admin" || user.Role == "super_admin"
+}
+
+// requestBaseURL is the scheme and host the client used to reach the API,
+// for building links back to it
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// calendarOwner works out which staff member a calendar feed or import
+// belongs to: admins can pick anyone in their business, or nobody for the
+// whole business; staff only themselves. It responds with the error itself
+// when the choice isn't allowed.
+func calendarOwner(c *gin.Context, db *database.Store, currentUser models.User, requested *int) (*int, string, bool) {
+	staffID := requested
+	if !isBusinessAdmin(currentUser) {
+		if staffID != nil && *staffID != currentUser.ID {
+			c.Error(apierror.New(http.StatusForbidden, "You don't have permission to do this"))
+			return nil, "", false
+		}
+		staffID = &currentUser.ID
+	}
+	if staffID == nil {
+		return nil, "", true
+	}
+
+	var staffName string
+	err := db.QueryRow(
+		"SELECT full_name FROM users WHERE id = $1 AND business_id = $2 AND role <> 'customer'",
+		*staffID, *currentUser.BusinessID,
+	).Scan(&staffName)
+	if err == sql.ErrNoRows {
+		c.Error(apierror.New(http.StatusNotFound, "Staff member not found"))
+		return nil, "", false
+	}
+	if err != nil {
+		c.Error(apierror.Internal(err, "Database error"))
+		return nil, "", false
+	}
+	return staffID, staffName, true
+}
+
+// CreateCalendarFeed creates a secret iCalendar feed URL. Admins can create
+// one for the whole business or for any staff member; staff only for
+// themselves. The URL is only shown once.
+func CreateCalendarFeed(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		// 1. Bind the request; the body is optional
+		var feedReq models.CreateCalendarFeedRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&feedReq); err != nil {
+				c.Error(apierror.Validation(err))
+				return
+			}
+		}
+
+		// 2. Work out whose bookings the feed shows
+		staffID, staffName, ok := calendarOwner(c, db, currentUser, feedReq.StaffID)
+		if !ok {
+			return
+		}
+		feed := models.CalendarFeed{StaffID: staffID, StaffName: staffName}
+
+		// 3. Create the feed; only the token's hash is stored
+		token, tokenHash, err := auth.NewOpaqueToken()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create feed"))
+			return
+		}
+		feed.CreatedAt = time.Now()
+		err = db.QueryRow(
+			`INSERT INTO calendar_feeds (business_id, staff_id, token_hash, created_by, created_at)
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			businessID, staffID, tokenHash, currentUser.ID, feed.CreatedAt,
+		).Scan(&feed.ID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create feed"))
+			return
+		}
+
+		feed.Token = token
+		feed.URL = requestBaseURL(c) + "/api/v1/calendar/" + token + ".ics"
+		c.JSON(http.StatusCreated, feed)
+	}
+}
+
+// GetCalendarFeeds lists the feeds of the business (admins) or of the
+// current staff member
+func GetCalendarFeeds(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		query := `
+			SELECT f.id, f.staff_id, u.full_name, f.created_at, f.last_used_at
+			FROM calendar_feeds f
+			LEFT JOIN users u ON f.staff_id = u.id
+			WHERE f.business_id = $1`
+		args := []interface{}{businessID}
+		if !isBusinessAdmin(currentUser) {
+			query += " AND f.staff_id = $2"
+			args = append(args, currentUser.ID)
+		}
+		query += " ORDER BY f.id"
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch feeds"))
+			return
+		}
+		defer rows.Close()
+
+		feeds := []models.CalendarFeed{}
+		for rows.Next() {
+			var feed models.CalendarFeed
+			var staffID sql.NullInt64
+			var staffName sql.NullString
+			var lastUsed sql.NullTime
+			if err := rows.Scan(&feed.ID, &staffID, &staffName, &feed.CreatedAt, &lastUsed); err != nil {
+				c.Error(apierror.Internal(err, "Error reading feeds"))
+				return
+			}
+			if staffID.Valid {
+				id := int(staffID.Int64)
+				feed.StaffID = &id
+			}
+			feed.StaffName = staffName.String
+			if lastUsed.Valid {
+				feed.LastUsedAt = &lastUsed.Time
+			}
+			feeds = append(feeds, feed)
+		}
+
+		c.JSON(http.StatusOK, feeds)
+	}
+}
+
+// DeleteCalendarFeed revokes a feed URL
+func DeleteCalendarFeed(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		feedID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid feed ID"))
+			return
+		}
+
+		query := "DELETE FROM calendar_feeds WHERE id = $1 AND business_id = $2"
+		args := []interface{}{feedID, businessID}
+		if !isBusinessAdmin(currentUser) {
+			query += " AND staff_id = $3"
+			args = append(args, currentUser.ID)
+		}
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not delete feed"))
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			c.Error(apierror.New(http.StatusNotFound, "Feed not found"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Feed deleted successfully"})
+	}
+}
+
+// GetCalendarFeed serves a feed to calendar clients. The route is
+// /api/v1/calendar/:file where file is "<token>.ics"; the token is the only
+// credential, since calendar apps can't send an Authorization header.
+func GetCalendarFeed(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSuffix(c.Param("file"), ".ics")
+
+		var feedID, businessID int
+		var staffID sql.NullInt64
+		err := db.QueryRow(
+			`SELECT f.id, f.business_id, f.staff_id FROM calendar_feeds f
+			 LEFT JOIN users u ON f.staff_id = u.id
+			 WHERE f.token_hash = $1 AND (f.staff_id IS NULL OR u.is_active = true)`,
+			auth.HashToken(token),
+		).Scan(&feedID, &businessID, &staffID)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Calendar not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch calendar"))
+			return
+		}
+
+		var staff *int
+		if staffID.Valid {
+			id := int(staffID.Int64)
+			staff = &id
+		}
+		now := time.Now()
+		cal, err := ical.Feed(db, businessID, staff, now)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not build calendar"))
+			return
+		}
+		db.Exec("UPDATE calendar_feeds SET last_used_at = $1 WHERE id = $2", now, feedID)
+
+		c.Header("Cache-Control", "private, max-age=300")
+		c.Data(http.StatusOK, ical.ContentType, cal.Bytes())
+	}
+}
+
+// GetPublicBookingCalendar lets the customer holding a booking's manage
+// token download it as an .ics file
+func GetPublicBookingCalendar(db *database.Store, appURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var bookingID int
+		err := db.QueryRow("SELECT id FROM bookings WHERE manage_token = $1", c.Param("token")).Scan(&bookingID)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Booking not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch booking"))
+			return
+		}
+
+		cal, err := ical.BookingFile(db, bookingID, appURL)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not build calendar"))
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="booking-%d.ics"`, bookingID))
+		c.Data(http.StatusOK, ical.ContentType, cal.Bytes())
+	}
+}
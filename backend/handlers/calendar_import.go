@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/calsync"
+	"booking-backend/database"
+	"booking-backend/ical"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readCalendarUpload reads the "file" part of a multipart request, if any
+func readCalendarUpload(c *gin.Context) ([]byte, string, bool, error) {
+	if !strings.HasPrefix(c.ContentType(), "multipart/") {
+		return nil, "", false, nil
+	}
+	header, err := c.FormFile("file")
+	if err == http.ErrMissingFile {
+		return nil, "", false, nil
+	}
+	if err != nil {
+		return nil, "", false, err
+	}
+	f, err := header.Open()
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, calsync.MaxSize+1))
+	if err != nil {
+		return nil, "", false, err
+	}
+	if len(data) > calsync.MaxSize {
+		return nil, "", false, errFileTooLarge
+	}
+	return data, header.Filename, true, nil
+}
+
+var errFileTooLarge = errors.New("file is larger than 5 MB")
+
+// validCalendarURL accepts http(s) and webcal URLs
+func validCalendarURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "webcal") && u.Host != ""
+}
+
+// CreateCalendarImport registers an external calendar whose events block
+// availability: an ICS URL (JSON body) or an uploaded .ics file
+// (multipart/form-data with a "file" part). The calendar is imported right
+// away so problems show up immediately.
+func CreateCalendarImport(db *database.Store, syncer *calsync.Syncer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		// 1. Bind the request: a URL, or a file upload
+		var importReq models.CreateCalendarImportRequest
+		if err := c.ShouldBind(&importReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+		upload, filename, uploaded, err := readCalendarUpload(c)
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid upload: "+err.Error()))
+			return
+		}
+		if uploaded == (importReq.URL != "") {
+			c.Error(apierror.New(http.StatusBadRequest, "Provide either a url or a file"))
+			return
+		}
+		if importReq.URL != "" && !validCalendarURL(importReq.URL) {
+			c.Error(apierror.New(http.StatusBadRequest, "url must be an http, https or webcal URL"))
+			return
+		}
+
+		// 2. Work out whose availability it blocks
+		staffID, staffName, ok := calendarOwner(c, db, currentUser, importReq.StaffID)
+		if !ok {
+			return
+		}
+
+		// 3. Fetch and parse it before saving anything
+		content := upload
+		if !uploaded {
+			content, err = calsync.Fetch(c.Request.Context(), syncer.Client, importReq.URL)
+			if err != nil {
+				// Fetch's errors don't say why a connection failed
+				c.Error(apierror.New(http.StatusBadRequest, "Could not fetch calendar: "+err.Error()))
+				return
+			}
+		}
+		loc, _ := businessLocation(db, businessID)
+		now := time.Now()
+		periods, err := ical.BusyPeriods(content, loc, now.Add(-calsync.History), now.Add(calsync.Horizon))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Could not read calendar: "+err.Error()))
+			return
+		}
+
+		// 4. Save the import and its busy times
+		name := importReq.Name
+		if name == "" {
+			name = filename
+			if !uploaded {
+				u, _ := url.Parse(importReq.URL)
+				name = u.Host
+			}
+		}
+		var importURL, icsData interface{}
+		if uploaded {
+			icsData = string(upload)
+		} else {
+			importURL = importReq.URL
+		}
+
+		var importID int
+		err = db.QueryRow(
+			`INSERT INTO calendar_imports (business_id, staff_id, name, url, ics_data, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			businessID, staffID, name, importURL, icsData, now,
+		).Scan(&importID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not save calendar"))
+			return
+		}
+		if err := calsync.Store(db, importID, periods, now); err != nil {
+			c.Error(apierror.Internal(err, "Could not save busy times"))
+			return
+		}
+
+		calendarImport, err := loadCalendarImport(db, importID, businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load calendar"))
+			return
+		}
+		calendarImport.StaffName = staffName
+		c.JSON(http.StatusCreated, calendarImport)
+	}
+}
+
+const calendarImportSelect = `
+	SELECT ci.id, ci.staff_id, u.full_name, ci.name, ci.url, ci.busy_count, ci.last_synced_at, ci.last_error, ci.created_at
+	FROM calendar_imports ci
+	LEFT JOIN users u ON ci.staff_id = u.id
+`
+
+func scanCalendarImport(row rowScanner) (models.CalendarImport, error) {
+	var ci models.CalendarImport
+	var staffID sql.NullInt64
+	var staffName, importURL, lastError sql.NullString
+	var lastSynced sql.NullTime
+	err := row.Scan(&ci.ID, &staffID, &staffName, &ci.Name, &importURL, &ci.BusyCount, &lastSynced, &lastError, &ci.CreatedAt)
+	if staffID.Valid {
+		id := int(staffID.Int64)
+		ci.StaffID = &id
+	}
+	ci.StaffName = staffName.String
+	ci.URL = importURL.String
+	ci.LastError = lastError.String
+	if lastSynced.Valid {
+		ci.LastSyncedAt = &lastSynced.Time
+	}
+	return ci, err
+}
+
+func loadCalendarImport(q database.Querier, importID, businessID int) (models.CalendarImport, error) {
+	return scanCalendarImport(q.QueryRow(calendarImportSelect+" WHERE ci.id = $1 AND ci.business_id = $2", importID, businessID))
+}
+
+// GetCalendarImports lists the imported calendars of the business (admins)
+// or of the current staff member
+func GetCalendarImports(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		query := calendarImportSelect + " WHERE ci.business_id = $1"
+		args := []interface{}{businessID}
+		if !isBusinessAdmin(currentUser) {
+			query += " AND ci.staff_id = $2"
+			args = append(args, currentUser.ID)
+		}
+		query += " ORDER BY ci.id"
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch calendars"))
+			return
+		}
+		defer rows.Close()
+
+		imports := []models.CalendarImport{}
+		for rows.Next() {
+			calendarImport, err := scanCalendarImport(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading calendars"))
+				return
+			}
+			imports = append(imports, calendarImport)
+		}
+
+		c.JSON(http.StatusOK, imports)
+	}
+}
+
+// calendarImportForUser loads an import the current user may manage
+func calendarImportForUser(c *gin.Context, db *database.Store, currentUser models.User) (models.CalendarImport, bool) {
+	importID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.Error(apierror.New(http.StatusBadRequest, "Invalid calendar ID"))
+		return models.CalendarImport{}, false
+	}
+
+	calendarImport, err := loadCalendarImport(db, importID, *currentUser.BusinessID)
+	if err == nil && !isBusinessAdmin(currentUser) && (calendarImport.StaffID == nil || *calendarImport.StaffID != currentUser.ID) {
+		err = sql.ErrNoRows
+	}
+	if err == sql.ErrNoRows {
+		c.Error(apierror.New(http.StatusNotFound, "Calendar not found"))
+		return calendarImport, false
+	}
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not fetch calendar"))
+		return calendarImport, false
+	}
+	return calendarImport, true
+}
+
+// SyncCalendarImport refreshes an import now. Uploaded calendars can be
+// replaced by sending a new "file" part.
+func SyncCalendarImport(db *database.Store, syncer *calsync.Syncer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		calendarImport, ok := calendarImportForUser(c, db, currentUser)
+		if !ok {
+			return
+		}
+
+		// A new upload replaces the stored file
+		upload, _, uploaded, err := readCalendarUpload(c)
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid upload: "+err.Error()))
+			return
+		}
+		if uploaded {
+			if calendarImport.URL != "" {
+				c.Error(apierror.New(http.StatusBadRequest, "This calendar is fetched from its URL"))
+				return
+			}
+			loc, _ := businessLocation(db, businessID)
+			if _, err := ical.BusyPeriods(upload, loc, time.Now(), time.Now()); err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "Could not read calendar: "+err.Error()))
+				return
+			}
+			if _, err := db.Exec("UPDATE calendar_imports SET ics_data = $1 WHERE id = $2", string(upload), calendarImport.ID); err != nil {
+				c.Error(apierror.Internal(err, "Could not save calendar"))
+				return
+			}
+		}
+
+		err = calsync.Sync(c.Request.Context(), db, syncer.Client, calendarImport.ID, time.Now())
+		if errors.Is(err, calsync.ErrCalendar) {
+			// The reason is in the import's last_error
+			c.Error(apierror.New(http.StatusBadGateway, "Could not sync calendar, see its last error"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not sync calendar"))
+			return
+		}
+
+		calendarImport, err = loadCalendarImport(db, calendarImport.ID, businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load calendar"))
+			return
+		}
+		c.JSON(http.StatusOK, calendarImport)
+	}
+}
+
+// DeleteCalendarImport removes an import and frees the time it blocked
+func DeleteCalendarImport(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+
+		calendarImport, ok := calendarImportForUser(c, db, currentUser)
+		if !ok {
+			return
+		}
+
+		if _, err := db.Exec("DELETE FROM calendar_imports WHERE id = $1", calendarImport.ID); err != nil {
+			c.Error(apierror.Internal(err, "Could not delete calendar"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Calendar deleted successfully"})
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"booking-backend/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOpenAPISpec serves the OpenAPI 3 document of the API
+func GetOpenAPISpec() gin.HandlerFunc {
+	spec := openapi.JSON()
+	return func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+	}
+}
+
+// apiDocsPage renders the openapi.json next to it with Swagger UI
+const apiDocsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Booking API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="docs"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({ url: "openapi.json", dom_id: "#docs" });
+  </script>
+</body>
+</html>
+`
+
+// GetAPIDocs serves the API documentation
+func GetAPIDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(apiDocsPage))
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/page"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pageRequest parses the paging parameters of a list. On error it answers
+// the request and returns ok == false.
+func pageRequest(c *gin.Context, keys map[string]page.Key, defaultSort, idColumn string) (page.Request, bool) {
+	r, err := page.Parse(c.Request.URL.Query(), keys, defaultSort, idColumn)
+	if err != nil {
+		c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+		return r, false
+	}
+	return r, true
+}
+
+// timeRangeFilter narrows a list to ?from= and ?to= on a timestamp column.
+// Both take an RFC 3339 time or a date, which is a day in loc; to is
+// exclusive (to=2024-05-01 ends before that day).
+func timeRangeFilter(c *gin.Context, column string, loc *time.Location, args []interface{}) (string, []interface{}, bool) {
+	filter := ""
+	for _, bound := range []struct{ param, op string }{{"from", ">="}, {"to", "<"}} {
+		value := c.Query(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t, err = time.ParseInLocation("2006-01-02", value, loc)
+		}
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, fmt.Sprintf("Invalid %s, expected YYYY-MM-DD or an RFC 3339 time", bound.param)))
+			return "", nil, false
+		}
+		args = append(args, t)
+		filter += fmt.Sprintf(" AND %s %s $%d", column, bound.op, len(args))
+	}
+	return filter, args, true
+}
+
+// intFilter narrows a list to a numeric query parameter, if given
+func intFilter(c *gin.Context, param, column string, args []interface{}) (string, []interface{}, bool) {
+	value := c.Query(param)
+	if value == "" {
+		return "", args, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		c.Error(apierror.New(http.StatusBadRequest, "Invalid "+param))
+		return "", nil, false
+	}
+	args = append(args, n)
+	return fmt.Sprintf(" AND %s = $%d", column, len(args)), args, true
+}
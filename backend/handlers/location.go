@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/database"
+	"booking-backend/hours"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const locationSelect = `SELECT id, business_id, name, address, city, timezone, opening_hours, is_active FROM locations`
+
+func scanLocation(row rowScanner) (models.Location, error) {
+	var location models.Location
+	var address, city, openingHours sql.NullString
+	err := row.Scan(&location.ID, &location.BusinessID, &location.Name, &address, &city, &location.Timezone, &openingHours, &location.IsActive)
+	if err != nil {
+		return location, err
+	}
+	location.Address = address.String
+	location.City = city.String
+	location.OpeningHours, err = hours.Parse(openingHours.String)
+	return location, err
+}
+
+// locationScope returns the locations a user works at. nil means the whole
+// business: users without locations (and super admins) aren't restricted.
+// On error it answers the request and returns ok == false.
+func locationScope(c *gin.Context, db *database.Store, user models.User) (scope []int, ok bool) {
+	if user.Role == "super_admin" {
+		return nil, true
+	}
+	rows, err := db.Query("SELECT location_id FROM location_staff WHERE user_id = $1 ORDER BY location_id", user.ID)
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not check location permissions"))
+		return nil, false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var locationID int
+		if err := rows.Scan(&locationID); err != nil {
+			c.Error(apierror.Internal(err, "Could not check location permissions"))
+			return nil, false
+		}
+		scope = append(scope, locationID)
+	}
+	return scope, true
+}
+
+// inScope reports whether a location is one of scope's
+func inScope(scope []int, locationID sql.NullInt64) bool {
+	if scope == nil {
+		return true
+	}
+	for _, id := range scope {
+		if locationID.Valid && int64(id) == locationID.Int64 {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeFilter restricts a query to the locations in scope (column is the
+// location_id column) and returns the condition and the extended args
+func scopeFilter(column string, scope []int, args []interface{}) (string, []interface{}) {
+	if scope == nil {
+		return "", args
+	}
+	placeholders := make([]string, len(scope))
+	for i, id := range scope {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	return " AND " + column + " IN (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// locationFilter narrows a list to the location_id query parameter, if
+// given, within the caller's scope
+func locationFilter(c *gin.Context, column string, scope []int, args []interface{}) (string, []interface{}, bool) {
+	filter, args := scopeFilter(column, scope, args)
+	if value := c.Query("location_id"); value != "" {
+		locationID, err := strconv.Atoi(value)
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid location_id"))
+			return "", nil, false
+		}
+		args = append(args, locationID)
+		filter += fmt.Sprintf(" AND %s = $%d", column, len(args))
+	}
+	return filter, args, true
+}
+
+// defaultLocation is the business's first active location, used when a
+// request doesn't name one
+func defaultLocation(q database.Querier, businessID int) (int, error) {
+	var locationID int
+	err := q.QueryRow(
+		"SELECT id FROM locations WHERE business_id = $1 AND is_active = true ORDER BY id LIMIT 1",
+		businessID,
+	).Scan(&locationID)
+	return locationID, err
+}
+
+// bookingInScope checks that a booking of the business is at one of the
+// user's locations. Otherwise it answers the request as if the booking
+// didn't exist.
+func bookingInScope(c *gin.Context, db *database.Store, user models.User, bookingID int) bool {
+	scope, ok := locationScope(c, db, user)
+	if !ok {
+		return false
+	}
+	var locationID sql.NullInt64
+	err := db.QueryRow(
+		"SELECT location_id FROM bookings WHERE id = $1 AND business_id = $2",
+		bookingID, *user.BusinessID,
+	).Scan(&locationID)
+	if err == sql.ErrNoRows || (err == nil && !inScope(scope, locationID)) {
+		c.Error(apierror.New(http.StatusNotFound, "Booking not found"))
+		return false
+	}
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not fetch booking"))
+		return false
+	}
+	return true
+}
+
+// activeLocation is a condition hiding rows (by their location_id column)
+// at locations that are no longer active
+func activeLocation(column string) string {
+	return " AND (" + column + " IS NULL OR " + column + " IN (SELECT id FROM locations WHERE is_active = true))"
+}
+
+// serviceTimezone is the timezone of the location a service is offered
+// at, falling back to the business's
+func serviceTimezone(db *database.Store, businessID, serviceID int) *time.Location {
+	var timezone string
+	err := db.QueryRow(
+		"SELECT l.timezone FROM services sv JOIN locations l ON sv.location_id = l.id WHERE sv.id = $1 AND sv.business_id = $2",
+		serviceID, businessID,
+	).Scan(&timezone)
+	if err == nil {
+		if loc, err := time.LoadLocation(timezone); err == nil {
+			return loc
+		}
+	}
+	loc, _ := businessLocation(db, businessID)
+	return loc
+}
+
+// validateLocationRequest checks a location's timezone and opening hours,
+// defaulting the timezone to the business's
+func validateLocationRequest(db *database.Store, businessID int, locationReq *models.LocationRequest) error {
+	if locationReq.Timezone == "" {
+		_, locationReq.Timezone = businessLocation(db, businessID)
+	}
+	if _, err := time.LoadLocation(locationReq.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", locationReq.Timezone)
+	}
+	return hours.Validate(locationReq.OpeningHours)
+}
+
+// GetLocations lists the locations the user can manage, with their staff
+func GetLocations(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		filter, args := scopeFilter("id", scope, []interface{}{businessID})
+
+		rows, err := db.Query(locationSelect+" WHERE business_id = $1"+filter+" ORDER BY name", args...)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch locations"))
+			return
+		}
+		locations := []models.Location{}
+		for rows.Next() {
+			location, err := scanLocation(rows)
+			if err != nil {
+				rows.Close()
+				c.Error(apierror.Internal(err, "Error reading locations"))
+				return
+			}
+			locations = append(locations, location)
+		}
+		rows.Close()
+
+		for i := range locations {
+			locations[i].StaffIDs, err = locationStaff(db, locations[i].ID)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Could not fetch locations"))
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, locations)
+	}
+}
+
+func locationStaff(q database.Querier, locationID int) ([]int, error) {
+	rows, err := q.Query("SELECT user_id FROM location_staff WHERE location_id = $1 ORDER BY user_id", locationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staffIDs := []int{}
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		staffIDs = append(staffIDs, userID)
+	}
+	return staffIDs, rows.Err()
+}
+
+// CreateLocation adds a location to the business. Only admins of the whole
+// business can add locations.
+func CreateLocation(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		if scope != nil {
+			c.Error(apierror.New(http.StatusForbidden, "Only admins of the whole business can add locations"))
+			return
+		}
+
+		var locationReq models.LocationRequest
+		if err := c.ShouldBindJSON(&locationReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+		if err := validateLocationRequest(db, businessID, &locationReq); err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		location := models.Location{
+			BusinessID:   businessID,
+			Name:         locationReq.Name,
+			Address:      locationReq.Address,
+			City:         locationReq.City,
+			Timezone:     locationReq.Timezone,
+			OpeningHours: locationReq.OpeningHours,
+			IsActive:     locationReq.IsActive == nil || *locationReq.IsActive,
+			StaffIDs:     []int{},
+		}
+		err := db.QueryRow(
+			`INSERT INTO locations (business_id, name, address, city, timezone, opening_hours, is_active, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			businessID, location.Name, location.Address, location.City, location.Timezone, hours.Format(location.OpeningHours), location.IsActive, time.Now(),
+		).Scan(&location.ID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create location"))
+			return
+		}
+
+		c.JSON(http.StatusCreated, location)
+	}
+}
+
+// UpdateLocation replaces the details of a location the user manages
+func UpdateLocation(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		locationID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid location ID"))
+			return
+		}
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		if !inScope(scope, sql.NullInt64{Int64: int64(locationID), Valid: true}) {
+			c.Error(apierror.New(http.StatusNotFound, "Location not found"))
+			return
+		}
+
+		var locationReq models.LocationRequest
+		if err := c.ShouldBindJSON(&locationReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+		if err := validateLocationRequest(db, businessID, &locationReq); err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		isActive := locationReq.IsActive == nil || *locationReq.IsActive
+		result, err := db.Exec(
+			`UPDATE locations SET name = $1, address = $2, city = $3, timezone = $4, opening_hours = $5, is_active = $6
+			 WHERE id = $7 AND business_id = $8`,
+			locationReq.Name, locationReq.Address, locationReq.City, locationReq.Timezone, hours.Format(locationReq.OpeningHours), isActive,
+			locationID, businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not update location"))
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			c.Error(apierror.New(http.StatusNotFound, "Location not found"))
+			return
+		}
+
+		location, err := scanLocation(db.QueryRow(locationSelect+" WHERE id = $1", locationID))
+		if err == nil {
+			location.StaffIDs, err = locationStaff(db, locationID)
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load location"))
+			return
+		}
+
+		c.JSON(http.StatusOK, location)
+	}
+}
+
+// SetLocationStaff replaces the list of users working at a location. Only
+// admins of the whole business can assign people, since assigning an admin
+// to locations limits what they can manage.
+func SetLocationStaff(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		locationID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid location ID"))
+			return
+		}
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		if scope != nil {
+			c.Error(apierror.New(http.StatusForbidden, "Only admins of the whole business can assign staff to locations"))
+			return
+		}
+
+		var staffReq models.SetLocationStaffRequest
+		if err := c.ShouldBindJSON(&staffReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		var found int
+		err = tx.QueryRow("SELECT 1 FROM locations WHERE id = $1 AND business_id = $2", locationID, businessID).Scan(&found)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Location not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch location"))
+			return
+		}
+
+		if _, err := tx.Exec("DELETE FROM location_staff WHERE location_id = $1", locationID); err != nil {
+			c.Error(apierror.Internal(err, "Could not update staff"))
+			return
+		}
+		added := map[int]bool{}
+		for _, userID := range staffReq.UserIDs {
+			if added[userID] {
+				continue
+			}
+			added[userID] = true
+
+			// Only people of this business can work here
+			result, err := tx.Exec(
+				`INSERT INTO location_staff (location_id, user_id)
+				 SELECT $1, id FROM users WHERE id = $2 AND business_id = $3 AND role IN ('staff', 'business_admin')`,
+				locationID, userID, businessID,
+			)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Could not update staff"))
+				return
+			}
+			if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+				c.Error(apierror.New(http.StatusBadRequest, fmt.Sprintf("Staff member %d not found", userID)))
+				return
+			}
+		}
+
+		staffIDs, err := locationStaff(tx, locationID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not update staff"))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"location_id": locationID, "staff_ids": staffIDs})
+	}
+}
+
+// GetPublicLocations lists the active locations of a business for its
+// booking page
+func GetPublicLocations(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		businessID, ok := publicBusinessID(c, db)
+		if !ok {
+			return
+		}
+
+		rows, err := db.Query(locationSelect+" WHERE business_id = $1 AND is_active = true ORDER BY name", businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch locations"))
+			return
+		}
+		defer rows.Close()
+
+		locations := []models.Location{}
+		for rows.Next() {
+			location, err := scanLocation(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading locations"))
+				return
+			}
+			locations = append(locations, location)
+		}
+
+		c.JSON(http.StatusOK, locations)
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/database"
+	"booking-backend/models"
+	"booking-backend/notify"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNotificationTemplates lists the templates used for the business's
+// notifications: its own where it has one, the built-in default otherwise
+func GetNotificationTemplates(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		var templates []notify.Template
+		for _, event := range notify.Events {
+			for _, channel := range []string{notify.ChannelEmail, notify.ChannelSMS} {
+				tmpl, ok, err := notify.LoadTemplate(db, businessID, event, channel)
+				if err != nil {
+					c.Error(apierror.Internal(err, "Could not fetch templates"))
+					return
+				}
+				if ok {
+					templates = append(templates, tmpl)
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, templates)
+	}
+}
+
+// UpdateNotificationTemplate saves the business's own template for an event
+// and channel
+func UpdateNotificationTemplate(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		event, channel, ok := templateParams(c)
+		if !ok {
+			return
+		}
+
+		var templateReq models.NotificationTemplateRequest
+		if err := c.ShouldBindJSON(&templateReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tmpl := notify.Template{
+			Event:   event,
+			Channel: channel,
+			Subject: templateReq.Subject,
+			Text:    templateReq.BodyText,
+			HTML:    templateReq.BodyHTML,
+			Custom:  true,
+		}
+		if err := tmpl.Validate(); err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid template: "+err.Error()))
+			return
+		}
+
+		_, err := db.Exec(
+			`INSERT INTO notification_templates (business_id, event, channel, subject, body_text, body_html, updated_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)
+			 ON CONFLICT (business_id, event, channel) DO UPDATE
+			 SET subject = EXCLUDED.subject, body_text = EXCLUDED.body_text,
+			     body_html = EXCLUDED.body_html, updated_at = EXCLUDED.updated_at`,
+			businessID, event, channel, tmpl.Subject, tmpl.Text, tmpl.HTML, time.Now(),
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not save template"))
+			return
+		}
+
+		c.JSON(http.StatusOK, tmpl)
+	}
+}
+
+// DeleteNotificationTemplate goes back to the built-in template
+func DeleteNotificationTemplate(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		event, channel, ok := templateParams(c)
+		if !ok {
+			return
+		}
+
+		_, err := db.Exec(
+			"DELETE FROM notification_templates WHERE business_id = $1 AND event = $2 AND channel = $3",
+			businessID, event, channel,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not delete template"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Template reset to default"})
+	}
+}
+
+// templateParams validates the :event and :channel URL parameters
+func templateParams(c *gin.Context) (string, string, bool) {
+	event, channel := c.Param("event"), c.Param("channel")
+	if channel != notify.ChannelEmail && channel != notify.ChannelSMS {
+		c.Error(apierror.New(http.StatusBadRequest, "Unknown channel"))
+		return "", "", false
+	}
+	for _, known := range notify.Events {
+		if event == known {
+			return event, channel, true
+		}
+	}
+	c.Error(apierror.New(http.StatusBadRequest, "Unknown event"))
+	return "", "", false
+}
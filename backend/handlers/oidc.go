@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/models"
+	"booking-backend/oidc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOIDCProviders lists the providers users can sign in with
+func GetOIDCProviders(providers oidc.Providers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list := []models.OIDCProvider{}
+		for name := range providers {
+			list = append(list, models.OIDCProvider{Name: name})
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// oidcStateCookie holds the state of the sign-in the browser started, so
+// that a callback with someone else's state (login CSRF) is refused
+const oidcStateCookie = "oidc_state"
+
+// StartOIDCLogin begins a sign-in with a provider. The client sends the
+// user to the returned URL; the provider sends them back to the
+// provider's redirect URL with the code and state for OIDCCallback.
+func StartOIDCLogin(db *database.Store, providers oidc.Providers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			c.Error(apierror.New(http.StatusNotFound, "Unknown sign-in provider"))
+			return
+		}
+
+		req, err := auth.StartOIDCLogin(db, provider.Name, time.Now())
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start sign-in"))
+			return
+		}
+		authURL, err := provider.AuthCodeURL(c.Request.Context(), req)
+		if err != nil {
+			log.Printf("oidc %s: %v", provider.Name, err)
+			c.Error(apierror.New(http.StatusBadGateway, "Could not reach "+provider.Name))
+			return
+		}
+
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, req.State, int(auth.OIDCLoginTTL.Seconds()), "/api", "", c.Request.TLS != nil, true)
+		c.JSON(http.StatusOK, models.OIDCStartResponse{AuthorizationURL: authURL})
+	}
+}
+
+// OIDCCallback finishes a sign-in with a provider and logs the user in
+// like Login, including its two-factor step. Provider accounts are linked
+// to the user with the same (verified) email; people without an account
+// get a customer account.
+func OIDCCallback(db *database.Store, opts AccountOptions, providers oidc.Providers) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, ok := providers[c.Param("provider")]
+		if !ok {
+			c.Error(apierror.New(http.StatusNotFound, "Unknown sign-in provider"))
+			return
+		}
+
+		// 1. Bind the code and state the provider sent the user back with
+		var callbackReq models.OIDCCallbackRequest
+		if err := c.ShouldBindJSON(&callbackReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		// 2. Check this browser started the sign-in, and find it (once only)
+		cookieState, _ := c.Cookie(oidcStateCookie)
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, "", -1, "/api", "", c.Request.TLS != nil, true)
+		if cookieState == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(callbackReq.State)) != 1 {
+			c.Error(apierror.New(http.StatusUnauthorized, "The sign-in has expired, please try again"))
+			return
+		}
+		now := time.Now()
+		req, err := auth.FinishOIDCLogin(db, provider.Name, callbackReq.State, now)
+		if err == auth.ErrInvalidOIDCState {
+			c.Error(apierror.New(http.StatusUnauthorized, "The sign-in has expired, please try again"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not finish sign-in"))
+			return
+		}
+
+		// 3. Redeem the code for the verified identity
+		identity, err := provider.Exchange(c.Request.Context(), callbackReq.Code, req.Verifier, req.Nonce)
+		if err != nil {
+			log.Printf("oidc %s: %v", provider.Name, err)
+			c.Error(apierror.New(http.StatusUnauthorized, "Could not sign in with "+provider.Name))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		// 4. Find, link or create the user
+		userID, err := auth.LinkIdentity(tx, provider.Name, identity, now)
+		if err == auth.ErrEmailNotVerified {
+			c.Error(apierror.New(http.StatusForbidden, "Your "+provider.Name+" email address isn't verified"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not sign in"))
+			return
+		}
+
+		user, err := loadLoginUser(tx, userID)
+		if err == nil && user.EmailVerified {
+			// The provider may just have verified the email
+			err = linkVerifiedCustomer(tx, userID)
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+
+		// 5. The same checks as Login
+		if !user.IsActive {
+			c.Error(apierror.New(http.StatusForbidden, "Account is deactivated"))
+			return
+		}
+		if opts.RequireVerifiedEmail && !user.EmailVerified {
+			c.Error(apierror.New(http.StatusForbidden, "Please verify your email address before logging in"))
+			return
+		}
+
+		// 6. Start a session, or ask for the second factor first
+		response, err := finishLogin(tx, user, c.ClientIP())
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not generate token"))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
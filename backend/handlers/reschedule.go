@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/database"
+	"booking-backend/models"
+	"booking-backend/notify"
+	"booking-backend/slots"
+	"booking-backend/waitlist"
+	"booking-backend/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RescheduleBooking lets the business move one of its bookings to another
+// slot. With "force" the cutoff and reschedule limit don't apply.
+func RescheduleBooking(db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher, wl *waitlist.Waitlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		bookingID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid booking ID"))
+			return
+		}
+
+		var rescheduleReq models.RescheduleBookingRequest
+		if err := c.ShouldBindJSON(&rescheduleReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		if !bookingInScope(c, db, currentUser, bookingID) {
+			return
+		}
+
+		rescheduleAndRespond(c, db, outbox, hooks, wl, bookingID, businessID, rescheduleReq, businessActor(currentUser))
+	}
+}
+
+// ReschedulePublicBooking lets the customer holding a booking's manage token
+// move it to another slot of the same service
+func ReschedulePublicBooking(db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher, wl *waitlist.Waitlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var bookingID, businessID int
+		err := db.QueryRow("SELECT id, business_id FROM bookings WHERE manage_token = $1", c.Param("token")).Scan(&bookingID, &businessID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.Error(apierror.New(http.StatusNotFound, "Booking not found"))
+			} else {
+				c.Error(apierror.Internal(err, "Could not fetch booking"))
+			}
+			return
+		}
+
+		var rescheduleReq models.RescheduleBookingRequest
+		if err := c.ShouldBindJSON(&rescheduleReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+		// Only the business can override its own rules
+		rescheduleReq.Force = false
+
+		rescheduleAndRespond(c, db, outbox, hooks, wl, bookingID, businessID, rescheduleReq, customerActor)
+	}
+}
+
+// rescheduleAndRespond moves a scheduled booking to another slot in one
+// transaction: the new slot is claimed and the old one freed together, so
+// the customer never ends up with both or neither. The booking keeps its ID
+// and manage token.
+func rescheduleAndRespond(c *gin.Context, db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher, wl *waitlist.Waitlist, bookingID, businessID int, rescheduleReq models.RescheduleBookingRequest, actor bookingActor) {
+	tx, err := db.Begin()
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not start transaction"))
+		return
+	}
+	defer tx.Rollback()
+
+	// 1. Lock the booking and read the business's rules
+	var status string
+	var seats, rescheduleCount, cutoff, maxReschedules int
+	var oldSlot models.TimeSlot
+	err = tx.QueryRow(
+		`SELECT b.status, b.seats, b.reschedule_count, s.id, s.start_time, s.service_id, bz.reschedule_cutoff_minutes, bz.max_reschedules
+		 FROM bookings b
+		 JOIN appointment_slots s ON b.slot_id = s.id
+		 JOIN businesses bz ON b.business_id = bz.id
+		 WHERE b.id = $1 AND b.business_id = $2
+		 FOR UPDATE OF b`,
+		bookingID, businessID,
+	).Scan(&status, &seats, &rescheduleCount, &oldSlot.ID, &oldSlot.StartTime, &oldSlot.ServiceID, &cutoff, &maxReschedules)
+	if err == sql.ErrNoRows {
+		c.Error(apierror.New(http.StatusNotFound, "Booking not found"))
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not fetch booking"))
+		return
+	}
+
+	// 2. Check the booking can still be moved
+	now := time.Now()
+	if status != "scheduled" {
+		c.Error(apierror.New(http.StatusConflict, "Only scheduled bookings can be rescheduled"))
+		return
+	}
+	if rescheduleReq.SlotID == oldSlot.ID {
+		c.Error(apierror.New(http.StatusBadRequest, "The booking is already in this slot"))
+		return
+	}
+	if !rescheduleReq.Force {
+		if !oldSlot.StartTime.After(now) {
+			c.Error(apierror.New(http.StatusConflict, "Past bookings can't be rescheduled"))
+			return
+		}
+		if oldSlot.StartTime.Sub(now) < time.Duration(cutoff)*time.Minute {
+			c.Error(apierror.New(http.StatusConflict, fmt.Sprintf("Bookings can't be rescheduled less than %s before they start", formatMinutes(cutoff))))
+			return
+		}
+		if rescheduleCount >= maxReschedules {
+			c.Error(apierror.New(http.StatusConflict, "This booking can't be rescheduled again"))
+			return
+		}
+	}
+
+	// 3. Give back the old seats and any time held after them first: the
+	// new slot may overlap time this booking blocked
+	if err := slots.Release(tx, oldSlot.ID, seats); err != nil {
+		c.Error(apierror.Internal(err, "Could not release slot"))
+		return
+	}
+	blocked, err := slots.ReleaseBlocks(tx, slots.Booking(bookingID))
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not release slot"))
+		return
+	}
+
+	// 4. Claim the booking's seats in the new slot: same service, enough
+	// seats left, in the future and not while the staff member is busy. A
+	// slot of another service is rolled back with the transaction.
+	newSlot, ok, err := slots.Take(tx, rescheduleReq.SlotID, seats, now)
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not reserve slot"))
+		return
+	}
+	if !ok || newSlot.BusinessID != businessID || newSlot.ServiceID != oldSlot.ServiceID {
+		c.Error(apierror.New(http.StatusConflict, "This slot is no longer available").WithCode(apierror.CodeSlotUnavailable))
+		return
+	}
+
+	// A multi-service booking also needs the time after the new slot
+	plan, err := slots.LoadPlan(tx, slots.Booking(bookingID))
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not reserve slot"))
+		return
+	}
+	if len(plan) > 1 {
+		serviceIDs := make([]int, len(plan))
+		for i, item := range plan {
+			serviceIDs[i] = item.ServiceID
+		}
+		plan, err = slots.Plan(tx, newSlot, serviceIDs)
+		if err != nil {
+			planError(c, err)
+			return
+		}
+		ok, err := slots.Block(tx, slots.Booking(bookingID), newSlot.ID, newSlot.EndTime, slots.End(plan), now)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not reserve slot"))
+			return
+		}
+		if !ok {
+			c.Error(apierror.New(http.StatusConflict, "There isn't enough free time after this slot for these services").WithCode(apierror.CodeSlotUnavailable))
+			return
+		}
+		if err := slots.SavePlan(tx, slots.Booking(bookingID), plan); err != nil {
+			c.Error(apierror.Internal(err, "Could not reschedule booking"))
+			return
+		}
+	}
+
+	// 5. Move the booking
+	_, err = tx.Exec(
+		`UPDATE bookings SET slot_id = $1, reschedule_count = reschedule_count + 1, rescheduled_at = $2
+		 WHERE id = $3`,
+		newSlot.ID, now, bookingID,
+	)
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not reschedule booking"))
+		return
+	}
+
+	// Reminders already sent were for the old time
+	if _, err := tx.Exec("DELETE FROM booking_reminders WHERE booking_id = $1", bookingID); err != nil {
+		c.Error(apierror.Internal(err, "Could not reschedule booking"))
+		return
+	}
+	if err := recordBookingEvent(tx, bookingID, "rescheduled", actor, &oldSlot, &newSlot); err != nil {
+		c.Error(apierror.Internal(err, "Could not reschedule booking"))
+		return
+	}
+
+	booking, err := scanBooking(tx.QueryRow(bookingSelect+" WHERE b.id = $1", bookingID))
+	if err == nil {
+		err = loadBookingServices(tx, &booking)
+	}
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not load booking"))
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.Error(apierror.Internal(err, "Transaction failed"))
+		return
+	}
+
+	// 6. Tell the customer and the business's systems
+	outbox.NotifyRescheduled(bookingID, oldSlot.StartTime)
+	hooks.Publish(businessID, webhook.EventBookingRescheduled, booking)
+	wl.SlotFreed(oldSlot.ID)
+	for _, id := range blocked {
+		wl.SlotFreed(id)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Booking rescheduled",
+		"booking": booking,
+	})
+}
+
+// formatMinutes writes a cutoff such as 720 as "12 hours"
+func formatMinutes(minutes int) string {
+	switch {
+	case minutes%(24*60) == 0 && minutes >= 24*60:
+		return plural(minutes/(24*60), "day")
+	case minutes%60 == 0 && minutes >= 60:
+		return plural(minutes/60, "hour")
+	default:
+		return plural(minutes, "minute")
+	}
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// GetBookingHistory lists what happened to a booking, oldest first
+func GetBookingHistory(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+
+		bookingID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid booking ID"))
+			return
+		}
+
+		if !bookingInScope(c, db, currentUser, bookingID) {
+			return
+		}
+
+		rows, err := db.Query(
+			`SELECT id, event, from_slot_id, to_slot_id, from_start, to_start, actor, user_id, api_key_id, created_at
+			 FROM booking_events WHERE booking_id = $1 ORDER BY id`,
+			bookingID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch history"))
+			return
+		}
+		defer rows.Close()
+
+		events := []models.BookingEvent{}
+		for rows.Next() {
+			var event models.BookingEvent
+			var fromSlot, toSlot, userID, apiKeyID sql.NullInt64
+			var fromStart, toStart sql.NullTime
+			if err := rows.Scan(&event.ID, &event.Event, &fromSlot, &toSlot, &fromStart, &toStart, &event.Actor, &userID, &apiKeyID, &event.CreatedAt); err != nil {
+				c.Error(apierror.Internal(err, "Error reading history"))
+				return
+			}
+			event.FromSlotID = nullIntPtr(fromSlot)
+			event.ToSlotID = nullIntPtr(toSlot)
+			event.UserID = nullIntPtr(userID)
+			event.APIKeyID = nullIntPtr(apiKeyID)
+			if fromStart.Valid {
+				event.FromStart = &fromStart.Time
+			}
+			if toStart.Valid {
+				event.ToStart = &toStart.Time
+			}
+			events = append(events, event)
+		}
+
+		c.JSON(http.StatusOK, events)
+	}
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	i := int(n.Int64)
+	return &i
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/middleware"
+	"booking-backend/models"
+	"booking-backend/notify"
+	"booking-backend/waitlist"
+	"booking-backend/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestRescheduleMovesSeats moves a two-seat booking: a slot without two
+// seats left is refused and changes nothing, and a move gives the old
+// slot's seats back
+func TestRescheduleMovesSeats(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("INSERT INTO businesses (name) VALUES ('Acme')")
+	exec("INSERT INTO users (email, password_hash, full_name, role, business_id) VALUES ('admin@example.com', 'x', 'Admin', 'business_admin', 1)")
+	exec("INSERT INTO services (name, duration, business_id, capacity) VALUES ('Class', 60, 1, 3)")
+	day := time.Now().UTC().Truncate(time.Hour).Add(72 * time.Hour)
+	for i, booked := range []int{2, 0, 2} {
+		start := day.Add(time.Duration(i) * time.Hour)
+		exec(`INSERT INTO appointment_slots (start_time, end_time, service_id, business_id, capacity, booked_count)
+			  VALUES ($1, $2, 1, 1, 3, $3)`, start, start.Add(time.Hour), booked)
+	}
+	exec(`INSERT INTO bookings (customer_name, customer_email, slot_id, seats, business_id)
+		  VALUES ('Ann', 'ann@example.com', 1, 2, 1)`)
+
+	gin.SetMode(gin.TestMode)
+	outbox := &notify.Outbox{DB: db}
+	router := gin.New()
+	router.Use(middleware.Errors())
+	businessID := 1
+	router.Use(func(c *gin.Context) {
+		c.Set("user", models.User{ID: 1, Role: "business_admin", BusinessID: &businessID})
+	})
+	router.POST("/bookings/:id/reschedule",
+		RescheduleBooking(db, outbox, &webhook.Publisher{DB: db}, waitlist.New(db, outbox)))
+
+	reschedule := func(slotID string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/bookings/1/reschedule", strings.NewReader(`{"slot_id": `+slotID+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	booked := func() [3]int {
+		t.Helper()
+		var counts [3]int
+		for i := range counts {
+			if err := db.QueryRow("SELECT booked_count FROM appointment_slots WHERE id = $1", i+1).Scan(&counts[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return counts
+	}
+
+	if code := reschedule("3"); code != http.StatusConflict {
+		t.Errorf("moving to a slot with one seat left answered %d, want 409", code)
+	}
+	if got := booked(); got != [3]int{2, 0, 2} {
+		t.Errorf("a refused move changed the seats taken to %v", got)
+	}
+
+	if code := reschedule("2"); code != http.StatusOK {
+		t.Fatalf("reschedule answered %d, want 200", code)
+	}
+	if got := booked(); got != [3]int{0, 2, 2} {
+		t.Errorf("seats taken after the move are %v, want [0 2 2]", got)
+	}
+	var slotID int
+	if err := db.QueryRow("SELECT slot_id FROM bookings WHERE id = 1").Scan(&slotID); err != nil {
+		t.Fatal(err)
+	}
+	if slotID != 2 {
+		t.Errorf("booking is in slot %d, want 2", slotID)
+	}
+}
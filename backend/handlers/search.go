@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/calsync"
+	"booking-backend/database"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Search page sizes
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+)
+
+// likePattern escapes the LIKE wildcards in user input; queries using it
+// declare ESCAPE '\'
+func likePattern(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// openSlots selects the bookable slots (alias s) of a business starting
+// in [$from, $to); business is the business ID expression
+func openSlots(business string, from, to int) string {
+	return fmt.Sprintf(` FROM appointment_slots s
+		WHERE s.business_id = %s AND s.is_available = true
+		AND s.start_time >= $%d AND s.start_time < $%d
+		AND `, business, from, to) + calsync.NotBusy + activeLocation("s.location_id")
+}
+
+// SearchBusinesses is the marketplace directory. ?q= matches business
+// names (best), categories, service names and descriptions; ?category=
+// and ?city= filter exactly (the city of the business or of one of its
+// locations), and ?date=YYYY-MM-DD keeps businesses with an open slot that
+// day, in ?tz= (default UTC). Pages are ?limit= and ?offset=.
+func SearchBusinesses(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. Parse the paging and date parameters
+		limit, offset := defaultSearchLimit, 0
+		var err error
+		if s := c.Query("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > maxSearchLimit {
+				c.Error(apierror.New(http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit)))
+				return
+			}
+		}
+		if s := c.Query("offset"); s != "" {
+			offset, err = strconv.Atoi(s)
+			if err != nil || offset < 0 {
+				c.Error(apierror.New(http.StatusBadRequest, "Invalid offset"))
+				return
+			}
+		}
+
+		now := time.Now().UTC()
+		from, to := now, now.AddDate(1, 0, 0)
+		dated := c.Query("date") != ""
+		if dated {
+			loc, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+			if err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "Unknown timezone"))
+				return
+			}
+			day, err := time.ParseInLocation("2006-01-02", c.Query("date"), loc)
+			if err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD"))
+				return
+			}
+			if day.After(from) {
+				from = day
+			}
+			to = day.AddDate(0, 0, 1)
+		}
+
+		// 2. Build the ranked query. Only businesses offering at least one
+		// service are listed.
+		var args []interface{}
+		score := "0"
+		if q := strings.ToLower(strings.TrimSpace(c.Query("q"))); q != "" {
+			args = append(args, q, likePattern(q)+"%", "%"+likePattern(q)+"%")
+			exact, prefix, contains := len(args)-2, len(args)-1, len(args)
+			score = fmt.Sprintf(`
+				CASE WHEN LOWER(b.name) = $%[1]d THEN 100
+				     WHEN LOWER(b.name) LIKE $%[2]d ESCAPE '\' THEN 60
+				     WHEN LOWER(b.name) LIKE $%[3]d ESCAPE '\' THEN 40
+				     ELSE 0 END
+				+ CASE WHEN b.category = $%[1]d THEN 30 ELSE 0 END
+				+ CASE WHEN EXISTS (
+					SELECT 1 FROM services sv WHERE sv.business_id = b.id AND LOWER(sv.name) LIKE $%[3]d ESCAPE '\'
+				  ) THEN 20 ELSE 0 END
+				+ CASE WHEN LOWER(COALESCE(b.description, '')) LIKE $%[3]d ESCAPE '\' THEN 10 ELSE 0 END`,
+				exact, prefix, contains)
+		}
+
+		where := " WHERE EXISTS (SELECT 1 FROM services sv WHERE sv.business_id = b.id" + activeLocation("sv.location_id") + ")"
+		if category := c.Query("category"); category != "" {
+			args = append(args, strings.ToLower(category))
+			where += fmt.Sprintf(" AND b.category = $%d", len(args))
+		}
+		if city := strings.TrimSpace(c.Query("city")); city != "" {
+			args = append(args, strings.ToLower(city))
+			where += fmt.Sprintf(` AND (LOWER(b.city) = $%[1]d OR EXISTS (
+				SELECT 1 FROM locations l WHERE l.business_id = b.id AND l.is_active = true AND LOWER(l.city) = $%[1]d
+			))`, len(args))
+		}
+		if dated {
+			args = append(args, from, to)
+			where += " AND EXISTS (SELECT 1" + openSlots("b.id", len(args)-1, len(args)) + ")"
+		}
+
+		// The search terms must match somewhere; without them every
+		// business scores 0
+		ranked := `SELECT * FROM (
+			SELECT b.id, b.slug, b.name, b.description, b.category, b.city, b.logo_url, ` + score + ` AS score
+			FROM businesses b` + where + `
+		) ranked`
+		if score != "0" {
+			ranked += " WHERE score > 0"
+		}
+
+		// 3. Count and fetch the page
+		var total int
+		if err := db.QueryRow("SELECT COUNT(*) FROM ("+ranked+") counted", args...).Scan(&total); err != nil {
+			c.Error(apierror.Internal(err, "Could not search businesses"))
+			return
+		}
+
+		pageArgs := append(args, limit, offset)
+		rows, err := db.Query(
+			ranked+fmt.Sprintf(" ORDER BY score DESC, name, id LIMIT $%d OFFSET $%d", len(pageArgs)-1, len(pageArgs)),
+			pageArgs...,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not search businesses"))
+			return
+		}
+		var ids []int
+		results := []models.BusinessSearchResult{}
+		for rows.Next() {
+			var id, rank int
+			var result models.BusinessSearchResult
+			var description, category, city, logoURL sql.NullString
+			if err := rows.Scan(&id, &result.Slug, &result.Name, &description, &category, &city, &logoURL, &rank); err != nil {
+				rows.Close()
+				c.Error(apierror.Internal(err, "Error reading businesses"))
+				return
+			}
+			result.Description = description.String
+			result.Category = category.String
+			result.City = city.String
+			result.LogoURL = logoURL.String
+			ids = append(ids, id)
+			results = append(results, result)
+		}
+		rows.Close()
+
+		// 4. Add each business's first open slot in the searched window
+		for i, id := range ids {
+			var start time.Time
+			err := db.QueryRow(
+				"SELECT s.start_time"+openSlots("$1", 2, 3)+" ORDER BY s.start_time LIMIT 1",
+				id, from, to,
+			).Scan(&start)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				c.Error(apierror.Internal(err, "Could not search businesses"))
+				return
+			}
+			results[i].NextAvailable = &start
+		}
+
+		response := models.BusinessSearchResponse{Results: results, Total: total, Limit: limit, Offset: offset}
+		if next := offset + len(results); next < total {
+			response.NextOffset = &next
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -2,27 +2,50 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"booking-backend/apierror"
+	"booking-backend/database"
 	"booking-backend/models"
+	"booking-backend/page"
+	"booking-backend/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Limits on service settings
+const (
+	maxCapacity = 1000    // seats in a service or slot
+	maxBuffer   = 24 * 60 // minutes after a service
+)
+
+const serviceColumns = "id, name, description, duration, price_cents, capacity, buffer_minutes, location_id"
+
+func scanService(row rowScanner) (models.ServiceResponse, error) {
+	var service models.ServiceResponse
+	var locationID sql.NullInt64
+	err := row.Scan(&service.ID, &service.Name, &service.Description, &service.Duration, &service.PriceCents,
+		&service.Capacity, &service.Buffer, &locationID)
+	service.LocationID = nullIntPtr(locationID)
+	return service, err
+}
+
 // CreateService handles creating a new service for a business
-func CreateService(db *sql.DB) gin.HandlerFunc {
+func CreateService(db *database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Get the business ID from the authenticated user (set by middleware)
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
 			return
 		}
 
 		currentUser := user.(models.User)
 		if currentUser.BusinessID == nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User is not associated with a business"})
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
 			return
 		}
 
@@ -31,20 +54,55 @@ func CreateService(db *sql.DB) gin.HandlerFunc {
 		// 2. Bind and validate the request data
 		var serviceReq models.CreateServiceRequest
 		if err := c.ShouldBindJSON(&serviceReq); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+			c.Error(apierror.Validation(err))
+			return
+		}
+		if serviceReq.Capacity == 0 {
+			serviceReq.Capacity = 1
+		}
+		if serviceReq.Capacity > maxCapacity {
+			c.Error(apierror.New(http.StatusBadRequest, fmt.Sprintf("capacity can be at most %d", maxCapacity)))
+			return
+		}
+		if serviceReq.Buffer > maxBuffer {
+			c.Error(apierror.New(http.StatusBadRequest, fmt.Sprintf("buffer_minutes can be at most %d", maxBuffer)))
+			return
+		}
+
+		// The service is offered at one of the user's locations
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		if serviceReq.LocationID == nil {
+			locationID, err := defaultLocation(db, businessID)
+			if scope != nil {
+				locationID, err = scope[0], nil
+			}
+			if err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "The business has no active location"))
+				return
+			}
+			serviceReq.LocationID = &locationID
+		}
+		var found int
+		err := db.QueryRow("SELECT 1 FROM locations WHERE id = $1 AND business_id = $2", *serviceReq.LocationID, businessID).Scan(&found)
+		if err != nil || !inScope(scope, sql.NullInt64{Int64: int64(*serviceReq.LocationID), Valid: true}) {
+			c.Error(apierror.New(http.StatusBadRequest, "Location not found"))
 			return
 		}
 
 		// 3. Create the service in the database
 		var serviceID int
-		err := db.QueryRow(
-			`INSERT INTO services (name, description, duration, business_id) 
-             VALUES ($1, $2, $3, $4) RETURNING id`,
-			serviceReq.Name, serviceReq.Description, serviceReq.Duration, businessID,
+		err = db.QueryRow(
+			`INSERT INTO services (name, description, duration, price_cents, capacity, buffer_minutes, location_id, business_id) 
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			serviceReq.Name, serviceReq.Description, serviceReq.Duration, serviceReq.PriceCents, serviceReq.Capacity, serviceReq.Buffer,
+			*serviceReq.LocationID, businessID,
 		).Scan(&serviceID)
 
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create service: " + err.Error()})
+			c.Error(apierror.Internal(err, "Could not create service"))
 			return
 		}
 
@@ -54,87 +112,139 @@ func CreateService(db *sql.DB) gin.HandlerFunc {
 			Name:        serviceReq.Name,
 			Description: serviceReq.Description,
 			Duration:    serviceReq.Duration,
+			PriceCents:  serviceReq.PriceCents,
+			Capacity:    serviceReq.Capacity,
+			Buffer:      serviceReq.Buffer,
+			LocationID:  serviceReq.LocationID,
 		})
 	}
 }
 
-// GetServices handles fetching all services for a business
-func GetServices(db *sql.DB) gin.HandlerFunc {
+// serviceSortKeys are the orders the business's service list can be
+// sorted in
+var serviceSortKeys = map[string]page.Key{
+	"name":        {Column: "name", Kind: page.String},
+	"duration":    {Column: "duration", Kind: page.Int},
+	"price_cents": {Column: "price_cents", Kind: page.Int},
+	"id":          {Column: "id", Kind: page.Int},
+}
+
+// GetServices handles fetching a page of the services of a business,
+// sorted by ?sort=name (default), duration, price_cents or id
+func GetServices(db *database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Get the business ID from the authenticated user
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
 			return
 		}
 
 		currentUser := user.(models.User)
 		if currentUser.BusinessID == nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User is not associated with a business"})
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
 			return
 		}
 
 		businessID := *currentUser.BusinessID
 
-		// 2. Query services for this business
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		filter, args, ok := locationFilter(c, "location_id", scope, []interface{}{businessID})
+		if !ok {
+			return
+		}
+
+		// 2. Count the services, then query the page after the cursor
+		req, ok := pageRequest(c, serviceSortKeys, "name", "id")
+		if !ok {
+			return
+		}
+		var total int
+		err := db.QueryRow("SELECT COUNT(*) FROM services WHERE business_id = $1"+filter, args...).Scan(&total)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch services"))
+			return
+		}
+		after, args, err := req.Where(args)
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+			return
+		}
 		rows, err := db.Query(
-			"SELECT id, name, description, duration FROM services WHERE business_id = $1 ORDER BY name",
-			businessID,
+			"SELECT "+serviceColumns+" FROM services WHERE business_id = $1"+filter+after+req.OrderBy(),
+			args...,
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch services"})
+			c.Error(apierror.Internal(err, "Could not fetch services"))
 			return
 		}
 		defer rows.Close()
 
 		// 3. Build the response
-		var services []models.ServiceResponse
+		result := models.Page{Total: total}
+		services := []models.ServiceResponse{}
 		for rows.Next() {
-			var service models.ServiceResponse
-			if err := rows.Scan(&service.ID, &service.Name, &service.Description, &service.Duration); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading services"})
+			service, err := scanService(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading services"))
 				return
 			}
+			if len(services) == req.Limit {
+				last := services[len(services)-1]
+				result.NextCursor = req.Next(map[string]interface{}{
+					"name": last.Name, "duration": last.Duration, "price_cents": last.PriceCents, "id": last.ID,
+				}, last.ID)
+				break
+			}
 			services = append(services, service)
 		}
+		result.Items = services
 
 		// 4. Return the services
-		c.JSON(http.StatusOK, services)
+		c.JSON(http.StatusOK, result)
 	}
 }
 
 // GetPublicServices gets services for public booking page
-func GetPublicServices(db *sql.DB) gin.HandlerFunc {
+func GetPublicServices(db *database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		businessID := c.Query("business_id")
-		if businessID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "business_id is required"})
+		bizID, ok := publicBusinessID(c, db)
+		if !ok {
 			return
 		}
 
-		bizID, err := strconv.Atoi(businessID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business_id"})
+		// Customers see the cancellation policy before they book
+		settings, err := loadBusinessSettings(db, bizID)
+		if err != nil && err != sql.ErrNoRows {
+			c.Error(apierror.Internal(err, "Could not fetch services"))
 			return
 		}
 
+		filter, args, ok := locationFilter(c, "location_id", nil, []interface{}{bizID})
+		if !ok {
+			return
+		}
 		rows, err := db.Query(
-			"SELECT id, name, description, duration FROM services WHERE business_id = $1 ORDER BY name",
-			bizID,
+			"SELECT "+serviceColumns+" FROM services WHERE business_id = $1"+filter+activeLocation("location_id")+" ORDER BY name",
+			args...,
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch services"})
+			c.Error(apierror.Internal(err, "Could not fetch services"))
 			return
 		}
 		defer rows.Close()
 
 		var services []models.ServiceResponse
 		for rows.Next() {
-			var service models.ServiceResponse
-			if err := rows.Scan(&service.ID, &service.Name, &service.Description, &service.Duration); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading services"})
+			service, err := scanService(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading services"))
 				return
 			}
+			service.CancellationPolicy = settings.CancellationText
 			services = append(services, service)
 		}
 
@@ -142,19 +252,21 @@ func GetPublicServices(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-// DeleteService handles deleting a service
-func DeleteService(db *sql.DB) gin.HandlerFunc {
+// DeleteService handles deleting a service. Upcoming bookings that
+// include it after their first service must be cancelled or rescheduled
+// first.
+func DeleteService(db *database.Store, hooks *webhook.Publisher) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Get the business ID from the authenticated user
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
 			return
 		}
 
 		currentUser := user.(models.User)
 		if currentUser.BusinessID == nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User is not associated with a business"})
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
 			return
 		}
 
@@ -163,26 +275,71 @@ func DeleteService(db *sql.DB) gin.HandlerFunc {
 		// 2. Get the service ID from URL parameter
 		serviceID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service ID"})
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid service ID"))
 			return
 		}
 
-		// 3. Delete the service (only if it belongs to the user's business)
-		result, err := db.Exec(
-			"DELETE FROM services WHERE id = $1 AND business_id = $2",
-			serviceID, businessID,
-		)
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+
+		tx, err := db.Begin()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not delete service"})
+			c.Error(apierror.Internal(err, "Could not start transaction"))
 			return
 		}
+		defer tx.Rollback()
 
-		// 4. Check if a service was actually deleted
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Service not found or you don't have permission"})
+		// 3. Refuse while upcoming multi-service bookings or holds include it
+		// as a following service
+		var planned int
+		now := time.Now()
+		err = tx.QueryRow(
+			`SELECT COUNT(*) FROM booking_services bs
+			 JOIN services sv ON bs.service_id = sv.id AND sv.business_id = $3
+			 LEFT JOIN bookings b ON bs.booking_id = b.id
+			 LEFT JOIN slot_holds h ON bs.hold_id = h.id
+			 WHERE bs.service_id = $1
+			 AND ((b.status = 'scheduled' AND bs.end_time > $2) OR h.expires_at > $2)`,
+			serviceID, now, businessID,
+		).Scan(&planned)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+		if planned > 0 {
+			c.Error(apierror.New(http.StatusConflict, "The service is part of upcoming bookings; cancel or reschedule them first"))
+			return
+		}
+
+		// 4. Delete the service (only if it belongs to the user's business
+		// and locations)
+		filter, args := scopeFilter("location_id", scope, []interface{}{serviceID, businessID})
+		var serviceName string
+		err = tx.QueryRow(
+			"DELETE FROM services WHERE id = $1 AND business_id = $2"+filter+" RETURNING name",
+			args...,
+		).Scan(&serviceName)
+
+		// 5. Check if a service was actually deleted
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Service not found or you don't have permission"))
 			return
 		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not delete service"))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		hooks.Publish(businessID, webhook.EventServiceDeleted, gin.H{
+			"id":   serviceID,
+			"name": serviceName,
+		})
 
 		c.JSON(http.StatusOK, gin.H{"message": "Service deleted successfully"})
 	}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RefreshToken exchanges a refresh token for a new access/refresh token pair
+func RefreshToken(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. Bind the refresh token
+		var refreshReq models.RefreshRequest
+		if err := c.ShouldBindJSON(&refreshReq); err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid input"))
+			return
+		}
+
+		// 2. Rotate it (the old token can't be used again)
+		userID, sessionID, refreshToken, err := auth.RotateRefreshToken(db, refreshReq.RefreshToken)
+		if err == auth.ErrInvalidRefreshToken || err == auth.ErrRefreshTokenReused {
+			c.Error(apierror.New(http.StatusUnauthorized, "Invalid or expired refresh token"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not refresh token"))
+			return
+		}
+
+		// 3. Reload the user so role/business changes are picked up
+		var user models.User
+		err = db.QueryRow(
+			"SELECT id, email, full_name, role, business_id, is_active FROM users WHERE id = $1",
+			userID,
+		).Scan(&user.ID, &user.Email, &user.FullName, &user.Role, &user.BusinessID, &user.IsActive)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+
+		// 4. Issue a new access token for the same session
+		accessToken, err := auth.IssueAccessToken(user, sessionID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not generate token"))
+			return
+		}
+
+		c.JSON(http.StatusOK, models.TokenResponse{
+			Token:        accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    int(auth.AccessTokenTTL.Seconds()),
+		})
+	}
+}
+
+// Logout revokes the current session, or every session of the user when
+// all_sessions is set
+func Logout(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+		currentUser := user.(models.User)
+
+		// The body is optional
+		var logoutReq models.LogoutRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&logoutReq); err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "Invalid input"))
+				return
+			}
+		}
+
+		var err error
+		if logoutReq.AllSessions {
+			err = auth.RevokeUserSessions(db, currentUser.ID, 0)
+		} else {
+			err = auth.RevokeSession(db, c.GetInt("session_id"))
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not log out"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	}
+}
+
+// ChangePassword updates the current user's password and ends all of
+// their other sessions
+func ChangePassword(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+		currentUser := user.(models.User)
+
+		// 1. Bind and validate the request data
+		var changeReq models.ChangePasswordRequest
+		if err := c.ShouldBindJSON(&changeReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		// 2. Check the current password
+		var passwordHash string
+		err := db.QueryRow("SELECT password_hash FROM users WHERE id = $1", currentUser.ID).Scan(&passwordHash)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.Error(apierror.New(http.StatusNotFound, "User not found"))
+			} else {
+				c.Error(apierror.Internal(err, "Database error"))
+			}
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(changeReq.CurrentPassword)) != nil {
+			c.Error(apierror.New(http.StatusUnauthorized, "Current password is incorrect"))
+			return
+		}
+
+		// 3. Hash the new password
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(changeReq.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not hash password"))
+			return
+		}
+
+		// 4. Save it and revoke every other session in one transaction
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		if _, err := tx.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", string(hashedPassword), currentUser.ID); err != nil {
+			c.Error(apierror.Internal(err, "Could not update password"))
+			return
+		}
+		if err := auth.RevokeUserSessions(tx, currentUser.ID, c.GetInt("session_id")); err != nil {
+			c.Error(apierror.Internal(err, "Could not revoke sessions"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed; other sessions have been logged out"})
+	}
+}
@@ -8,24 +8,31 @@ import (
 	"strings"
 	"time"
 
+	"booking-backend/apierror"
+	"booking-backend/calsync"
+	"booking-backend/database"
+	"booking-backend/hours"
 	"booking-backend/models"
+	"booking-backend/page"
+	"booking-backend/slots"
+	"booking-backend/webhook"
 
 	"github.com/gin-gonic/gin"
 )
 
 // GenerateSlots handles creating time slots for a service
-func GenerateSlots(db *sql.DB) gin.HandlerFunc {
+func GenerateSlots(db *database.Store, hooks *webhook.Publisher) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Get business ID from authenticated user
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
 			return
 		}
 
 		currentUser := user.(models.User)
 		if currentUser.BusinessID == nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User is not associated with a business"})
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
 			return
 		}
 		businessID := *currentUser.BusinessID
@@ -33,40 +40,98 @@ func GenerateSlots(db *sql.DB) gin.HandlerFunc {
 		// 2. Bind and validate request
 		var genReq models.GenerateSlotsRequest
 		if err := c.ShouldBindJSON(&genReq); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input: " + err.Error()})
+			c.Error(apierror.Validation(err))
 			return
 		}
 
 		// 3. Verify the service belongs to this business
 		var service models.Service
+		var capacity int
+		var locationID sql.NullInt64
 		err := db.QueryRow(
-			"SELECT id, name, duration FROM services WHERE id = $1 AND business_id = $2",
+			"SELECT id, name, duration, capacity, location_id FROM services WHERE id = $1 AND business_id = $2",
 			genReq.ServiceID, businessID,
-		).Scan(&service.ID, &service.Name, &service.Duration)
+		).Scan(&service.ID, &service.Name, &service.Duration, &capacity, &locationID)
 
 		if err != nil {
 			if err == sql.ErrNoRows {
-				c.JSON(http.StatusNotFound, gin.H{"error": "Service not found or access denied"})
+				c.Error(apierror.New(http.StatusNotFound, "Service not found or access denied"))
 			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				c.Error(apierror.Internal(err, "Database error"))
 			}
 			return
 		}
 
+		// Slots are generated at the service's location, in its timezone
+		// and opening hours
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		if !inScope(scope, locationID) {
+			c.Error(apierror.New(http.StatusNotFound, "Service not found or access denied"))
+			return
+		}
+		var location *models.Location
+		if locationID.Valid {
+			loaded, err := scanLocation(db.QueryRow(locationSelect+" WHERE id = $1", locationID.Int64))
+			if err != nil {
+				c.Error(apierror.Internal(err, "Database error"))
+				return
+			}
+			location = &loaded
+		}
+
+		// Slots get the service's capacity unless the request overrides it
+		if genReq.Capacity == 0 {
+			genReq.Capacity = capacity
+		}
+		if genReq.Capacity > maxCapacity {
+			c.Error(apierror.New(http.StatusBadRequest, fmt.Sprintf("capacity can be at most %d", maxCapacity)))
+			return
+		}
+
+		// The staff member, if any, must work for this business
+		if genReq.StaffID != nil {
+			var staffCount int
+			err := db.QueryRow(
+				"SELECT COUNT(*) FROM users WHERE id = $1 AND business_id = $2 AND role IN ('staff', 'business_admin') AND is_active = true",
+				*genReq.StaffID, businessID,
+			).Scan(&staffCount)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Database error"))
+				return
+			}
+			if staffCount == 0 {
+				c.Error(apierror.New(http.StatusBadRequest, "Staff member not found"))
+				return
+			}
+		}
+
 		// 4. Generate time slots
-		generatedSlots, err := generateTimeSlots(genReq, service.Duration, businessID, db)
+		generatedSlots, err := generateTimeSlots(genReq, service.Duration, businessID, location, db)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Could not generate slots: " + err.Error()})
+			c.Error(apierror.New(http.StatusBadRequest, "Could not generate slots: "+err.Error()))
 			return
 		}
 
 		// 5. Save slots to database
 		createdSlots, err := saveSlotsToDB(db, generatedSlots)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not save slots: " + err.Error()})
+			c.Error(apierror.Internal(err, "Could not save slots"))
 			return
 		}
 
+		// 6. Tell subscribed webhooks about the new slots
+		if len(createdSlots) > 0 {
+			hooks.Publish(businessID, webhook.EventSlotGenerated, gin.H{
+				"service_id":   service.ID,
+				"service_name": service.Name,
+				"count":        len(createdSlots),
+				"slots":        createdSlots,
+			})
+		}
+
 		c.JSON(http.StatusCreated, gin.H{
 			"message": fmt.Sprintf("Generated %d time slots", len(createdSlots)),
 			"slots":   createdSlots,
@@ -74,23 +139,22 @@ func GenerateSlots(db *sql.DB) gin.HandlerFunc {
 	}
 }
 
-// generateTimeSlots creates time slot objects based on the request
-func generateTimeSlots(req models.GenerateSlotsRequest, serviceDuration int, businessID int, db *sql.DB) ([]models.TimeSlot, error) {
+// generateTimeSlots creates time slot objects based on the request. At a
+// location with opening hours only slots within them are created;
+// otherwise every day but Sunday is open.
+func generateTimeSlots(req models.GenerateSlotsRequest, serviceDuration int, businessID int, location *models.Location, db *database.Store) ([]models.TimeSlot, error) {
 	var slots []models.TimeSlot
 
-	// 1. Get business timezone from database
-	var timezone string
-	err := db.QueryRow("SELECT timezone FROM businesses WHERE id = $1", businessID).Scan(&timezone)
-	if err != nil {
-		// Fallback to UTC if timezone not found
-		timezone = "UTC"
-	}
-
-	// 2. Load the timezone location
-	loc, err := time.LoadLocation(timezone)
-	if err != nil {
-		// Fallback to UTC if timezone is invalid
-		loc = time.UTC
+	// 1. Get the timezone of the location, or else of the business
+	loc, timezone := businessLocation(db, businessID)
+	var openingHours models.OpeningHours
+	var locationID *int
+	if location != nil {
+		if l, err := time.LoadLocation(location.Timezone); err == nil {
+			loc, timezone = l, location.Timezone
+		}
+		openingHours = location.OpeningHours
+		locationID = &location.ID
 	}
 
 	fmt.Printf("DEBUG: Using timezone %s for business %d\n", timezone, businessID)
@@ -112,8 +176,8 @@ func generateTimeSlots(req models.GenerateSlotsRequest, serviceDuration int, bus
 
 	currentDate := startDate
 	for currentDate.Before(endDate) {
-		// Skip Sundays
-		if currentDate.Weekday() == time.Sunday {
+		// Skip Sundays, unless opening hours say otherwise
+		if currentDate.Weekday() == time.Sunday && len(openingHours) == 0 {
 			currentDate = currentDate.AddDate(0, 0, 1)
 			continue
 		}
@@ -140,6 +204,10 @@ func generateTimeSlots(req models.GenerateSlotsRequest, serviceDuration int, bus
 			if slotEnd.After(endDateTime) {
 				break
 			}
+			if !hours.Contains(openingHours, currentSlotTime, slotEnd) {
+				currentSlotTime = currentSlotTime.Add(time.Minute * time.Duration(req.Interval+serviceDuration))
+				continue
+			}
 
 			// Convert to UTC for storage
 			slots = append(slots, models.TimeSlot{
@@ -148,6 +216,9 @@ func generateTimeSlots(req models.GenerateSlotsRequest, serviceDuration int, bus
 				IsAvailable: true,
 				ServiceID:   req.ServiceID,
 				BusinessID:  businessID,
+				StaffID:     req.StaffID,
+				Capacity:    req.Capacity,
+				LocationID:  locationID,
 			})
 
 			// Move to next potential slot time
@@ -161,8 +232,25 @@ func generateTimeSlots(req models.GenerateSlotsRequest, serviceDuration int, bus
 	return slots, nil
 }
 
+// businessLocation loads the timezone of a business, falling back to UTC
+func businessLocation(db *database.Store, businessID int) (*time.Location, string) {
+	var timezone string
+	err := db.QueryRow("SELECT timezone FROM businesses WHERE id = $1", businessID).Scan(&timezone)
+	if err != nil {
+		// Fallback to UTC if timezone not found
+		timezone = "UTC"
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		// Fallback to UTC if timezone is invalid
+		return time.UTC, "UTC"
+	}
+	return loc, timezone
+}
+
 // saveSlotsToDB inserts generated slots into the database
-func saveSlotsToDB(db *sql.DB, slots []models.TimeSlot) ([]models.TimeSlot, error) {
+func saveSlotsToDB(db *database.Store, slots []models.TimeSlot) ([]models.TimeSlot, error) {
 	var createdSlots []models.TimeSlot
 
 	tx, err := db.Begin()
@@ -174,9 +262,9 @@ func saveSlotsToDB(db *sql.DB, slots []models.TimeSlot) ([]models.TimeSlot, erro
 	for _, slot := range slots {
 		var slotID int
 		err := tx.QueryRow(
-			`INSERT INTO appointment_slots (start_time, end_time, is_available, service_id, business_id) 
-             VALUES ($1, $2, $3, $4, $5) RETURNING id`,
-			slot.StartTime, slot.EndTime, slot.IsAvailable, slot.ServiceID, slot.BusinessID,
+			`INSERT INTO appointment_slots (start_time, end_time, is_available, service_id, business_id, staff_id, capacity, location_id) 
+             VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
+			slot.StartTime, slot.EndTime, slot.IsAvailable, slot.ServiceID, slot.BusinessID, slot.StaffID, slot.Capacity, slot.LocationID,
 		).Scan(&slotID)
 
 		if err != nil {
@@ -194,112 +282,210 @@ func saveSlotsToDB(db *sql.DB, slots []models.TimeSlot) ([]models.TimeSlot, erro
 	return createdSlots, nil
 }
 
-// GetBusinessSlots gets all slots for a business (admin view)
-func GetBusinessSlots(db *sql.DB) gin.HandlerFunc {
+// slotSortKeys are the orders the business's slot list can be sorted in
+var slotSortKeys = map[string]page.Key{
+	"start_time": {Column: "s.start_time", Kind: page.Time},
+	"id":         {Column: "s.id", Kind: page.Int},
+}
+
+// GetBusinessSlots gets a page of the slots of a business (admin view),
+// sorted by ?sort=start_time (default), -start_time, id or -id
+func GetBusinessSlots(db *database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := c.Get("user")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
 			return
 		}
 
 		currentUser := user.(models.User)
 		if currentUser.BusinessID == nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "User is not associated with a business"})
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
 			return
 		}
 		businessID := *currentUser.BusinessID
 
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+
+		// 1. Filters: location, ?service_id=, ?from=/?to= on the start
+		// time and ?available=true|false
+		filter, args, ok := locationFilter(c, "s.location_id", scope, []interface{}{businessID})
+		if !ok {
+			return
+		}
+		more, args, ok := intFilter(c, "service_id", "s.service_id", args)
+		if !ok {
+			return
+		}
+		filter += more
+		loc, _ := businessLocation(db, businessID)
+		more, args, ok = timeRangeFilter(c, "s.start_time", loc, args)
+		if !ok {
+			return
+		}
+		filter += more
+		if available := c.Query("available"); available != "" {
+			value, err := strconv.ParseBool(available)
+			if err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "available must be true or false"))
+				return
+			}
+			args = append(args, value)
+			filter += fmt.Sprintf(" AND s.is_available = $%d", len(args))
+		}
+
+		// 2. Count the matches, then fetch the page after the cursor
+		req, ok := pageRequest(c, slotSortKeys, "start_time", "s.id")
+		if !ok {
+			return
+		}
+		var total int
+		err := db.QueryRow("SELECT COUNT(*) FROM appointment_slots s WHERE s.business_id = $1"+filter, args...).Scan(&total)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch slots"))
+			return
+		}
+		after, args, err := req.Where(args)
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+			return
+		}
+
 		rows, err := db.Query(`
-            SELECT s.id, s.start_time, s.end_time, s.is_available, s.service_id, sv.name as service_name
+            SELECT s.id, s.start_time, s.end_time, s.is_available, s.service_id, sv.name as service_name, s.staff_id, s.capacity, s.booked_count, s.location_id
             FROM appointment_slots s
             JOIN services sv ON s.service_id = sv.id
-            WHERE s.business_id = $1
-            ORDER BY s.start_time
-        `, businessID)
+            WHERE s.business_id = $1`+filter+after+req.OrderBy(), args...)
 
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch slots"})
+			c.Error(apierror.Internal(err, "Could not fetch slots"))
 			return
 		}
 		defer rows.Close()
 
-		var slots []map[string]interface{}
+		result := models.Page{Total: total}
+		slots := []map[string]interface{}{}
 		for rows.Next() {
 			var slot models.TimeSlot
 			var serviceName string
-			if err := rows.Scan(&slot.ID, &slot.StartTime, &slot.EndTime, &slot.IsAvailable, &slot.ServiceID, &serviceName); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading slots"})
+			var staffID, locationID sql.NullInt64
+			if err := rows.Scan(&slot.ID, &slot.StartTime, &slot.EndTime, &slot.IsAvailable, &slot.ServiceID, &serviceName, &staffID, &slot.Capacity, &slot.BookedCount, &locationID); err != nil {
+				c.Error(apierror.Internal(err, "Error reading slots"))
 				return
 			}
+			if len(slots) == req.Limit {
+				// The extra row: there is a next page
+				last := slots[len(slots)-1]
+				result.NextCursor = req.Next(last, last["id"].(int))
+				break
+			}
 
-			slots = append(slots, map[string]interface{}{
+			entry := map[string]interface{}{
 				"id":           slot.ID,
 				"start_time":   slot.StartTime,
 				"end_time":     slot.EndTime,
 				"is_available": slot.IsAvailable,
 				"service_id":   slot.ServiceID,
 				"service_name": serviceName,
-			})
+				"capacity":     slot.Capacity,
+				"booked_count": slot.BookedCount,
+			}
+			if staffID.Valid {
+				entry["staff_id"] = staffID.Int64
+			}
+			if locationID.Valid {
+				entry["location_id"] = locationID.Int64
+			}
+			slots = append(slots, entry)
 		}
+		result.Items = slots
 
-		c.JSON(http.StatusOK, slots)
+		c.JSON(http.StatusOK, result)
 	}
 }
 
 // GetPublicSlots gets available slots for public booking
-func GetPublicSlots(db *sql.DB) gin.HandlerFunc {
+func GetPublicSlots(db *database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		businessIDStr := c.Query("business_id")
 		serviceIDStr := c.Query("service_id")
 		dateStr := c.Query("date")
 
-		if businessIDStr == "" || serviceIDStr == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "business_id and service_id are required"})
+		// Several services back to back are asked for as an ordered list;
+		// the slots are those of the first one. Each slot is checked
+		// against the following services, so this is limited to one day.
+		var serviceIDs []int
+		if list := c.Query("service_ids"); list != "" {
+			if dateStr == "" {
+				c.Error(apierror.New(http.StatusBadRequest, "date is required with service_ids"))
+				return
+			}
+			for _, part := range strings.Split(list, ",") {
+				id, err := strconv.Atoi(strings.TrimSpace(part))
+				if err != nil {
+					c.Error(apierror.New(http.StatusBadRequest, "Invalid service_ids"))
+					return
+				}
+				serviceIDs = append(serviceIDs, id)
+			}
+			serviceIDStr = strconv.Itoa(serviceIDs[0])
+		}
+
+		if serviceIDStr == "" {
+			c.Error(apierror.New(http.StatusBadRequest, "service_id is required"))
 			return
 		}
 
-		businessID, err := strconv.Atoi(businessIDStr)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business_id"})
+		businessID, ok := publicBusinessID(c, db)
+		if !ok {
 			return
 		}
 
 		serviceID, err := strconv.Atoi(serviceIDStr)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service_id"})
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid service_id"))
 			return
 		}
 
-		var query string
-		var args []interface{}
+		// Only future slots are offered. Timestamps are compared as
+		// parameters (not NOW()/AT TIME ZONE) so the query runs unchanged
+		// on every storage backend.
+		now := time.Now().UTC()
+
+		query := `
+			SELECT s.id, s.start_time, s.end_time, sv.name as service_name, sv.duration, s.capacity, s.capacity - s.booked_count
+			FROM appointment_slots s
+			JOIN services sv ON s.service_id = sv.id
+			WHERE s.business_id = $1 AND s.service_id = $2
+			AND s.is_available = true
+			AND s.start_time > $3
+			AND ` + calsync.NotBusy + activeLocation("s.location_id")
+		args := []interface{}{businessID, serviceID, now}
 
 		if dateStr != "" {
-			query = `
-                SELECT s.id, s.start_time, s.end_time, sv.name as service_name, sv.duration
-                FROM appointment_slots s
-                JOIN services sv ON s.service_id = sv.id
-                WHERE s.business_id = $1 AND s.service_id = $2 
-                AND s.is_available = true
-                AND DATE(s.start_time) = $3
-                ORDER BY s.start_time
-            `
-			args = []interface{}{businessID, serviceID, dateStr}
-		} else {
-			query = `
-				SELECT s.id, s.start_time, s.end_time, sv.name as service_name, sv.duration
-				FROM appointment_slots s
-				JOIN services sv ON s.service_id = sv.id
-				WHERE s.business_id = $1 AND s.service_id = $2 
-				AND s.is_available = true
-				AND s.start_time AT TIME ZONE 'UTC' > NOW() AT TIME ZONE 'UTC'
-				ORDER BY s.start_time
-			`
-			args = []interface{}{businessID, serviceID}
+			// The date is a calendar day in the timezone of the service's
+			// location; a slot at midnight belongs to it
+			loc := serviceTimezone(db, businessID, serviceID)
+			day, err := time.ParseInLocation("2006-01-02", dateStr, loc)
+			if err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD"))
+				return
+			}
+			query += " AND s.start_time >= $4 AND s.start_time < $5"
+			args = append(args, day, day.AddDate(0, 0, 1))
+		}
+		filter, args, ok := locationFilter(c, "s.location_id", nil, args)
+		if !ok {
+			return
 		}
+		query += filter
+		query += " ORDER BY s.start_time"
+
 		rows, err := db.Query(query, args...)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not fetch available slots"})
+			c.Error(apierror.Internal(err, "Could not fetch available slots"))
 			return
 		}
 		defer rows.Close()
@@ -307,14 +493,61 @@ func GetPublicSlots(db *sql.DB) gin.HandlerFunc {
 		var slots []models.PublicTimeSlot
 		for rows.Next() {
 			var slot models.PublicTimeSlot
-			if err := rows.Scan(&slot.ID, &slot.StartTime, &slot.EndTime, &slot.ServiceName, &slot.Duration); err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading slots"})
+			if err := rows.Scan(&slot.ID, &slot.StartTime, &slot.EndTime, &slot.ServiceName, &slot.Duration, &slot.Capacity, &slot.SeatsLeft); err != nil {
+				c.Error(apierror.Internal(err, "Error reading slots"))
 				return
 			}
 			slot.ServiceID = serviceID
 			slots = append(slots, slot)
 		}
+		rows.Close()
+
+		if len(serviceIDs) > 1 {
+			slots, err = fitServices(db, slots, businessID, serviceIDs)
+			if err != nil {
+				planError(c, err)
+				return
+			}
+		}
 
 		c.JSON(http.StatusOK, slots)
 	}
 }
+
+// fitServices keeps the slots after which the following services fit back
+// to back, with each slot's times and duration covering all of them
+func fitServices(db *database.Store, candidates []models.PublicTimeSlot, businessID int, serviceIDs []int) ([]models.PublicTimeSlot, error) {
+	fitting := []models.PublicTimeSlot{}
+	for _, candidate := range candidates {
+		slot := models.TimeSlot{
+			ID:         candidate.ID,
+			StartTime:  candidate.StartTime,
+			EndTime:    candidate.EndTime,
+			ServiceID:  serviceIDs[0],
+			BusinessID: businessID,
+		}
+		plan, err := slots.Plan(db, slot, serviceIDs)
+		if err != nil {
+			return nil, err
+		}
+		end := slots.End(plan)
+		ok, err := slots.Fits(db, slot.ID, slot.EndTime, end)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		names := make([]string, len(plan))
+		for i, item := range plan {
+			names[i] = item.ServiceName
+		}
+		candidate.ServiceName = strings.Join(names, " + ")
+		candidate.EndTime = end
+		candidate.Duration = int(end.Sub(candidate.StartTime) / time.Minute)
+		candidate.Services = plan
+		fitting = append(fitting, candidate)
+	}
+	return fitting, nil
+}
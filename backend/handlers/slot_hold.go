@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/models"
+	"booking-backend/slothold"
+	"booking-backend/slots"
+	"booking-backend/waitlist"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HoldSlot reserves seats in an available slot for a few minutes while the
+// customer fills in their details. Booking them requires the returned hold
+// token. When several services are booked back to back, the time they need
+// after the slot is held too.
+func HoldSlot(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		slotID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid slot ID"))
+			return
+		}
+
+		// The body is optional: without one a single seat is held
+		var holdReq models.HoldSlotRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&holdReq); err != nil {
+				c.Error(apierror.Validation(err))
+				return
+			}
+		}
+		if holdReq.Seats == 0 {
+			holdReq.Seats = 1
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		// 1. Take the seats. The conditional update makes sure no more seats
+		// are held than the slot has, and not while the staff member is busy.
+		now := time.Now()
+		slot, ok, err := slots.Take(tx, slotID, holdReq.Seats, now)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not hold slot"))
+			return
+		}
+		if !ok {
+			c.Error(apierror.New(http.StatusConflict, "Not enough seats left in this slot").WithCode(apierror.CodeSlotUnavailable))
+			return
+		}
+
+		// 2. Record the hold
+		token, _, err := auth.NewOpaqueToken()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not hold slot"))
+			return
+		}
+		hold := models.SlotHold{SlotID: slotID, Seats: holdReq.Seats, Token: token, ExpiresAt: now.Add(slothold.Duration)}
+		var holdID int
+		err = tx.QueryRow(
+			"INSERT INTO slot_holds (slot_id, token, seats, expires_at, created_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			slotID, token, hold.Seats, hold.ExpiresAt, now,
+		).Scan(&holdID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not hold slot"))
+			return
+		}
+
+		// 3. Hold the time the following services need
+		if len(holdReq.ServiceIDs) > 0 {
+			plan, err := slots.Plan(tx, slot, holdReq.ServiceIDs)
+			if err != nil {
+				planError(c, err)
+				return
+			}
+			if len(plan) > 1 {
+				ok, err := slots.Block(tx, slots.Hold(holdID), slotID, slot.EndTime, slots.End(plan), now)
+				if err != nil {
+					c.Error(apierror.Internal(err, "Could not hold slot"))
+					return
+				}
+				if !ok {
+					c.Error(apierror.New(http.StatusConflict, "There isn't enough free time after this slot for these services").WithCode(apierror.CodeSlotUnavailable))
+					return
+				}
+				if err := slots.SavePlan(tx, slots.Hold(holdID), plan); err != nil {
+					c.Error(apierror.Internal(err, "Could not hold slot"))
+					return
+				}
+				hold.Services = plan
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusCreated, hold)
+	}
+}
+
+// planError answers a request whose service list can't be planned
+func planError(c *gin.Context, err error) {
+	switch err {
+	case slots.ErrNotSlotService, slots.ErrUnknownService, slots.ErrTooManyServices:
+		c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+	default:
+		c.Error(apierror.Internal(err, "Could not look up services"))
+	}
+}
+
+// ReleaseSlotHold gives held seats back, e.g. when the customer picks
+// another slot
+func ReleaseSlotHold(db *database.Store, wl *waitlist.Waitlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		slotID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid slot ID"))
+			return
+		}
+
+		var releaseReq models.ReleaseSlotHoldRequest
+		if err := c.ShouldBindJSON(&releaseReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		var holdID, seats int
+		err = tx.QueryRow(
+			"SELECT id, seats FROM slot_holds WHERE slot_id = $1 AND token = $2 FOR UPDATE",
+			slotID, releaseReq.HoldToken,
+		).Scan(&holdID, &seats)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Hold not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not release slot"))
+			return
+		}
+		freed, err := slothold.Release(tx, holdID, slotID, seats)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not release slot"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+		for _, id := range freed {
+			wl.SlotFreed(id)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Slot released"})
+	}
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// CreateStaff adds a staff member to the admin's business
+func CreateStaff(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. Get the business ID from the authenticated user
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		// 2. Bind and validate the request data
+		var staffReq models.CreateStaffRequest
+		if err := c.ShouldBindJSON(&staffReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		// 3. Check if email already exists
+		var existingID int
+		err := db.QueryRow("SELECT id FROM users WHERE email = $1", staffReq.Email).Scan(&existingID)
+		if err == nil {
+			c.Error(apierror.New(http.StatusConflict, "Email already exists").WithCode(apierror.CodeEmailTaken))
+			return
+		}
+
+		// 4. Hash the password
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(staffReq.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not hash password"))
+			return
+		}
+
+		// 5. Create the staff user
+		var staffID int
+		err = db.QueryRow(
+			`INSERT INTO users (email, password_hash, full_name, role, business_id)
+             VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			staffReq.Email, string(hashedPassword), staffReq.FullName, "staff", businessID,
+		).Scan(&staffID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create staff member"))
+			return
+		}
+
+		c.JSON(http.StatusCreated, models.User{
+			ID:         staffID,
+			Email:      staffReq.Email,
+			FullName:   staffReq.FullName,
+			Role:       "staff",
+			BusinessID: &businessID,
+			IsActive:   true,
+		})
+	}
+}
+
+// GetStaff lists the users of the admin's business
+func GetStaff(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		rows, err := db.Query(
+			"SELECT id, email, full_name, role, business_id, is_active FROM users WHERE business_id = $1 ORDER BY full_name",
+			businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch staff"))
+			return
+		}
+		defer rows.Close()
+
+		var staff []models.User
+		for rows.Next() {
+			var member models.User
+			if err := rows.Scan(&member.ID, &member.Email, &member.FullName, &member.Role, &member.BusinessID, &member.IsActive); err != nil {
+				c.Error(apierror.Internal(err, "Error reading staff"))
+				return
+			}
+			staff = append(staff, member)
+		}
+
+		c.JSON(http.StatusOK, staff)
+	}
+}
+
+// SetStaffActive returns a handler that activates or deactivates a staff
+// member. Deactivating also revokes every session the user has, so their
+// access ends immediately instead of when the access token expires.
+func SetStaffActive(db *database.Store, active bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		staffID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid staff ID"))
+			return
+		}
+		if staffID == currentUser.ID {
+			c.Error(apierror.New(http.StatusBadRequest, "You cannot change your own account status"))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		// Only users of the admin's own business can be changed
+		result, err := tx.Exec(
+			"UPDATE users SET is_active = $1 WHERE id = $2 AND business_id = $3",
+			active, staffID, businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not update staff member"))
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			c.Error(apierror.New(http.StatusNotFound, "Staff member not found or you don't have permission"))
+			return
+		}
+
+		if !active {
+			if err := auth.RevokeUserSessions(tx, staffID, 0); err != nil {
+				c.Error(apierror.Internal(err, "Could not revoke sessions"))
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		if active {
+			c.JSON(http.StatusOK, gin.H{"message": "Staff member activated"})
+		} else {
+			c.JSON(http.StatusOK, gin.H{"message": "Staff member deactivated"})
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
+	"booking-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// totpIssuer names the app in authenticator apps
+const totpIssuer = "Booking"
+
+// finishLogin answers a login whose first step (password or provider)
+// succeeded: with the tokens, or with an MFA challenge when the user has
+// two-factor authentication or their business requires it
+func finishLogin(q database.Querier, user models.User, ip string) (models.LoginResponse, error) {
+	state, err := auth.LoadTwoFactorState(q, user.ID)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	user.TwoFactor = state.Enabled
+
+	if state.Enabled || state.Required {
+		token, err := auth.CreateUserToken(q, user.ID, auth.PurposeMFAChallenge, auth.MFAChallengeTTL)
+		if err != nil {
+			return models.LoginResponse{}, err
+		}
+		message := "Enter the code from your authenticator app"
+		if !state.Enabled {
+			message = "Your business requires two-factor authentication; set it up to continue"
+		}
+		return models.LoginResponse{
+			Message:          message,
+			MFARequired:      true,
+			MFASetupRequired: !state.Enabled,
+			MFAToken:         token,
+		}, nil
+	}
+
+	if err := auth.ResetFailedLogins(q, user.ID, ip); err != nil {
+		return models.LoginResponse{}, err
+	}
+	tokens, err := startSession(q, user)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	return models.LoginResponse{
+		Message:      "Login successful",
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         &user,
+	}, nil
+}
+
+// loadLoginUser reads the user a login is for
+func loadLoginUser(q database.Querier, userID int) (models.User, error) {
+	var user models.User
+	var verifiedAt, totpEnabledAt sql.NullTime
+	err := q.QueryRow(
+		"SELECT id, email, full_name, role, business_id, is_active, email_verified_at, totp_enabled_at FROM users WHERE id = $1",
+		userID,
+	).Scan(&user.ID, &user.Email, &user.FullName, &user.Role, &user.BusinessID, &user.IsActive, &verifiedAt, &totpEnabledAt)
+	user.EmailVerified = verifiedAt.Valid
+	user.TwoFactor = totpEnabledAt.Valid
+	return user, err
+}
+
+// LoginMFA is the second step of logging in: the MFA token from the first
+// step and a code from the authenticator app or a recovery code. Users who
+// had to set up two-factor authentication (see SetupLoginMFA) confirm it
+// with their first code and get their recovery codes.
+func LoginMFA(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. Bind JSON input
+		var mfaReq models.MFALoginRequest
+		if err := c.ShouldBindJSON(&mfaReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback() // a wrong code leaves the MFA token usable
+
+		// 2. Use up the MFA token
+		userID, err := auth.ConsumeUserToken(tx, auth.PurposeMFAChallenge, mfaReq.MFAToken)
+		if err == auth.ErrInvalidUserToken {
+			c.Error(apierror.New(http.StatusUnauthorized, "The login has expired, please log in again"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not verify code"))
+			return
+		}
+
+		// 3. Check the code, turning 2FA on if this finishes its setup.
+		// Wrong codes count towards a lockout like wrong passwords; the
+		// password was right, so the lockout can be told.
+		now := time.Now()
+		ip := c.ClientIP()
+		lockedUntil, err := auth.LockedUntil(tx, userID, ip, now)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not verify code"))
+			return
+		}
+		if !lockedUntil.IsZero() {
+			c.Error(accountLocked(lockedUntil, now))
+			return
+		}
+		state, err := auth.LoadTwoFactorState(tx, userID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not verify code"))
+			return
+		}
+		var recoveryCodes []string
+		if state.Enabled {
+			err = auth.VerifySecondFactor(tx, userID, mfaReq.Code, now)
+		} else {
+			recoveryCodes, err = auth.EnableTOTP(tx, userID, mfaReq.Code, now)
+		}
+		switch err {
+		case nil:
+		case auth.ErrInvalidSecondFactor:
+			tx.Rollback()
+			if err := auth.RecordFailedLogin(db, userID, ip, now); err != nil {
+				c.Error(apierror.Internal(err, "Could not verify code"))
+				return
+			}
+			c.Error(apierror.New(http.StatusUnauthorized, "Invalid authentication code"))
+			return
+		case auth.ErrTOTPNotSetUp:
+			c.Error(apierror.New(http.StatusConflict, "Set up two-factor authentication first"))
+			return
+		default:
+			c.Error(apierror.Internal(err, "Could not verify code"))
+			return
+		}
+
+		// 4. Start a session like Login
+		user, err := loadLoginUser(tx, userID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+		if !user.IsActive {
+			c.Error(apierror.New(http.StatusForbidden, "Account is deactivated"))
+			return
+		}
+		if err := auth.ResetFailedLogins(tx, userID, ip); err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			return
+		}
+		tokens, err := startSession(tx, user)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not generate token"))
+			return
+		}
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, models.LoginResponse{
+			Message:       "Login successful",
+			Token:         tokens.Token,
+			RefreshToken:  tokens.RefreshToken,
+			ExpiresIn:     tokens.ExpiresIn,
+			User:          &user,
+			RecoveryCodes: recoveryCodes,
+		})
+	}
+}
+
+// SetupLoginMFA gives users whose business requires two-factor
+// authentication a secret for their authenticator app while logging in.
+// They confirm it with their first code at LoginMFA.
+func SetupLoginMFA(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var setupReq models.MFASetupLoginRequest
+		if err := c.ShouldBindJSON(&setupReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		userID, err := auth.CheckUserToken(db, auth.PurposeMFAChallenge, setupReq.MFAToken)
+		if err == auth.ErrInvalidUserToken {
+			c.Error(apierror.New(http.StatusUnauthorized, "The login has expired, please log in again"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not set up two-factor authentication"))
+			return
+		}
+
+		state, err := auth.LoadTwoFactorState(db, userID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not set up two-factor authentication"))
+			return
+		}
+		if state.Enabled {
+			c.Error(apierror.New(http.StatusConflict, "Two-factor authentication is already on"))
+			return
+		}
+
+		setupTOTP(c, db, userID)
+	}
+}
+
+// setupTOTP gives the user a new secret and answers with it
+func setupTOTP(c *gin.Context, db *database.Store, userID int) {
+	var email string
+	if err := db.QueryRow("SELECT email FROM users WHERE id = $1", userID).Scan(&email); err != nil {
+		c.Error(apierror.Internal(err, "Could not set up two-factor authentication"))
+		return
+	}
+	secret, err := auth.StartTOTPSetup(db, userID)
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not set up two-factor authentication"))
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TOTPSetupResponse{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(secret, totpIssuer, email),
+	})
+}
+
+// SetupTwoFactor starts turning on two-factor authentication for the
+// current user. It is on once EnableTwoFactor gets a code.
+func SetupTwoFactor(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+		currentUser := user.(models.User)
+
+		state, err := auth.LoadTwoFactorState(db, currentUser.ID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not set up two-factor authentication"))
+			return
+		}
+		if state.Enabled {
+			c.Error(apierror.New(http.StatusConflict, "Two-factor authentication is already on"))
+			return
+		}
+
+		setupTOTP(c, db, currentUser.ID)
+	}
+}
+
+// EnableTwoFactor turns on two-factor authentication with the first code
+// from the authenticator app and returns the recovery codes
+func EnableTwoFactor(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+		currentUser := user.(models.User)
+
+		var codeReq models.TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&codeReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		state, err := auth.LoadTwoFactorState(tx, currentUser.ID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not enable two-factor authentication"))
+			return
+		}
+		if state.Enabled {
+			c.Error(apierror.New(http.StatusConflict, "Two-factor authentication is already on"))
+			return
+		}
+
+		codes, err := auth.EnableTOTP(tx, currentUser.ID, codeReq.Code, time.Now())
+		switch err {
+		case nil:
+		case auth.ErrInvalidSecondFactor:
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid authentication code"))
+			return
+		case auth.ErrTOTPNotSetUp:
+			c.Error(apierror.New(http.StatusConflict, "Set up two-factor authentication first"))
+			return
+		default:
+			c.Error(apierror.Internal(err, "Could not enable two-factor authentication"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+			Message:       "Two-factor authentication is on; keep the recovery codes somewhere safe",
+			RecoveryCodes: codes,
+		})
+	}
+}
+
+// DisableTwoFactor turns off two-factor authentication, confirmed with a
+// code. Users whose business requires it can't.
+func DisableTwoFactor(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+		currentUser := user.(models.User)
+
+		var codeReq models.TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&codeReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, ok := verifyTwoFactorChange(c, db, currentUser, codeReq.Code)
+		if !ok {
+			return
+		}
+		defer tx.Rollback()
+
+		state, err := auth.LoadTwoFactorState(tx, currentUser.ID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not disable two-factor authentication"))
+			return
+		}
+		if state.Required {
+			c.Error(apierror.New(http.StatusForbidden, "Your business requires two-factor authentication"))
+			return
+		}
+		if err := auth.DisableTOTP(tx, currentUser.ID); err != nil {
+			c.Error(apierror.Internal(err, "Could not disable two-factor authentication"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication is off"})
+	}
+}
+
+// RegenerateRecoveryCodes replaces the current user's recovery codes,
+// confirmed with a code
+func RegenerateRecoveryCodes(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+		currentUser := user.(models.User)
+
+		var codeReq models.TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&codeReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		tx, ok := verifyTwoFactorChange(c, db, currentUser, codeReq.Code)
+		if !ok {
+			return
+		}
+		defer tx.Rollback()
+
+		codes, err := auth.NewRecoveryCodes(tx, currentUser.ID, time.Now())
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create recovery codes"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+			Message:       "New recovery codes; the old ones no longer work",
+			RecoveryCodes: codes,
+		})
+	}
+}
+
+// verifyTwoFactorChange starts a transaction and checks the user's code in
+// it. On failure the error has been reported and there is no transaction.
+func verifyTwoFactorChange(c *gin.Context, db *database.Store, user models.User, code string) (*database.Tx, bool) {
+	tx, err := db.Begin()
+	if err != nil {
+		c.Error(apierror.Internal(err, "Could not start transaction"))
+		return nil, false
+	}
+
+	err = auth.VerifySecondFactor(tx, user.ID, code, time.Now())
+	switch err {
+	case nil:
+		return tx, true
+	case auth.ErrInvalidSecondFactor:
+		c.Error(apierror.New(http.StatusBadRequest, "Invalid authentication code"))
+	case auth.ErrTOTPNotSetUp:
+		c.Error(apierror.New(http.StatusConflict, "Two-factor authentication is off"))
+	default:
+		c.Error(apierror.Internal(err, "Could not verify code"))
+	}
+	tx.Rollback()
+	return nil, false
+}
@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/calsync"
+	"booking-backend/database"
+	"booking-backend/models"
+	"booking-backend/notify"
+	"booking-backend/waitlist"
+	"booking-backend/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+const waitlistSelect = `
+	SELECT w.id, w.service_id, sv.name, w.customer_name, w.customer_email, w.window_start, w.window_end, w.notes, w.status,
+	       w.offered_slot_id, s.start_time, w.offer_expires_at, w.booking_id, w.created_at
+	FROM waitlist_entries w
+	JOIN services sv ON w.service_id = sv.id
+	LEFT JOIN appointment_slots s ON w.offered_slot_id = s.id
+`
+
+func scanWaitlistEntry(row rowScanner) (models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	var notes sql.NullString
+	var slotID, bookingID sql.NullInt64
+	var offeredStart, expires sql.NullTime
+	err := row.Scan(&entry.ID, &entry.ServiceID, &entry.ServiceName, &entry.CustomerName, &entry.CustomerEmail,
+		&entry.WindowStart, &entry.WindowEnd, &notes, &entry.Status, &slotID, &offeredStart, &expires, &bookingID, &entry.CreatedAt)
+	entry.Notes = notes.String
+	entry.OfferedSlotID = nullIntPtr(slotID)
+	entry.BookingID = nullIntPtr(bookingID)
+	if offeredStart.Valid {
+		entry.OfferedStart = &offeredStart.Time
+	}
+	if expires.Valid {
+		entry.OfferExpiresAt = &expires.Time
+	}
+	return entry, err
+}
+
+// JoinWaitlist puts a customer on the waitlist for a service on a day
+// (optionally between two times) that has no free slots left
+func JoinWaitlist(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 1. Bind and validate the request data
+		var joinReq models.JoinWaitlistRequest
+		if err := c.ShouldBindJSON(&joinReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		// 2. Work out the window in the timezone of the service's location
+		loc := serviceTimezone(db, joinReq.BusinessID, joinReq.ServiceID)
+		day, err := time.ParseInLocation("2006-01-02", joinReq.Date, loc)
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD"))
+			return
+		}
+		windowStart, windowEnd := day, day.AddDate(0, 0, 1)
+		if joinReq.FromTime != "" {
+			if windowStart, err = atTimeOfDay(day, joinReq.FromTime); err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "Invalid from_time, expected HH:MM"))
+				return
+			}
+		}
+		if joinReq.ToTime != "" {
+			if windowEnd, err = atTimeOfDay(day, joinReq.ToTime); err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, "Invalid to_time, expected HH:MM"))
+				return
+			}
+		}
+		now := time.Now()
+		if !windowEnd.After(windowStart) || !windowEnd.After(now) {
+			c.Error(apierror.New(http.StatusBadRequest, "The window must end after it starts and in the future"))
+			return
+		}
+
+		// 3. The waitlist is only for windows without free slots
+		var free int
+		err = db.QueryRow(
+			`SELECT COUNT(*) FROM appointment_slots s
+			 JOIN services sv ON s.service_id = sv.id
+			 WHERE sv.id = $1 AND sv.business_id = $2
+			 AND s.is_available = true AND s.start_time > $3 AND s.start_time >= $4 AND s.start_time < $5
+			 AND `+calsync.NotBusy,
+			joinReq.ServiceID, joinReq.BusinessID, now, windowStart, windowEnd,
+		).Scan(&free)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not check availability"))
+			return
+		}
+		if free > 0 {
+			c.Error(apierror.New(http.StatusConflict, "There are free slots in this window, book one of those instead"))
+			return
+		}
+
+		var serviceExists int
+		err = db.QueryRow("SELECT 1 FROM services WHERE id = $1 AND business_id = $2", joinReq.ServiceID, joinReq.BusinessID).Scan(&serviceExists)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Service not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch service"))
+			return
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		// 4. One entry per customer and window is enough
+		var existing int
+		err = tx.QueryRow(
+			`SELECT 1 FROM waitlist_entries
+			 WHERE LOWER(customer_email) = LOWER($1) AND service_id = $2 AND window_start = $3 AND window_end = $4
+			 AND status IN ('waiting', 'offered')`,
+			joinReq.CustomerEmail, joinReq.ServiceID, windowStart, windowEnd,
+		).Scan(&existing)
+		if err == nil {
+			c.Error(apierror.New(http.StatusConflict, "You're already on the waitlist for this time"))
+			return
+		}
+		if err != sql.ErrNoRows {
+			c.Error(apierror.Internal(err, "Could not join waitlist"))
+			return
+		}
+
+		// 5. Add the entry with the contact details given, like a booking
+		token, _, err := auth.NewOpaqueToken()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not join waitlist"))
+			return
+		}
+		var entryID int
+		err = tx.QueryRow(
+			`INSERT INTO waitlist_entries (business_id, service_id, customer_name, customer_email, customer_phone, window_start, window_end, notes, token, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+			joinReq.BusinessID, joinReq.ServiceID, joinReq.CustomerName, joinReq.CustomerEmail, joinReq.CustomerPhone,
+			windowStart, windowEnd, joinReq.Notes, token, now,
+		).Scan(&entryID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not join waitlist"))
+			return
+		}
+
+		entry, err := scanWaitlistEntry(tx.QueryRow(waitlistSelect+" WHERE w.id = $1", entryID))
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load waitlist entry"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		c.JSON(http.StatusCreated, models.JoinWaitlistResponse{
+			Message: "You're on the waitlist",
+			Entry:   entry,
+			Token:   token,
+		})
+	}
+}
+
+// atTimeOfDay returns "HH:MM" on day, in day's location
+func atTimeOfDay(day time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, day.Location()), nil
+}
+
+// GetPublicWaitlistEntry shows a waitlist entry, and any slot held for it,
+// to the customer holding its token
+func GetPublicWaitlistEntry(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entry, err := scanWaitlistEntry(db.QueryRow(waitlistSelect+" WHERE w.token = $1", c.Param("token")))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				c.Error(apierror.New(http.StatusNotFound, "Waitlist entry not found"))
+			} else {
+				c.Error(apierror.Internal(err, "Could not fetch waitlist entry"))
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, entry)
+	}
+}
+
+// AcceptWaitlistOffer books the slot held for a waitlisted customer
+func AcceptWaitlistOffer(db *database.Store, outbox *notify.Outbox, hooks *webhook.Publisher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tx, err := db.Begin()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not start transaction"))
+			return
+		}
+		defer tx.Rollback()
+
+		// 1. Take the offer, if it is still held
+		var entryID, businessID int
+		var customer contact
+		var slotID, customerID sql.NullInt64
+		var notes, phone sql.NullString
+		err = tx.QueryRow(
+			`UPDATE waitlist_entries SET status = 'booked'
+			 WHERE token = $1 AND status = 'offered' AND offer_expires_at > $2 AND offered_slot_id IS NOT NULL
+			 RETURNING id, customer_id, customer_name, customer_email, customer_phone, business_id, offered_slot_id, notes`,
+			c.Param("token"), time.Now(),
+		).Scan(&entryID, &customerID, &customer.name, &customer.email, &phone, &businessID, &slotID, &notes)
+		customer.phone = phone.String
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusConflict, "There is no slot held for you"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not accept offer"))
+			return
+		}
+
+		// 2. Book the held seat; it was taken from the slot with the offer
+		bookingID, manageToken, err := insertBooking(tx, customer, int(slotID.Int64), 1, notes.String, businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create booking"))
+			return
+		}
+		_, err = tx.Exec("UPDATE bookings SET customer_id = $1 WHERE id = $2", customerID, bookingID)
+		if err == nil {
+			_, err = tx.Exec("UPDATE waitlist_entries SET booking_id = $1 WHERE id = $2", bookingID, entryID)
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create booking"))
+			return
+		}
+
+		booking, err := scanBooking(tx.QueryRow(bookingSelect+" WHERE b.id = $1", bookingID))
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load booking"))
+			return
+		}
+		slot := models.TimeSlot{ID: booking.SlotID, StartTime: booking.StartTime}
+		if err := recordBookingEvent(tx, bookingID, "created", customerActor, nil, &slot); err != nil {
+			c.Error(apierror.Internal(err, "Could not create booking"))
+			return
+		}
+
+		if err := tx.Commit(); err != nil {
+			c.Error(apierror.Internal(err, "Transaction failed"))
+			return
+		}
+
+		// 3. Queue the confirmation, the business alert and webhooks
+		outbox.Notify(notify.EventBookingCreated, bookingID)
+		hooks.Publish(businessID, webhook.EventBookingCreated, booking)
+
+		c.JSON(http.StatusCreated, models.PublicBookingResponse{
+			Message:     "Booking confirmed",
+			Booking:     booking,
+			ManageToken: manageToken,
+		})
+	}
+}
+
+// LeaveWaitlist takes a customer off the waitlist. A slot held for them is
+// offered to the next customer.
+func LeaveWaitlist(db *database.Store, wl *waitlist.Waitlist) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var entryID int
+		var status string
+		err := db.QueryRow("SELECT id, status FROM waitlist_entries WHERE token = $1", c.Param("token")).Scan(&entryID, &status)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Waitlist entry not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch waitlist entry"))
+			return
+		}
+
+		switch status {
+		case "waiting":
+			_, err = db.Exec("UPDATE waitlist_entries SET status = 'left' WHERE id = $1 AND status = 'waiting'", entryID)
+		case "offered":
+			err = wl.Release(entryID, "left", time.Now())
+		default:
+			c.Error(apierror.New(http.StatusConflict, "This waitlist entry is already closed"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not leave waitlist"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "You've left the waitlist"})
+	}
+}
+
+// GetWaitlist lists the waitlist of the business, oldest first. ?status=
+// filters it (e.g. waiting or offered).
+func GetWaitlist(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		scope, ok := locationScope(c, db, currentUser)
+		if !ok {
+			return
+		}
+		filter, args, ok := locationFilter(c, "sv.location_id", scope, []interface{}{businessID})
+		if !ok {
+			return
+		}
+		query := waitlistSelect + " WHERE w.business_id = $1" + filter
+		if status := c.Query("status"); status != "" {
+			args = append(args, status)
+			query += fmt.Sprintf(" AND w.status = $%d", len(args))
+		}
+		query += " ORDER BY w.created_at, w.id"
+
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch waitlist"))
+			return
+		}
+		defer rows.Close()
+
+		entries := []models.WaitlistEntry{}
+		for rows.Next() {
+			entry, err := scanWaitlistEntry(rows)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading waitlist"))
+				return
+			}
+			entries = append(entries, entry)
+		}
+
+		c.JSON(http.StatusOK, entries)
+	}
+}
@@ -0,0 +1,401 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/database"
+	"booking-backend/models"
+	"booking-backend/publicnet"
+	"booking-backend/webhook"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadWebhook reads one endpoint of a business
+func loadWebhook(q database.Querier, id, businessID int) (models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	var events string
+	err := q.QueryRow(
+		"SELECT id, url, events, is_active, created_at FROM webhook_endpoints WHERE id = $1 AND business_id = $2",
+		id, businessID,
+	).Scan(&endpoint.ID, &endpoint.URL, &events, &endpoint.IsActive, &endpoint.CreatedAt)
+	endpoint.Events = webhook.ParseEvents(events)
+	return endpoint, err
+}
+
+// CreateWebhook registers a webhook endpoint for the admin's business. The
+// response includes the signing secret, which isn't shown again.
+func CreateWebhook(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		// 1. Bind and validate the request data
+		var webhookReq models.CreateWebhookRequest
+		if err := c.ShouldBindJSON(&webhookReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+		if !publicnet.ValidURL(webhookReq.URL) {
+			c.Error(apierror.New(http.StatusBadRequest, "url must be a public http or https URL"))
+			return
+		}
+		if err := webhook.ValidateEvents(webhookReq.Events); err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		// 2. Create the endpoint with a fresh signing secret
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create webhook"))
+			return
+		}
+		var webhookID int
+		err = db.QueryRow(
+			`INSERT INTO webhook_endpoints (business_id, url, secret, events, created_at)
+			 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+			businessID, webhookReq.URL, secret, webhook.FormatEvents(webhookReq.Events), time.Now(),
+		).Scan(&webhookID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not create webhook"))
+			return
+		}
+
+		endpoint, err := loadWebhook(db, webhookID, businessID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not load webhook"))
+			return
+		}
+		endpoint.Secret = secret
+
+		c.JSON(http.StatusCreated, endpoint)
+	}
+}
+
+// GetWebhooks lists the webhook endpoints of the admin's business
+func GetWebhooks(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		rows, err := db.Query(
+			"SELECT id, url, events, is_active, created_at FROM webhook_endpoints WHERE business_id = $1 ORDER BY id",
+			businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch webhooks"))
+			return
+		}
+		defer rows.Close()
+
+		endpoints := []models.WebhookEndpoint{}
+		for rows.Next() {
+			var endpoint models.WebhookEndpoint
+			var events string
+			if err := rows.Scan(&endpoint.ID, &endpoint.URL, &events, &endpoint.IsActive, &endpoint.CreatedAt); err != nil {
+				c.Error(apierror.Internal(err, "Error reading webhooks"))
+				return
+			}
+			endpoint.Events = webhook.ParseEvents(events)
+			endpoints = append(endpoints, endpoint)
+		}
+
+		c.JSON(http.StatusOK, endpoints)
+	}
+}
+
+// UpdateWebhook changes the URL, events or active flag of an endpoint
+func UpdateWebhook(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid webhook ID"))
+			return
+		}
+
+		// 1. Bind and validate the request data
+		var webhookReq models.UpdateWebhookRequest
+		if err := c.ShouldBindJSON(&webhookReq); err != nil {
+			c.Error(apierror.Validation(err))
+			return
+		}
+
+		// 2. Merge with the current endpoint
+		endpoint, err := loadWebhook(db, webhookID, businessID)
+		if err == sql.ErrNoRows {
+			c.Error(apierror.New(http.StatusNotFound, "Webhook not found"))
+			return
+		}
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch webhook"))
+			return
+		}
+		if webhookReq.URL != nil {
+			if !publicnet.ValidURL(*webhookReq.URL) {
+				c.Error(apierror.New(http.StatusBadRequest, "url must be a public http or https URL"))
+				return
+			}
+			endpoint.URL = *webhookReq.URL
+		}
+		if webhookReq.Events != nil {
+			if err := webhook.ValidateEvents(*webhookReq.Events); err != nil {
+				c.Error(apierror.New(http.StatusBadRequest, err.Error()))
+				return
+			}
+			endpoint.Events = *webhookReq.Events
+		}
+		if webhookReq.IsActive != nil {
+			endpoint.IsActive = *webhookReq.IsActive
+		}
+
+		// 3. Save
+		_, err = db.Exec(
+			"UPDATE webhook_endpoints SET url = $1, events = $2, is_active = $3 WHERE id = $4 AND business_id = $5",
+			endpoint.URL, webhook.FormatEvents(endpoint.Events), endpoint.IsActive, webhookID, businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not update webhook"))
+			return
+		}
+
+		c.JSON(http.StatusOK, endpoint)
+	}
+}
+
+// DeleteWebhook removes an endpoint together with its delivery log
+func DeleteWebhook(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid webhook ID"))
+			return
+		}
+
+		result, err := db.Exec(
+			"DELETE FROM webhook_endpoints WHERE id = $1 AND business_id = $2",
+			webhookID, businessID,
+		)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not delete webhook"))
+			return
+		}
+		rowsAffected, _ := result.RowsAffected()
+		if rowsAffected == 0 {
+			c.Error(apierror.New(http.StatusNotFound, "Webhook not found"))
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+	}
+}
+
+// GetWebhookDeliveries shows the delivery log of an endpoint, newest first.
+// ?status=pending|delivered|failed filters it and ?limit= caps it (max 200).
+func GetWebhookDeliveries(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid webhook ID"))
+			return
+		}
+		if _, err := loadWebhook(db, webhookID, businessID); err != nil {
+			if err == sql.ErrNoRows {
+				c.Error(apierror.New(http.StatusNotFound, "Webhook not found"))
+			} else {
+				c.Error(apierror.Internal(err, "Could not fetch webhook"))
+			}
+			return
+		}
+
+		limit := 50
+		if s := c.Query("limit"); s != "" {
+			limit, err = strconv.Atoi(s)
+			if err != nil || limit < 1 || limit > 200 {
+				c.Error(apierror.New(http.StatusBadRequest, "limit must be between 1 and 200"))
+				return
+			}
+		}
+
+		query := `
+			SELECT id, endpoint_id, event, event_id, payload, attempts, response_status, last_error,
+			       next_attempt_at, delivered_at, failed_at, created_at
+			FROM webhook_deliveries
+			WHERE endpoint_id = $1`
+		switch c.Query("status") {
+		case "":
+		case "pending":
+			query += " AND delivered_at IS NULL AND failed_at IS NULL"
+		case "delivered":
+			query += " AND delivered_at IS NOT NULL"
+		case "failed":
+			query += " AND failed_at IS NOT NULL"
+		default:
+			c.Error(apierror.New(http.StatusBadRequest, "status must be pending, delivered or failed"))
+			return
+		}
+		query += " ORDER BY id DESC LIMIT $2"
+
+		rows, err := db.Query(query, webhookID, limit)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch deliveries"))
+			return
+		}
+		defer rows.Close()
+
+		deliveries := []models.WebhookDelivery{}
+		for rows.Next() {
+			var delivery models.WebhookDelivery
+			var payload string
+			var responseStatus sql.NullInt64
+			var lastError sql.NullString
+			var nextAttemptAt, deliveredAt, failedAt sql.NullTime
+			err := rows.Scan(&delivery.ID, &delivery.EndpointID, &delivery.Event, &delivery.EventID, &payload,
+				&delivery.Attempts, &responseStatus, &lastError, &nextAttemptAt, &deliveredAt, &failedAt, &delivery.CreatedAt)
+			if err != nil {
+				c.Error(apierror.Internal(err, "Error reading deliveries"))
+				return
+			}
+
+			delivery.Payload = []byte(payload)
+			delivery.LastError = lastError.String
+			if responseStatus.Valid {
+				status := int(responseStatus.Int64)
+				delivery.ResponseStatus = &status
+			}
+			switch {
+			case deliveredAt.Valid:
+				delivery.Status = "delivered"
+				delivery.DeliveredAt = &deliveredAt.Time
+			case failedAt.Valid:
+				delivery.Status = "failed"
+			default:
+				delivery.Status = "pending"
+				delivery.NextAttemptAt = &nextAttemptAt.Time
+			}
+			deliveries = append(deliveries, delivery)
+		}
+
+		c.JSON(http.StatusOK, deliveries)
+	}
+}
+
+// RedeliverWebhook queues an earlier delivery to be sent again
+func RedeliverWebhook(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			return
+		}
+
+		currentUser := user.(models.User)
+		if currentUser.BusinessID == nil {
+			c.Error(apierror.New(http.StatusForbidden, "User is not associated with a business"))
+			return
+		}
+		businessID := *currentUser.BusinessID
+
+		webhookID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid webhook ID"))
+			return
+		}
+		deliveryID, err := strconv.Atoi(c.Param("delivery_id"))
+		if err != nil {
+			c.Error(apierror.New(http.StatusBadRequest, "Invalid delivery ID"))
+			return
+		}
+
+		// The delivery must belong to an endpoint of this business
+		var found int
+		err = db.QueryRow(
+			`SELECT COUNT(*) FROM webhook_deliveries d
+			 JOIN webhook_endpoints e ON d.endpoint_id = e.id
+			 WHERE d.id = $1 AND e.id = $2 AND e.business_id = $3`,
+			deliveryID, webhookID, businessID,
+		).Scan(&found)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not fetch delivery"))
+			return
+		}
+		if found == 0 {
+			c.Error(apierror.New(http.StatusNotFound, "Delivery not found"))
+			return
+		}
+
+		newID, err := webhook.Redeliver(db, deliveryID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not queue redelivery"))
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":     "Redelivery queued",
+			"delivery_id": newID,
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// Package hours reads, writes and checks opening hours. They are stored as
+// JSON text, e.g. {"mon": [{"open": "09:00", "close": "17:00"}]}.
+package hours
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"booking-backend/models"
+)
+
+// Days are the weekday keys, indexed by time.Weekday
+var Days = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Validate checks the weekday keys and that every period opens before it
+// closes
+func Validate(h models.OpeningHours) error {
+	for day, periods := range h {
+		if !isDay(day) {
+			return fmt.Errorf("unknown day %q in opening hours, expected one of mon, tue, wed, thu, fri, sat, sun", day)
+		}
+		for _, p := range periods {
+			open, err := clock(p.Open)
+			if err != nil {
+				return err
+			}
+			closing, err := clock(p.Close)
+			if err != nil {
+				return err
+			}
+			if closing <= open {
+				return fmt.Errorf("opening hours on %s close (%s) before they open (%s)", day, p.Close, p.Open)
+			}
+		}
+	}
+	return nil
+}
+
+// Parse reads stored opening hours; empty text means none are set
+func Parse(text string) (models.OpeningHours, error) {
+	if text == "" {
+		return nil, nil
+	}
+	var h models.OpeningHours
+	if err := json.Unmarshal([]byte(text), &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Format is the inverse of Parse; no opening hours are stored as NULL
+func Format(h models.OpeningHours) interface{} {
+	if len(h) == 0 {
+		return nil
+	}
+	text, _ := json.Marshal(h)
+	return string(text)
+}
+
+// Contains reports whether [start, end) lies within one opening period of
+// start's day, in start's timezone. Without opening hours everything fits.
+func Contains(h models.OpeningHours, start, end time.Time) bool {
+	if len(h) == 0 {
+		return true
+	}
+	midnight := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+	for _, p := range h[Days[start.Weekday()]] {
+		open, err := clock(p.Open)
+		if err != nil {
+			continue
+		}
+		closing, err := clock(p.Close)
+		if err != nil {
+			continue
+		}
+		if !start.Before(midnight.Add(open)) && !end.After(midnight.Add(closing)) {
+			return true
+		}
+	}
+	return false
+}
+
+// clock parses "HH:MM" as the time since midnight; "24:00" is the end of
+// the day
+func clock(value string) (time.Duration, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil || len(value) != 5 ||
+		hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute > 0) {
+		return 0, fmt.Errorf("invalid time %q in opening hours, expected HH:MM", value)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+func isDay(day string) bool {
+	for _, d := range Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package ical
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"booking-backend/database"
+)
+
+// FeedHistory is how far back feeds go; older bookings are left out to keep
+// them small
+const FeedHistory = 30 * 24 * time.Hour
+
+// bookingRow is what the calendars show about a booking
+type bookingRow struct {
+	id            int
+	status        string
+	reschedules   int
+	notes         string
+	createdAt     time.Time
+	manageToken   string
+	start, end    time.Time
+	serviceName   string
+	businessName  string
+	timezone      string
+	customerName  string
+	customerEmail string
+	customerPhone string
+	staffName     string
+}
+
+const bookingRowSelect = `
+	SELECT b.id, b.status, b.reschedule_count, b.notes, b.created_at, b.manage_token, s.start_time, s.end_time, b.ends_at,
+	       sv.name, bz.name, COALESCE(l.timezone, bz.timezone), b.customer_name, b.customer_email, b.customer_phone, st.full_name
+	FROM bookings b
+	JOIN appointment_slots s ON b.slot_id = s.id
+	JOIN services sv ON s.service_id = sv.id
+	JOIN businesses bz ON b.business_id = bz.id
+	LEFT JOIN locations l ON b.location_id = l.id
+	LEFT JOIN users st ON s.staff_id = st.id
+`
+
+func scanBookingRow(rows interface{ Scan(...interface{}) error }) (bookingRow, error) {
+	var r bookingRow
+	var notes, manageToken, phone, staffName sql.NullString
+	var endsAt sql.NullTime
+	err := rows.Scan(&r.id, &r.status, &r.reschedules, &notes, &r.createdAt, &manageToken, &r.start, &r.end, &endsAt,
+		&r.serviceName, &r.businessName, &r.timezone, &r.customerName, &r.customerEmail, &phone, &staffName)
+	r.notes = notes.String
+	r.manageToken = manageToken.String
+	r.customerPhone = phone.String
+	r.staffName = staffName.String
+	if endsAt.Valid {
+		r.end = endsAt.Time
+	}
+	return r, err
+}
+
+// UID is the stable identifier of a booking's event, the same in feeds and
+// in downloaded files so clients don't show it twice
+func UID(bookingID int) string {
+	return fmt.Sprintf("booking-%d@booking-backend", bookingID)
+}
+
+func status(bookingStatus string) string {
+	if bookingStatus == "cancelled" {
+		return StatusCancelled
+	}
+	return StatusConfirmed
+}
+
+// sequence is bumped each time a booking is rescheduled or cancelled so
+// clients replace the event they already have
+func sequence(r bookingRow) int {
+	if r.status == "cancelled" {
+		return r.reschedules + 1
+	}
+	return r.reschedules
+}
+
+// BookingFile is the customer's .ics for one booking. appURL is the base
+// URL of the frontend, used for the manage link.
+func BookingFile(q database.Querier, bookingID int, appURL string) (*Calendar, error) {
+	r, err := scanBookingRow(q.QueryRow(bookingRowSelect+" WHERE b.id = $1", bookingID))
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(r.timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	event := Event{
+		UID:      UID(r.id),
+		Start:    r.start,
+		End:      r.end,
+		Summary:  r.serviceName + " at " + r.businessName,
+		Location: r.businessName,
+		Status:   status(r.status),
+		Sequence: sequence(r),
+		Created:  r.createdAt,
+	}
+	var description []string
+	if r.staffName != "" {
+		description = append(description, "With: "+r.staffName)
+	}
+	if r.notes != "" {
+		description = append(description, "Notes: "+r.notes)
+	}
+	if r.manageToken != "" && appURL != "" {
+		event.URL = appURL + "/booking/manage/" + r.manageToken
+		description = append(description, "View or cancel: "+event.URL)
+	}
+	event.Description = strings.Join(description, "\n")
+
+	return &Calendar{
+		Name:     r.businessName,
+		Location: loc,
+		Events:   []Event{event},
+	}, nil
+}
+
+// Feed is the calendar of a business's upcoming and recent bookings, or of
+// one staff member's when staffID is set. Cancelled bookings are left out,
+// which removes them from subscribed calendars on the next refresh.
+func Feed(q database.Querier, businessID int, staffID *int, now time.Time) (*Calendar, error) {
+	var name, timezone string
+	err := q.QueryRow("SELECT name, timezone FROM businesses WHERE id = $1", businessID).Scan(&name, &timezone)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	query := bookingRowSelect + " WHERE b.business_id = $1 AND b.status <> 'cancelled' AND (s.end_time > $2 OR b.ends_at > $2)"
+	args := []interface{}{businessID, now.Add(-FeedHistory)}
+	if staffID != nil {
+		var staffName string
+		if err := q.QueryRow("SELECT full_name FROM users WHERE id = $1", *staffID).Scan(&staffName); err != nil {
+			return nil, err
+		}
+		name += " - " + staffName
+		query += " AND s.staff_id = $3"
+		args = append(args, *staffID)
+	}
+	query += " ORDER BY s.start_time"
+
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cal := &Calendar{Name: name, Location: loc, Stamp: now}
+	for rows.Next() {
+		r, err := scanBookingRow(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		description := []string{"Customer: " + r.customerName, "Email: " + r.customerEmail}
+		if r.customerPhone != "" {
+			description = append(description, "Phone: "+r.customerPhone)
+		}
+		if r.staffName != "" && staffID == nil {
+			description = append(description, "Staff: "+r.staffName)
+		}
+		if r.notes != "" {
+			description = append(description, "Notes: "+r.notes)
+		}
+
+		cal.Events = append(cal.Events, Event{
+			UID:         UID(r.id),
+			Start:       r.start,
+			End:         r.end,
+			Summary:     r.serviceName + ": " + r.customerName,
+			Description: strings.Join(description, "\n"),
+			Status:      status(r.status),
+			Sequence:    sequence(r),
+			Created:     r.createdAt,
+		})
+	}
+	return cal, rows.Err()
+}
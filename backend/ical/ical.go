@@ -0,0 +1,166 @@
+// Package ical writes iCalendar (RFC 5545) files for bookings: the
+// subscribable feeds for businesses and staff, and the single-event files
+// customers download or receive with their confirmation email.
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of .ics files
+const ContentType = "text/calendar; charset=utf-8"
+
+const prodID = "-//booking-backend//Booking Calendar//EN"
+
+// Event statuses
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Calendar is a VCALENDAR with its events. Times are written in Location,
+// with a matching VTIMEZONE, so clients show them in the business's
+// timezone even across daylight saving changes.
+type Calendar struct {
+	Name     string         // X-WR-CALNAME, shown by most clients as the calendar title
+	Location *time.Location // nil means UTC
+	Events   []Event
+	Stamp    time.Time // DTSTAMP; zero means now
+}
+
+// Event is one VEVENT
+type Event struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	URL         string
+	Status      string // StatusConfirmed, StatusCancelled or empty
+	Sequence    int
+	Created     time.Time
+}
+
+// Bytes encodes the calendar
+func (c *Calendar) Bytes() []byte {
+	loc := c.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	stamp := c.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+
+	w := &writer{}
+	w.line("BEGIN:VCALENDAR")
+	w.line("VERSION:2.0")
+	w.line("PRODID:" + prodID)
+	w.line("CALSCALE:GREGORIAN")
+	w.line("METHOD:PUBLISH")
+	if c.Name != "" {
+		w.line("X-WR-CALNAME:" + escape(c.Name))
+	}
+	if loc != time.UTC {
+		w.line("X-WR-TIMEZONE:" + loc.String())
+		from, to := c.span(stamp)
+		writeTimezone(w, loc, from, to)
+	}
+
+	for _, e := range c.Events {
+		w.line("BEGIN:VEVENT")
+		w.line("UID:" + e.UID)
+		w.line("DTSTAMP:" + formatUTC(stamp))
+		w.line(formatTime("DTSTART", e.Start, loc))
+		w.line(formatTime("DTEND", e.End, loc))
+		if !e.Created.IsZero() {
+			w.line("CREATED:" + formatUTC(e.Created))
+		}
+		w.line("SUMMARY:" + escape(e.Summary))
+		if e.Description != "" {
+			w.line("DESCRIPTION:" + escape(e.Description))
+		}
+		if e.Location != "" {
+			w.line("LOCATION:" + escape(e.Location))
+		}
+		if e.URL != "" {
+			w.line("URL:" + e.URL)
+		}
+		if e.Status != "" {
+			w.line("STATUS:" + e.Status)
+		}
+		w.line(fmt.Sprintf("SEQUENCE:%d", e.Sequence))
+		w.line("END:VEVENT")
+	}
+
+	w.line("END:VCALENDAR")
+	return w.buf.Bytes()
+}
+
+// span returns the years covered by the events, which the VTIMEZONE has to
+// describe
+func (c *Calendar) span(stamp time.Time) (time.Time, time.Time) {
+	from, to := stamp, stamp
+	for _, e := range c.Events {
+		if e.Start.Before(from) {
+			from = e.Start
+		}
+		if e.End.After(to) {
+			to = e.End
+		}
+	}
+	return from, to
+}
+
+// formatTime writes a DTSTART/DTEND property in loc, or in UTC with a Z
+// suffix when loc is UTC
+func formatTime(name string, t time.Time, loc *time.Location) string {
+	if loc == time.UTC {
+		return name + ":" + formatUTC(t)
+	}
+	return name + ";TZID=" + loc.String() + ":" + t.In(loc).Format("20060102T150405")
+}
+
+func formatUTC(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// escape escapes a TEXT value (RFC 5545 section 3.3.11)
+func escape(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+		"\r", `\n`,
+	).Replace(s)
+}
+
+// writer writes content lines with CRLF endings, folding lines longer than
+// 75 octets without splitting UTF-8 sequences
+type writer struct {
+	buf bytes.Buffer
+}
+
+func (w *writer) line(s string) {
+	limit := 75
+	for len(s) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		w.buf.WriteString(s[:cut])
+		w.buf.WriteString("\r\n ")
+		s = s[cut:]
+		// Continuation lines start with a space, which counts
+		limit = 74
+	}
+	w.buf.WriteString(s)
+	w.buf.WriteString("\r\n")
+}
@@ -0,0 +1,386 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is a span of busy time from an imported calendar
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// property is one parsed content line
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// vevent holds the properties of an imported VEVENT that matter for
+// availability
+type vevent struct {
+	uid          string
+	start, end   time.Time
+	duration     time.Duration
+	hasEnd       bool
+	allDay       bool
+	rule         *rrule
+	rdates       []time.Time
+	exdates      map[int64]bool
+	recurrenceID *time.Time
+	free         bool // cancelled or transparent: doesn't block time
+}
+
+// BusyPeriods parses an iCalendar file and returns the busy time of its
+// events between from and to, with recurring events expanded. Floating
+// times and all-day events are read in loc, normally the business's
+// timezone. Cancelled and transparent ("show as free") events are ignored.
+func BusyPeriods(data []byte, loc *time.Location, from, to time.Time) ([]Period, error) {
+	lines := unfold(data)
+	if len(lines) == 0 || !strings.EqualFold(strings.TrimSpace(lines[0]), "BEGIN:VCALENDAR") {
+		return nil, fmt.Errorf("not an iCalendar file")
+	}
+
+	// Pass 1: timezones declared in the file, for TZIDs Go doesn't know
+	// (e.g. Windows names like "W. Europe Standard Time")
+	zones := map[string]*time.Location{}
+	var tzid string
+	var inTimezone, inStandard bool
+	for _, line := range lines {
+		p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		switch {
+		case p.name == "BEGIN" && strings.EqualFold(p.value, "VTIMEZONE"):
+			inTimezone, tzid = true, ""
+		case p.name == "END" && strings.EqualFold(p.value, "VTIMEZONE"):
+			inTimezone = false
+		case inTimezone && p.name == "TZID":
+			tzid = p.value
+		case inTimezone && p.name == "BEGIN" && strings.EqualFold(p.value, "STANDARD"):
+			inStandard = true
+		case inTimezone && p.name == "END" && strings.EqualFold(p.value, "STANDARD"):
+			inStandard = false
+		case inStandard && p.name == "TZOFFSETTO" && tzid != "":
+			if offset, err := parseOffset(p.value); err == nil {
+				if _, seen := zones[tzid]; !seen {
+					zones[tzid] = time.FixedZone(tzid, offset)
+				}
+			}
+		}
+	}
+	resolve := func(id string) *time.Location {
+		if id == "" {
+			return loc
+		}
+		if l, err := time.LoadLocation(strings.Trim(id, "/")); err == nil {
+			return l
+		}
+		if l, ok := zones[id]; ok {
+			return l
+		}
+		return loc
+	}
+
+	// Pass 2: the events
+	var events []*vevent
+	var current *vevent
+	depth := 0
+	for _, line := range lines {
+		p, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+		if p.name == "BEGIN" {
+			if strings.EqualFold(p.value, "VEVENT") {
+				current = &vevent{exdates: map[int64]bool{}}
+				depth = 0
+			} else if current != nil {
+				// VALARM and friends nested in the event
+				depth++
+			}
+			continue
+		}
+		if p.name == "END" {
+			if current != nil && depth > 0 {
+				depth--
+			} else if current != nil && strings.EqualFold(p.value, "VEVENT") {
+				events = append(events, current)
+				current = nil
+			}
+			continue
+		}
+		if current == nil || depth > 0 {
+			continue
+		}
+
+		if err := current.set(p, resolve); err != nil {
+			return nil, err
+		}
+	}
+
+	// Moved or cancelled occurrences of a recurring event replace the
+	// original occurrence
+	overridden := map[string]map[int64]bool{}
+	for _, e := range events {
+		if e.recurrenceID != nil {
+			if overridden[e.uid] == nil {
+				overridden[e.uid] = map[int64]bool{}
+			}
+			overridden[e.uid][e.recurrenceID.Unix()] = true
+		}
+	}
+
+	var periods []Period
+	for _, e := range events {
+		if e.start.IsZero() {
+			continue
+		}
+		length := e.length()
+		if length <= 0 {
+			continue
+		}
+
+		var starts []time.Time
+		if e.rule != nil && e.recurrenceID == nil {
+			// Occurrences that start before from can still overlap it
+			starts = e.rule.expand(e.start, from.Add(-length), to)
+		} else {
+			starts = []time.Time{e.start}
+		}
+		starts = append(starts, e.rdates...)
+
+		for _, start := range starts {
+			if e.exdates[start.Unix()] {
+				continue
+			}
+			if e.recurrenceID == nil && overridden[e.uid][start.Unix()] {
+				continue
+			}
+			if e.free {
+				continue
+			}
+			end := start.Add(length)
+			if e.allDay {
+				// All-day events last whole calendar days, whatever the
+				// DST changes in between
+				days := int(length.Hours()+12) / 24
+				end = start.AddDate(0, 0, days)
+			}
+			if end.After(from) && start.Before(to) {
+				periods = append(periods, Period{Start: start, End: end})
+			}
+		}
+	}
+
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Start.Before(periods[j].Start) })
+	return periods, nil
+}
+
+// set applies one property to the event
+func (e *vevent) set(p property, resolve func(string) *time.Location) error {
+	switch p.name {
+	case "UID":
+		e.uid = p.value
+	case "DTSTART":
+		t, allDay, err := parseDateTime(p, resolve)
+		if err != nil {
+			return err
+		}
+		e.start, e.allDay = t, allDay
+	case "DTEND":
+		t, _, err := parseDateTime(p, resolve)
+		if err != nil {
+			return err
+		}
+		e.end, e.hasEnd = t, true
+	case "DURATION":
+		d, err := parseDuration(p.value)
+		if err != nil {
+			return err
+		}
+		e.duration = d
+	case "RRULE":
+		rule, err := parseRRule(p.value, resolve)
+		if err != nil {
+			return err
+		}
+		e.rule = rule
+	case "RDATE", "EXDATE":
+		for _, value := range strings.Split(p.value, ",") {
+			if p.params["VALUE"] == "PERIOD" || strings.Contains(value, "/") {
+				value = strings.SplitN(value, "/", 2)[0]
+			}
+			t, _, err := parseDateTime(property{name: p.name, params: p.params, value: value}, resolve)
+			if err != nil {
+				return err
+			}
+			if p.name == "RDATE" {
+				e.rdates = append(e.rdates, t)
+			} else {
+				e.exdates[t.Unix()] = true
+			}
+		}
+	case "RECURRENCE-ID":
+		t, _, err := parseDateTime(p, resolve)
+		if err != nil {
+			return err
+		}
+		e.recurrenceID = &t
+	case "STATUS":
+		if strings.EqualFold(p.value, "CANCELLED") {
+			e.free = true
+		}
+	case "TRANSP":
+		if strings.EqualFold(p.value, "TRANSPARENT") {
+			e.free = true
+		}
+	}
+	return nil
+}
+
+// length is how long each occurrence lasts
+func (e *vevent) length() time.Duration {
+	switch {
+	case e.hasEnd:
+		return e.end.Sub(e.start)
+	case e.duration > 0:
+		return e.duration
+	case e.allDay:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
+
+// unfold joins folded content lines (RFC 5545 section 3.1)
+func unfold(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parseLine splits a content line into name, parameters and value
+func parseLine(line string) (property, bool) {
+	p := property{params: map[string]string{}}
+
+	// The value starts at the first colon outside a quoted parameter
+	colon := -1
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		if line[i] == '"' {
+			quoted = !quoted
+		} else if line[i] == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return p, false
+	}
+
+	head := line[:colon]
+	p.value = line[colon+1:]
+	parts := strings.Split(head, ";")
+	p.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 {
+			p.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return p, true
+}
+
+// parseDateTime parses a DATE or DATE-TIME value. It reports whether the
+// value was a date (an all-day event).
+func parseDateTime(p property, resolve func(string) *time.Location) (time.Time, bool, error) {
+	value := strings.TrimSpace(p.value)
+	if p.params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, resolve(""))
+		if err != nil {
+			return t, false, fmt.Errorf("invalid date %q in %s", value, p.name)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return t, false, fmt.Errorf("invalid date-time %q in %s", value, p.name)
+		}
+		return t, false, nil
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, resolve(p.params["TZID"]))
+	if err != nil {
+		return t, false, fmt.Errorf("invalid date-time %q in %s", value, p.name)
+	}
+	return t, false, nil
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration parses a DURATION value such as PT1H30M or P1D
+func parseDuration(value string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] != "" {
+			n, _ := strconv.Atoi(m[i+2])
+			d += time.Duration(n) * unit
+		}
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseOffset parses a UTC offset such as +0200 or -053000 into seconds
+func parseOffset(value string) (int, error) {
+	if len(value) != 5 && len(value) != 7 {
+		return 0, fmt.Errorf("invalid offset %q", value)
+	}
+	sign := 1
+	switch value[0] {
+	case '+':
+	case '-':
+		sign = -1
+	default:
+		return 0, fmt.Errorf("invalid offset %q", value)
+	}
+	h, err1 := strconv.Atoi(value[1:3])
+	m, err2 := strconv.Atoi(value[3:5])
+	s := 0
+	var err3 error
+	if len(value) == 7 {
+		s, err3 = strconv.Atoi(value[5:7])
+	}
+	if err1 != nil || err2 != nil || err3 != nil {
+		return 0, fmt.Errorf("invalid offset %q", value)
+	}
+	return sign * (h*3600 + m*60 + s), nil
+}
@@ -0,0 +1,66 @@
+package ical
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// testdata/recurring.ics has a weekly event with an EXDATE, an RDATE, a
+// moved and a cancelled occurrence, an event shown as free, one in a
+// Windows timezone declared by a VTIMEZONE (on a folded line, with an
+// alarm) and an all-day event over the DST change
+func TestBusyPeriods(t *testing.T) {
+	data, err := os.ReadFile("testdata/recurring.ics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	periods, err := BusyPeriods(data, berlin, at("2026-03-01 00:00"), at("2026-05-01 00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Period{
+		{at("2026-03-02 09:00"), at("2026-03-02 09:30")},
+		{at("2026-03-05 10:00"), at("2026-03-05 11:00")}, // +0100 from the VTIMEZONE
+		{at("2026-03-12 14:00"), at("2026-03-12 14:30")}, // RDATE; March 9 is an EXDATE
+		{at("2026-03-16 11:00"), at("2026-03-16 11:30")}, // moved from 09:00
+		{at("2026-03-28 00:00"), at("2026-03-30 00:00")}, // March 23 is cancelled
+		{at("2026-03-30 09:00"), at("2026-03-30 09:30")}, // after the DST change
+		{at("2026-04-06 09:00"), at("2026-04-06 09:30")},
+	}
+	if len(periods) != len(want) {
+		t.Fatalf("got %d periods %v, want %d", len(periods), periods, len(want))
+	}
+	for i := range want {
+		if !periods[i].Start.Equal(want[i].Start) || !periods[i].End.Equal(want[i].End) {
+			t.Errorf("period %d = %v - %v, want %v - %v", i, periods[i].Start, periods[i].End, want[i].Start, want[i].End)
+		}
+	}
+
+	// Only what overlaps the window is returned
+	periods, err = BusyPeriods(data, berlin, at("2026-03-30 09:15"), at("2026-04-01 00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(periods) != 1 || !periods[0].Start.Equal(at("2026-03-30 09:00")) {
+		t.Errorf("window 30 March 09:15 - 1 April: got %v", periods)
+	}
+}
+
+func TestBusyPeriodsRejectsOtherFiles(t *testing.T) {
+	if _, err := BusyPeriods([]byte("<html></html>"), time.UTC, time.Time{}, time.Now()); err == nil {
+		t.Error("an HTML page was accepted as a calendar")
+	}
+}
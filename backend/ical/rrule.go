@@ -0,0 +1,348 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPeriods bounds the expansion of a rule that never matches anything
+const maxPeriods = 100000
+
+// rrule is a parsed recurrence rule. Supported: FREQ=DAILY|WEEKLY|MONTHLY|
+// YEARLY with INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH and
+// BYSETPOS, which covers what calendar apps create. Other parts are
+// ignored.
+type rrule struct {
+	freq       string
+	interval   int
+	count      int
+	until      time.Time
+	byDay      []weekdayNum
+	byMonthDay []int
+	byMonth    []int
+	bySetPos   []int
+}
+
+// weekdayNum is a BYDAY entry such as MO, 2TU or -1FR
+type weekdayNum struct {
+	n   int // 0 means every such weekday in the period
+	day time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRRule(value string, resolve func(string) *time.Location) (*rrule, error) {
+	r := &rrule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key, val := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		var err error
+		switch key {
+		case "FREQ":
+			r.freq = val
+		case "INTERVAL":
+			r.interval, err = strconv.Atoi(val)
+			if err == nil && r.interval < 1 {
+				err = fmt.Errorf("must be positive")
+			}
+		case "COUNT":
+			r.count, err = strconv.Atoi(val)
+		case "UNTIL":
+			var allDay bool
+			r.until, allDay, err = parseDateTime(property{name: "UNTIL", params: map[string]string{}, value: val}, resolve)
+			if allDay {
+				// A date UNTIL includes that whole day
+				r.until = r.until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		case "BYDAY":
+			for _, s := range strings.Split(val, ",") {
+				if len(s) < 2 {
+					err = fmt.Errorf("invalid day %q", s)
+					break
+				}
+				day, ok := weekdays[s[len(s)-2:]]
+				if !ok {
+					err = fmt.Errorf("invalid day %q", s)
+					break
+				}
+				n := 0
+				if prefix := s[:len(s)-2]; prefix != "" {
+					if n, err = strconv.Atoi(prefix); err != nil {
+						break
+					}
+				}
+				r.byDay = append(r.byDay, weekdayNum{n: n, day: day})
+			}
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseInts(val)
+		case "BYMONTH":
+			r.byMonth, err = parseInts(val)
+		case "BYSETPOS":
+			r.bySetPos, err = parseInts(val)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE %s: %v", key, err)
+		}
+	}
+
+	switch r.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	default:
+		return nil, fmt.Errorf("unsupported RRULE frequency %q", r.freq)
+	}
+	return r, nil
+}
+
+func parseInts(value string) ([]int, error) {
+	var out []int
+	for _, s := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(s, "+"))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// expand returns the occurrence start times in [from, to), keeping the
+// wall-clock time of dtstart in its location across DST changes
+func (r *rrule) expand(dtstart, from, to time.Time) []time.Time {
+	var out []time.Time
+	generated := 0
+
+	first := 0
+	if r.count == 0 {
+		// Without COUNT, periods before from can be skipped entirely
+		first = r.periodsBefore(dtstart, from) - 1
+		if first < 0 {
+			first = 0
+		}
+	}
+
+	for i := first; i < first+maxPeriods; i++ {
+		for _, t := range r.period(dtstart, i) {
+			if t.Before(dtstart) {
+				continue
+			}
+			if !r.until.IsZero() && t.After(r.until) {
+				return out
+			}
+			if r.count > 0 && generated >= r.count {
+				return out
+			}
+			generated++
+			if !t.Before(to) {
+				return out
+			}
+			if !t.Before(from) {
+				out = append(out, t)
+			}
+		}
+	}
+	return out
+}
+
+// periodsBefore estimates how many whole periods lie between dtstart and t
+func (r *rrule) periodsBefore(dtstart, t time.Time) int {
+	if !t.After(dtstart) {
+		return 0
+	}
+	days := int(t.Sub(dtstart).Hours() / 24)
+	switch r.freq {
+	case "DAILY":
+		return days / r.interval
+	case "WEEKLY":
+		return days / 7 / r.interval
+	case "MONTHLY":
+		return days / 31 / r.interval
+	default:
+		return days / 366 / r.interval
+	}
+}
+
+// period returns the candidate occurrences in the i-th period (day, week,
+// month or year) of the rule, sorted
+func (r *rrule) period(dtstart time.Time, i int) []time.Time {
+	loc := dtstart.Location()
+	hour, min, sec := dtstart.Clock()
+	at := func(year int, month time.Month, day int) (time.Time, bool) {
+		t := time.Date(year, month, day, hour, min, sec, 0, loc)
+		return t, t.Day() == day && t.Month() == month
+	}
+
+	var days []time.Time
+	switch r.freq {
+	case "DAILY":
+		d := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day()+i*r.interval, 0, 0, 0, 0, loc)
+		if t, ok := at(d.Year(), d.Month(), d.Day()); ok && r.matchesDay(t) {
+			days = append(days, t)
+		}
+	case "WEEKLY":
+		// Weeks start on Monday
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := time.Date(dtstart.Year(), dtstart.Month(), dtstart.Day()-offset+i*7*r.interval, 0, 0, 0, 0, loc)
+		wanted := map[time.Weekday]bool{}
+		for _, wd := range r.byDay {
+			wanted[wd.day] = true
+		}
+		if len(wanted) == 0 {
+			wanted[dtstart.Weekday()] = true
+		}
+		for k := 0; k < 7; k++ {
+			d := monday.AddDate(0, 0, k)
+			if !wanted[d.Weekday()] {
+				continue
+			}
+			if t, ok := at(d.Year(), d.Month(), d.Day()); ok && r.inMonth(t.Month()) {
+				days = append(days, t)
+			}
+		}
+	case "MONTHLY":
+		m := time.Date(dtstart.Year(), dtstart.Month()+time.Month(i*r.interval), 1, 0, 0, 0, 0, loc)
+		if r.inMonth(m.Month()) {
+			days = r.monthDays(dtstart, m.Year(), m.Month(), at)
+		}
+	case "YEARLY":
+		year := dtstart.Year() + i*r.interval
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []int{int(dtstart.Month())}
+		}
+		for _, month := range months {
+			days = append(days, r.monthDays(dtstart, year, time.Month(month), at)...)
+		}
+	}
+
+	sort.Slice(days, func(a, b int) bool { return days[a].Before(days[b]) })
+	return r.applySetPos(days)
+}
+
+// monthDays returns the days of a month selected by BYDAY / BYMONTHDAY,
+// or dtstart's day of the month when neither is given
+func (r *rrule) monthDays(dtstart time.Time, year int, month time.Month, at func(int, time.Month, int) (time.Time, bool)) []time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	selected := map[int]bool{}
+	if len(r.byDay) > 0 {
+		for _, wd := range r.byDay {
+			var matching []int
+			for d := 1; d <= last; d++ {
+				if time.Date(year, month, d, 0, 0, 0, 0, time.UTC).Weekday() == wd.day {
+					matching = append(matching, d)
+				}
+			}
+			switch {
+			case wd.n == 0:
+				for _, d := range matching {
+					selected[d] = true
+				}
+			case wd.n > 0 && wd.n <= len(matching):
+				selected[matching[wd.n-1]] = true
+			case wd.n < 0 && -wd.n <= len(matching):
+				selected[matching[len(matching)+wd.n]] = true
+			}
+		}
+	}
+	if len(r.byMonthDay) > 0 {
+		byMonthDay := map[int]bool{}
+		for _, d := range r.byMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			if d >= 1 && d <= last {
+				byMonthDay[d] = true
+			}
+		}
+		if len(r.byDay) > 0 {
+			for d := range selected {
+				if !byMonthDay[d] {
+					delete(selected, d)
+				}
+			}
+		} else {
+			selected = byMonthDay
+		}
+	}
+	if len(r.byDay) == 0 && len(r.byMonthDay) == 0 {
+		selected[dtstart.Day()] = true
+	}
+
+	var days []time.Time
+	for d := range selected {
+		if t, ok := at(year, month, d); ok {
+			days = append(days, t)
+		}
+	}
+	return days
+}
+
+// matchesDay applies the BY* filters of a DAILY rule
+func (r *rrule) matchesDay(t time.Time) bool {
+	if !r.inMonth(t.Month()) {
+		return false
+	}
+	if len(r.byDay) > 0 {
+		found := false
+		for _, wd := range r.byDay {
+			if wd.day == t.Weekday() {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.byMonthDay) > 0 {
+		last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		found := false
+		for _, d := range r.byMonthDay {
+			if d == t.Day() || (d < 0 && last+d+1 == t.Day()) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rrule) inMonth(month time.Month) bool {
+	if len(r.byMonth) == 0 {
+		return true
+	}
+	for _, m := range r.byMonth {
+		if time.Month(m) == month {
+			return true
+		}
+	}
+	return false
+}
+
+// applySetPos keeps only the BYSETPOS-th candidates of a period
+func (r *rrule) applySetPos(days []time.Time) []time.Time {
+	if len(r.bySetPos) == 0 || len(days) == 0 {
+		return days
+	}
+	var out []time.Time
+	for _, pos := range r.bySetPos {
+		switch {
+		case pos > 0 && pos <= len(days):
+			out = append(out, days[pos-1])
+		case pos < 0 && -pos <= len(days):
+			out = append(out, days[len(days)+pos])
+		}
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Before(out[b]) })
+	return out
+}
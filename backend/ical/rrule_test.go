@@ -0,0 +1,146 @@
+package ical
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRRuleExpand(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utc := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	local := func(s string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", s, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	tests := []struct {
+		name     string
+		rule     string
+		dtstart  time.Time
+		from, to time.Time // the window; zero means all of 2026-2027
+		want     []time.Time
+	}{
+		{
+			name:    "daily count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: utc("2026-01-05 09:00"),
+			want:    []time.Time{utc("2026-01-05 09:00"), utc("2026-01-06 09:00"), utc("2026-01-07 09:00")},
+		},
+		{
+			name:    "count includes occurrences before the window",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: utc("2026-01-05 09:00"),
+			from:    utc("2026-01-06 00:00"),
+			to:      utc("2026-02-01 00:00"),
+			want:    []time.Time{utc("2026-01-06 09:00"), utc("2026-01-07 09:00")},
+		},
+		{
+			name:    "until date-time is inclusive",
+			rule:    "FREQ=DAILY;UNTIL=20260107T090000Z",
+			dtstart: utc("2026-01-05 09:00"),
+			want:    []time.Time{utc("2026-01-05 09:00"), utc("2026-01-06 09:00"), utc("2026-01-07 09:00")},
+		},
+		{
+			name:    "until date includes the whole day",
+			rule:    "FREQ=DAILY;UNTIL=20260106",
+			dtstart: utc("2026-01-05 18:00"),
+			want:    []time.Time{utc("2026-01-05 18:00"), utc("2026-01-06 18:00")},
+		},
+		{
+			name:    "until before count runs out",
+			rule:    "FREQ=DAILY;COUNT=10;UNTIL=20260106T235959Z",
+			dtstart: utc("2026-01-05 09:00"),
+			want:    []time.Time{utc("2026-01-05 09:00"), utc("2026-01-06 09:00")},
+		},
+		{
+			name:    "weekly on several days",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			dtstart: utc("2026-01-05 09:00"), // a Monday
+			want:    []time.Time{utc("2026-01-05 09:00"), utc("2026-01-07 09:00"), utc("2026-01-12 09:00"), utc("2026-01-14 09:00")},
+		},
+		{
+			name:    "every other week",
+			rule:    "FREQ=WEEKLY;INTERVAL=2;BYDAY=TU",
+			dtstart: utc("2026-01-06 09:00"),
+			from:    utc("2026-01-01 00:00"),
+			to:      utc("2026-02-01 00:00"),
+			want:    []time.Time{utc("2026-01-06 09:00"), utc("2026-01-20 09:00")},
+		},
+		{
+			name:    "last friday of the month",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: utc("2026-01-30 15:00"),
+			want:    []time.Time{utc("2026-01-30 15:00"), utc("2026-02-27 15:00"), utc("2026-03-27 15:00")},
+		},
+		{
+			name:    "last weekday of the month with BYSETPOS",
+			rule:    "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=-1;COUNT=3",
+			dtstart: utc("2026-01-30 15:00"),
+			want:    []time.Time{utc("2026-01-30 15:00"), utc("2026-02-27 15:00"), utc("2026-03-31 15:00")},
+		},
+		{
+			name:    "first and second weekday with BYSETPOS",
+			rule:    "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=1,2;COUNT=4",
+			dtstart: utc("2026-02-02 08:00"),
+			want:    []time.Time{utc("2026-02-02 08:00"), utc("2026-02-03 08:00"), utc("2026-03-02 08:00"), utc("2026-03-03 08:00")},
+		},
+		{
+			name:    "monthly on the 31st skips shorter months",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3",
+			dtstart: utc("2026-01-31 10:00"),
+			want:    []time.Time{utc("2026-01-31 10:00"), utc("2026-03-31 10:00"), utc("2026-05-31 10:00")},
+		},
+		{
+			name:    "yearly on the second sunday of march",
+			rule:    "FREQ=YEARLY;BYMONTH=3;BYDAY=2SU;COUNT=2",
+			dtstart: utc("2026-03-08 10:00"),
+			want:    []time.Time{utc("2026-03-08 10:00"), utc("2027-03-14 10:00")},
+		},
+		{
+			name:    "keeps the wall-clock time across the spring DST change",
+			rule:    "FREQ=WEEKLY;COUNT=3",
+			dtstart: local("2026-03-22 09:00"), // DST starts on March 29
+			want:    []time.Time{local("2026-03-22 09:00"), local("2026-03-29 09:00"), local("2026-04-05 09:00")},
+		},
+		{
+			name:    "keeps the wall-clock time across the autumn DST change",
+			rule:    "FREQ=DAILY;COUNT=2",
+			dtstart: local("2026-10-24 09:00"), // DST ends on October 25
+			want:    []time.Time{local("2026-10-24 09:00"), local("2026-10-25 09:00")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRRule(tt.rule, func(string) *time.Location { return time.UTC })
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, to := tt.from, tt.to
+			if from.IsZero() {
+				from, to = utc("2026-01-01 00:00"), utc("2028-01-01 00:00")
+			}
+			got := rule.expand(tt.dtstart, from, to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("occurrence %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
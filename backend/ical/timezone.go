@@ -0,0 +1,111 @@
+package ical
+
+import (
+	"fmt"
+	"time"
+)
+
+// transition is a change of UTC offset (or zone name) in a location
+type transition struct {
+	at         time.Time // first instant of the new offset
+	fromOffset int
+	toOffset   int
+	name       string
+	dst        bool
+}
+
+// writeTimezone writes a VTIMEZONE for loc covering the calendar years of
+// [from, to]. Go doesn't expose the zone's rules, only the offset in effect
+// at any instant, so every transition is listed as its own observance
+// instead of an RRULE; clients treat both forms the same.
+func writeTimezone(w *writer, loc *time.Location, from, to time.Time) {
+	start := time.Date(from.In(loc).Year(), time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(to.In(loc).Year()+1, time.January, 1, 0, 0, 0, 0, loc)
+
+	w.line("BEGIN:VTIMEZONE")
+	w.line("TZID:" + loc.String())
+
+	// The observance in effect at the start of the range
+	name, offset := start.Zone()
+	writeObservance(w, transition{
+		at:         start,
+		fromOffset: offset,
+		toOffset:   offset,
+		name:       name,
+		dst:        start.IsDST(),
+	})
+
+	for _, t := range transitions(start, end) {
+		writeObservance(w, t)
+	}
+
+	w.line("END:VTIMEZONE")
+}
+
+func writeObservance(w *writer, t transition) {
+	kind := "STANDARD"
+	if t.dst {
+		kind = "DAYLIGHT"
+	}
+	// DTSTART is the local wall time just before the change, i.e. in the
+	// offset being left
+	local := t.at.UTC().Add(time.Duration(t.fromOffset) * time.Second)
+
+	w.line("BEGIN:" + kind)
+	w.line("DTSTART:" + local.Format("20060102T150405"))
+	w.line("TZOFFSETFROM:" + formatOffset(t.fromOffset))
+	w.line("TZOFFSETTO:" + formatOffset(t.toOffset))
+	w.line("TZNAME:" + escape(t.name))
+	w.line("END:" + kind)
+}
+
+// transitions finds every offset change in [start, end). Zones change at
+// most a few times a year, so a daily scan followed by a binary search for
+// the exact second is plenty fast.
+func transitions(start, end time.Time) []transition {
+	var found []transition
+	prev := start
+	prevName, prevOffset := prev.Zone()
+	for t := start.Add(24 * time.Hour); !prev.After(end); t = t.Add(24 * time.Hour) {
+		name, offset := t.Zone()
+		if name != prevName || offset != prevOffset {
+			// Narrow (prev, t] down to the first second with the new zone
+			lo, hi := prev.Unix(), t.Unix()
+			for hi-lo > 1 {
+				mid := lo + (hi-lo)/2
+				n, o := time.Unix(mid, 0).In(start.Location()).Zone()
+				if n == prevName && o == prevOffset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			at := time.Unix(hi, 0).In(start.Location())
+			if at.Before(end) {
+				found = append(found, transition{
+					at:         at,
+					fromOffset: prevOffset,
+					toOffset:   offset,
+					name:       name,
+					dst:        at.IsDST(),
+				})
+			}
+		}
+		prev, prevName, prevOffset = t, name, offset
+	}
+	return found
+}
+
+// formatOffset formats a UTC offset in seconds as +hhmm (or +hhmmss)
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	h, m, s := seconds/3600, seconds/60%60, seconds%60
+	if s != 0 {
+		return fmt.Sprintf("%s%02d%02d%02d", sign, h, m, s)
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, h, m)
+}
@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file into a directory.
+// The files can be opened with any mail client.
+type FileMailer struct {
+	Dir string
+	seq atomic.Int64
+}
+
+// NewFileMailer creates a FileMailer, creating dir if needed
+func NewFileMailer(dir string) (*FileMailer, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file mailer needs a directory, e.g. file:///tmp/mail")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{Dir: dir}, nil
+}
+
+// Send writes the message to a new file
+func (m *FileMailer) Send(msg Message) error {
+	data, err := buildMIME("booking@localhost", msg)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().UTC().Format("20060102T150405"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o644)
+}
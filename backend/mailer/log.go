@@ -0,0 +1,13 @@
+package mailer
+
+import "log"
+
+// LogMailer prints messages to the server log instead of sending them.
+// Useful for local development.
+type LogMailer struct{}
+
+// Send logs the message
+func (LogMailer) Send(msg Message) error {
+	log.Printf("MAIL to=%s subject=%q attachments=%d\n%s", msg.To, msg.Subject, len(msg.Attachments), msg.Text)
+	return nil
+}
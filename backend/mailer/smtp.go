@@ -0,0 +1,144 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends messages through an SMTP server. STARTTLS is used
+// automatically when the server offers it.
+type SMTPMailer struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message
+func (m *SMTPMailer) Send(msg Message) error {
+	data, err := buildMIME(m.From, msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, _ := net.SplitHostPort(m.Addr)
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	return smtp.SendMail(m.Addr, auth, m.From, []string{msg.To}, data)
+}
+
+// buildMIME renders msg as an RFC 5322 message. Messages with an HTML body
+// use multipart/alternative; attachments wrap everything in multipart/mixed.
+func buildMIME(from string, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "From: %s\r\n", sanitizeHeader(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", sanitizeHeader(msg.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", sanitizeHeader(msg.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(msg.Attachments) == 0 {
+		if err := writeBody(&buf, msg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	var body bytes.Buffer
+	if err := writeBody(&body, msg); err != nil {
+		return nil, err
+	}
+	header, content, _ := strings.Cut(body.String(), "\r\n\r\n")
+	part, err := mixed.CreatePart(parseHeader(header))
+	if err != nil {
+		return nil, err
+	}
+	part.Write([]byte(content))
+
+	for _, attachment := range msg.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", contentType+"; name=\""+sanitizeHeader(attachment.Filename)+"\"")
+		h.Set("Content-Disposition", "attachment; filename=\""+sanitizeHeader(attachment.Filename)+"\"")
+		h.Set("Content-Transfer-Encoding", "base64")
+		part, err := mixed.CreatePart(h)
+		if err != nil {
+			return nil, err
+		}
+		part.Write([]byte(wrapBase64(attachment.Data)))
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBody writes the Content-Type header(s) and body of a message
+// without attachments
+func writeBody(buf *bytes.Buffer, msg Message) error {
+	if msg.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+		buf.WriteString(wrapBase64([]byte(msg.Text)))
+		return nil
+	}
+
+	alt := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", alt.Boundary())
+	for _, p := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Type", p.contentType)
+		h.Set("Content-Transfer-Encoding", "base64")
+		part, err := alt.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		part.Write([]byte(wrapBase64([]byte(p.body))))
+	}
+	return alt.Close()
+}
+
+func parseHeader(raw string) textproto.MIMEHeader {
+	h := textproto.MIMEHeader{}
+	for _, line := range strings.Split(raw, "\r\n") {
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			h.Set(key, value)
+		}
+	}
+	return h
+}
+
+// wrapBase64 encodes data as base64 with 76-character lines
+func wrapBase64(data []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteString("\r\n")
+	return b.String()
+}
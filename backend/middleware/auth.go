@@ -3,87 +3,191 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/database"
 	"booking-backend/models"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-// Use the same secret key as in your handlers/auth.go
-var jwtSecret = []byte("gtm")
-
-// AuthMiddleware verifies the JWT token and attaches user info to the request
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware verifies the JWT token and attaches user info to the request.
+// The token's session is checked on every request so that logouts, password
+// changes and deactivated accounts take effect immediately. A business API
+// key may be sent instead of a token; its user has the role "api_key" and
+// RequireScope decides what it may call.
+func AuthMiddleware(db *database.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Get the token from the Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			c.Error(apierror.New(http.StatusUnauthorized, "Authorization header is required"))
 			c.Abort()
 			return
 		}
 
 		// 2. Check if the header has the "Bearer " prefix
 		if !strings.HasPrefix(authHeader, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization format must be 'Bearer {token}'"})
+			c.Error(apierror.New(http.StatusUnauthorized, "Authorization format must be 'Bearer {token}'"))
 			c.Abort()
 			return
 		}
 
 		// 3. Extract the token (remove "Bearer " prefix)
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if strings.HasPrefix(tokenString, auth.APIKeyPrefix) {
+			authenticateAPIKey(c, db, tokenString)
+			return
+		}
 
 		// 4. Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.NewValidationError("Unexpected signing method", jwt.ValidationErrorSignatureInvalid)
-			}
-			return jwtSecret, nil
-		})
-
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		claims, err := auth.ParseAccessToken(tokenString)
+		if err != nil {
+			c.Error(apierror.New(http.StatusUnauthorized, "Invalid or expired token"))
 			c.Abort()
 			return
 		}
 
-		// 5. Extract claims from the token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		// 5. Create a User object from the token claims
+		email, _ := claims["email"].(string)
+		role, _ := claims["role"].(string)
+		user := models.User{
+			ID:       auth.ClaimInt(claims, "user_id"),
+			Email:    email,
+			Role:     role,
+			IsActive: true,
+		}
+		if businessID := auth.ClaimInt(claims, "business_id"); businessID > 0 {
+			user.BusinessID = &businessID
+		}
+
+		// 6. Check that the session hasn't been revoked
+		sessionID := auth.ClaimInt(claims, "sid")
+		active, err := auth.SessionActive(db, sessionID, user.ID)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database error"))
+			c.Abort()
+			return
+		}
+		if !active {
+			c.Error(apierror.New(http.StatusUnauthorized, "Session has been revoked"))
 			c.Abort()
 			return
 		}
 
-		// 6. Create a User object from the token claims and attach it to the context
-		user := models.User{
-			ID:    int(claims["user_id"].(float64)), // JSON numbers are float64
-			Email: claims["email"].(string),
-			Role:  claims["role"].(string),
-		}
-		if businessID, exists := claims["business_id"]; exists {
-			var businessIDInt int
-			switch v := businessID.(type) {
-			case float64:
-				businessIDInt = int(v)
-			case int:
-				businessIDInt = v
-			default:
-				// Handle other types if needed
-				businessIDInt = 0
+		// 7. Store the user information in the context for use in handlers
+		c.Set("user", user)
+		c.Set("session_id", sessionID)
+
+		// 8. Continue to the next handler
+		c.Next()
+	}
+}
+
+// authenticateAPIKey lets a request made with an API key through as the
+// key's business
+func authenticateAPIKey(c *gin.Context, db *database.Store, key string) {
+	apiKey, err := auth.LookupAPIKey(db, key, time.Now())
+	if err == auth.ErrInvalidAPIKey {
+		c.Error(apierror.New(http.StatusUnauthorized, "Invalid or revoked API key"))
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal(err, "Database error"))
+		c.Abort()
+		return
+	}
+
+	c.Set("user", models.User{
+		FullName:   apiKey.Name,
+		Role:       RoleAPIKey,
+		BusinessID: &apiKey.BusinessID,
+		IsActive:   true,
+		APIKeyID:   &apiKey.ID,
+	})
+	c.Set("api_key_scopes", apiKey.Scopes)
+	c.Next()
+}
+
+// RoleAPIKey is the role of requests made with an API key
+const RoleAPIKey = "api_key"
+
+// RequireScope only lets API keys with scope through; users are checked
+// by their role as before. Routes without a scope ("") can't be called
+// with an API key. It must run after AuthMiddleware.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists || user.(models.User).APIKeyID == nil {
+			c.Next()
+			return
+		}
+		if scope == "" {
+			c.Error(apierror.New(http.StatusForbidden, "API keys can't use this endpoint"))
+			c.Abort()
+			return
+		}
+		for _, granted := range c.GetStringSlice("api_key_scopes") {
+			if granted == scope {
+				c.Next()
+				return
 			}
+		}
+		c.Error(apierror.New(http.StatusForbidden, "This API key doesn't have the "+scope+" scope"))
+		c.Abort()
+	}
+}
 
-			if businessIDInt > 0 {
-				user.BusinessID = &businessIDInt
+// RequireRole only lets users with one of the given roles through.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.Error(apierror.New(http.StatusUnauthorized, "User not authenticated"))
+			c.Abort()
+			return
+		}
+
+		currentUser := user.(models.User)
+		for _, role := range roles {
+			if currentUser.Role == role {
+				c.Next()
+				return
 			}
 		}
 
-		// 7. Store the user information in the context for use in handlers
-		c.Set("user", user)
+		c.Error(apierror.New(http.StatusForbidden, "You don't have permission to do this"))
+		c.Abort()
+	}
+}
 
-		// 8. Continue to the next handler
+// RequireWholeBusiness only lets through admins who aren't assigned to some
+// locations only (super admins always are), for routes that change the
+// whole business. It must run after RequireRole.
+func RequireWholeBusiness(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser := c.MustGet("user").(models.User)
+		if currentUser.Role == "super_admin" {
+			c.Next()
+			return
+		}
+
+		var locations int
+		err := db.QueryRow("SELECT COUNT(*) FROM location_staff WHERE user_id = $1", currentUser.ID).Scan(&locations)
+		if err != nil {
+			c.Error(apierror.Internal(err, "Could not check location permissions"))
+			c.Abort()
+			return
+		}
+		if locations > 0 {
+			c.Error(apierror.New(http.StatusForbidden, "Only admins of the whole business can do this"))
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Deprecated marks the responses of routes that are going away: the
+// Deprecation header (RFC 9745) says since when, Sunset (RFC 8594) until
+// when they are served, and Link points to the same route under the
+// successor prefix, e.g. /api/bookings -> /api/v1/bookings.
+func Deprecated(since, sunset time.Time, prefix, successor string) gin.HandlerFunc {
+	deprecation := fmt.Sprintf("@%d", since.Unix())
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+	return func(c *gin.Context) {
+		c.Header("Deprecation", deprecation)
+		c.Header("Sunset", sunsetDate)
+		path := successor + strings.TrimPrefix(c.Request.URL.Path, prefix)
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, path))
+		c.Next()
+	}
+}
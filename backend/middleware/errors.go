@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"booking-backend/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Errors renders the error a handler reported with c.Error as problem+json.
+// Errors that aren't *apierror.Error are internal: they are logged and the
+// client only learns that something went wrong.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		last := c.Errors.Last()
+		if last == nil || c.Writer.Written() {
+			return
+		}
+		var apiErr *apierror.Error
+		if !errors.As(last.Err, &apiErr) {
+			apiErr = apierror.Internal(last.Err, "Something went wrong")
+		}
+		renderProblem(c, apiErr)
+	}
+}
+
+// Recovery turns a panic into a 500 problem, like any other internal error
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		renderProblem(c, apierror.Internal(fmt.Errorf("panic: %v", recovered), "Something went wrong"))
+		c.Abort()
+	})
+}
+
+// NoRoute answers requests for paths the API doesn't have
+func NoRoute(c *gin.Context) {
+	c.Error(apierror.New(http.StatusNotFound, "No such endpoint").WithCode(apierror.CodeRouteNotFound))
+}
+
+// NoMethod answers requests with a method the path doesn't support
+func NoMethod(c *gin.Context) {
+	c.Error(apierror.New(http.StatusMethodNotAllowed, "Method not allowed on this endpoint"))
+}
+
+func renderProblem(c *gin.Context, err *apierror.Error) {
+	if err.Status >= http.StatusInternalServerError && errors.Unwrap(err) != nil {
+		log.Printf("%s %s: %v", c.Request.Method, c.Request.URL.Path, err)
+	}
+	if err.RetryAfter > 0 {
+		// Whole seconds, rounded up so clients don't retry too early
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	}
+	c.Header("Content-Type", "application/problem+json")
+	c.AbortWithStatusJSON(err.Status, err.Problem(c.Request.URL.Path))
+}
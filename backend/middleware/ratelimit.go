@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/models"
+	"booking-backend/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey names the bucket a request takes its token from, e.g.
+// "login:ip:203.0.113.7". Requests it returns "" for aren't limited.
+type RateLimitKey func(c *gin.Context) string
+
+// RateLimit answers 429 with Retry-After once the request's bucket is
+// empty. When the store fails, requests are let through: an outage of the
+// store shouldn't take the API down with it.
+func RateLimit(store ratelimit.Store, limit ratelimit.Limit, key RateLimitKey) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bucket := key(c)
+		if bucket == "" {
+			c.Next()
+			return
+		}
+
+		result, err := store.Take(c.Request.Context(), bucket, limit, time.Now())
+		if err != nil {
+			log.Printf("rate limit %s: %v", bucket, err)
+			c.Next()
+			return
+		}
+		if !result.Allowed {
+			c.Error(apierror.New(http.StatusTooManyRequests, "Too many requests, please try again later").WithRetryAfter(result.RetryAfter))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ByIP keys buckets by the client's IP address. Behind a proxy this is
+// only the real client's if the proxy is trusted (see --trusted-proxies).
+func ByIP(name string) RateLimitKey {
+	return func(c *gin.Context) string {
+		return name + ":ip:" + c.ClientIP()
+	}
+}
+
+// ByUser keys buckets by the logged in user; requests made with an API
+// key aren't limited by it. It must run after AuthMiddleware.
+func ByUser(name string) RateLimitKey {
+	return func(c *gin.Context) string {
+		user, exists := c.Get("user")
+		if !exists || user.(models.User).APIKeyID != nil {
+			return ""
+		}
+		return fmt.Sprintf("%s:user:%d", name, user.(models.User).ID)
+	}
+}
+
+// ByAPIKey keys buckets by the API key the request was made with; other
+// requests aren't limited by it. It must run after AuthMiddleware.
+func ByAPIKey(name string) RateLimitKey {
+	return func(c *gin.Context) string {
+		user, exists := c.Get("user")
+		if !exists || user.(models.User).APIKeyID == nil {
+			return ""
+		}
+		return fmt.Sprintf("%s:apikey:%d", name, *user.(models.User).APIKeyID)
+	}
+}
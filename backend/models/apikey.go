@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// APIKey lets a partner's server call the API for a business without a
+// user login. Key is only returned when the key is created.
+type APIKey struct {
+	ID         int        `json:"id"`
+	BusinessID int        `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // the start of the key, to tell keys apart
+	Key        string     `json:"key,omitempty"`
+	Scopes     []string   `json:"scopes"` // e.g. ["read:slots", "write:bookings"]
+	CreatedBy  *int       `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKeyRequest names a new key and lists what it may do
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+}
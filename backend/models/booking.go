@@ -0,0 +1,103 @@
+package models
+
+import "time"
+
+// Booking represents a customer's appointment in a slot
+type Booking struct {
+	ID              int       `json:"id"`
+	SlotID          int       `json:"slot_id"`
+	ServiceID       int       `json:"service_id"`
+	ServiceName     string    `json:"service_name"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	Status          string    `json:"status"` // scheduled, completed, cancelled, no-show
+	Notes           string    `json:"notes,omitempty"`
+	CustomerID      *int      `json:"customer_id,omitempty"` // the account, once its email is verified
+	CustomerName    string    `json:"customer_name"`
+	CustomerEmail   string    `json:"customer_email"`
+	CustomerPhone   string    `json:"customer_phone,omitempty"`
+	BusinessID      int       `json:"business_id"`
+	LocationID      *int      `json:"location_id,omitempty"`
+	Seats           int       `json:"seats"`
+	RescheduleCount int       `json:"reschedule_count"`
+	FeeCents        int       `json:"fee_cents"`          // owed under the cancellation policy
+	FeeRule         string    `json:"fee_rule,omitempty"` // the rule that set the fee
+	CreatedAt       time.Time `json:"created_at"`
+
+	Services []BookingService `json:"services,omitempty"` // multi-service bookings only
+}
+
+// BookingService is one of the services of a multi-service booking, in the
+// order they take place
+type BookingService struct {
+	Position    int       `json:"position"`
+	ServiceID   int       `json:"service_id"`
+	ServiceName string    `json:"service_name"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+}
+
+// CreateBookingRequest represents the data a customer sends to book a slot.
+// HoldToken comes from holding the slot first (POST /api/v1/public/slots/:id/hold).
+type CreateBookingRequest struct {
+	BusinessID    int    `json:"business_id" binding:"required"`
+	SlotID        int    `json:"slot_id" binding:"required"`
+	HoldToken     string `json:"hold_token" binding:"required"`
+	CustomerName  string `json:"customer_name" binding:"required"`
+	CustomerEmail string `json:"customer_email" binding:"required,email"`
+	CustomerPhone string `json:"customer_phone,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+}
+
+// PublicBookingResponse is returned to the customer after booking. The
+// manage token lets them view or cancel the booking without an account.
+type PublicBookingResponse struct {
+	Message     string  `json:"message"`
+	Booking     Booking `json:"booking"`
+	ManageToken string  `json:"manage_token"`
+}
+
+// RescheduleBookingRequest moves a booking to another slot of the same
+// service. Force lets the business ignore the cutoff and reschedule limit.
+type RescheduleBookingRequest struct {
+	SlotID int  `json:"slot_id" binding:"required"`
+	Force  bool `json:"force,omitempty"`
+}
+
+// BookingEvent is one entry in a booking's history
+type BookingEvent struct {
+	ID         int        `json:"id"`
+	Event      string     `json:"event"` // created, rescheduled, cancelled, no-show
+	FromSlotID *int       `json:"from_slot_id,omitempty"`
+	ToSlotID   *int       `json:"to_slot_id,omitempty"`
+	FromStart  *time.Time `json:"from_start,omitempty"`
+	ToStart    *time.Time `json:"to_start,omitempty"`
+	Actor      string     `json:"actor"` // customer or business
+	UserID     *int       `json:"user_id,omitempty"`
+	APIKeyID   *int       `json:"api_key_id,omitempty"` // when a partner's integration made the change
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// NotificationTemplateRequest represents a business's own notification template
+type NotificationTemplateRequest struct {
+	Subject  string `json:"subject"`
+	BodyText string `json:"body_text" binding:"required"`
+	BodyHTML string `json:"body_html"`
+}
+
+// CancellationPolicy is a business's rule for what cancelling or missing
+// a booking costs
+type CancellationPolicy struct {
+	FreeHours        int `json:"free_until_hours"`    // free until this many hours before the start
+	LateFeePercent   int `json:"late_fee_percent"`    // of the price, for later cancellations
+	NoShowFeePercent int `json:"no_show_fee_percent"` // of the price, for no-shows
+}
+
+// CancellationOutcome is how the policy applied to a cancellation or
+// no-show
+type CancellationOutcome struct {
+	Rule       string `json:"rule"` // free, late_cancellation, no_show, cancelled_by_business
+	FeePercent int    `json:"fee_percent"`
+	FeeCents   int    `json:"fee_cents"`
+	Policy     string `json:"policy"` // the policy text
+}
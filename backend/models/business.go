@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// BusinessSettings holds the per-business configuration an admin can change
+type BusinessSettings struct {
+	Timezone        string `json:"timezone"`
+	ReminderOffsets []int  `json:"reminder_offsets_minutes"` // e.g. [1440, 120] = 24h and 2h before
+
+	// Customers can't reschedule within RescheduleCutoff minutes of the
+	// start, nor more than MaxReschedules times (0 turns rescheduling off)
+	RescheduleCutoff int `json:"reschedule_cutoff_minutes"`
+	MaxReschedules   int `json:"max_reschedules"`
+
+	CancellationPolicy CancellationPolicy `json:"cancellation_policy"`
+	CancellationText   string             `json:"cancellation_policy_text"` // read-only
+
+	// Staff and admins must log in with two-factor authentication
+	RequireTwoFactor bool `json:"require_two_factor"`
+}
+
+// UpdateBusinessSettingsRequest represents a partial settings update;
+// omitted fields keep their current value
+type UpdateBusinessSettingsRequest struct {
+	Timezone         *string `json:"timezone"`
+	ReminderOffsets  *[]int  `json:"reminder_offsets_minutes"`
+	RescheduleCutoff *int    `json:"reschedule_cutoff_minutes"`
+	MaxReschedules   *int    `json:"max_reschedules"`
+
+	CancellationPolicy *CancellationPolicy `json:"cancellation_policy"`
+	RequireTwoFactor   *bool               `json:"require_two_factor"`
+}
+
+// BusinessProfile is what customers see on a business's booking page
+type BusinessProfile struct {
+	ID           int          `json:"id"`
+	Slug         string       `json:"slug"`
+	Name         string       `json:"name"`
+	Description  string       `json:"description,omitempty"`
+	Category     string       `json:"category,omitempty"`
+	Address      string       `json:"address,omitempty"`
+	City         string       `json:"city,omitempty"`
+	Phone        string       `json:"phone,omitempty"`
+	Email        string       `json:"email,omitempty"`
+	Website      string       `json:"website,omitempty"`
+	LogoURL      string       `json:"logo_url,omitempty"`
+	Timezone     string       `json:"timezone"`
+	OpeningHours OpeningHours `json:"opening_hours,omitempty"`
+
+	Locations []Location `json:"locations,omitempty"` // public profile only
+}
+
+// UpdateBusinessProfileRequest represents a partial profile update;
+// omitted fields keep their current value and "" clears a field
+type UpdateBusinessProfileRequest struct {
+	Slug         *string       `json:"slug"`
+	Name         *string       `json:"name"`
+	Description  *string       `json:"description"`
+	Category     *string       `json:"category"`
+	Address      *string       `json:"address"`
+	City         *string       `json:"city"`
+	Phone        *string       `json:"phone"`
+	Email        *string       `json:"email"`
+	Website      *string       `json:"website"`
+	LogoURL      *string       `json:"logo_url"`
+	OpeningHours *OpeningHours `json:"opening_hours"`
+}
+
+// BusinessSearchResult is one business in the directory search
+type BusinessSearchResult struct {
+	Slug          string     `json:"slug"`
+	Name          string     `json:"name"`
+	Description   string     `json:"description,omitempty"`
+	Category      string     `json:"category,omitempty"`
+	City          string     `json:"city,omitempty"`
+	LogoURL       string     `json:"logo_url,omitempty"`
+	NextAvailable *time.Time `json:"next_available,omitempty"` // the first open slot (on the date searched for)
+}
+
+// BusinessSearchResponse is a page of search results, best match first
+type BusinessSearchResponse struct {
+	Results    []BusinessSearchResult `json:"results"`
+	Total      int                    `json:"total"`
+	Limit      int                    `json:"limit"`
+	Offset     int                    `json:"offset"`
+	NextOffset *int                   `json:"next_offset,omitempty"` // unset on the last page
+}
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// CalendarFeed is a secret URL serving a business's (or one staff
+// member's) bookings as an iCalendar feed. URL and Token are only returned
+// when the feed is created.
+type CalendarFeed struct {
+	ID         int        `json:"id"`
+	StaffID    *int       `json:"staff_id,omitempty"` // nil for the whole business
+	StaffName  string     `json:"staff_name,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// CreateCalendarFeedRequest selects whose bookings a new feed shows
+type CreateCalendarFeedRequest struct {
+	StaffID *int `json:"staff_id"`
+}
+
+// CalendarImport is an external calendar whose events block availability
+type CalendarImport struct {
+	ID           int        `json:"id"`
+	StaffID      *int       `json:"staff_id,omitempty"` // nil blocks the whole business
+	StaffName    string     `json:"staff_name,omitempty"`
+	Name         string     `json:"name"`
+	URL          string     `json:"url,omitempty"` // empty for uploaded files
+	BusyCount    int        `json:"busy_count"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// CreateCalendarImportRequest registers an ICS URL. Files are uploaded as
+// multipart/form-data with the same fields plus "file".
+type CreateCalendarImportRequest struct {
+	StaffID *int   `json:"staff_id" form:"staff_id"`
+	Name    string `json:"name" form:"name"`
+	URL     string `json:"url" form:"url"`
+}
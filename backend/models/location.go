@@ -0,0 +1,41 @@
+package models
+
+// OpeningHours maps a weekday ("mon" ... "sun") to the periods a location
+// is open that day; days without periods are closed
+type OpeningHours map[string][]OpeningPeriod
+
+// OpeningPeriod is one stretch of opening time, e.g. 09:00 to 12:30
+type OpeningPeriod struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// Location is one of the places a business takes appointments at, with
+// its own address, timezone, opening hours and staff
+type Location struct {
+	ID           int          `json:"id"`
+	BusinessID   int          `json:"business_id"`
+	Name         string       `json:"name"`
+	Address      string       `json:"address,omitempty"`
+	City         string       `json:"city,omitempty"`
+	Timezone     string       `json:"timezone"`
+	OpeningHours OpeningHours `json:"opening_hours,omitempty"` // unset: slots can be generated at any time
+	IsActive     bool         `json:"is_active"`
+	StaffIDs     []int        `json:"staff_ids,omitempty"` // admin view only
+}
+
+// LocationRequest represents the data needed to create or replace a
+// location
+type LocationRequest struct {
+	Name         string       `json:"name" binding:"required"`
+	Address      string       `json:"address"`
+	City         string       `json:"city"`
+	Timezone     string       `json:"timezone"` // defaults to the business's timezone
+	OpeningHours OpeningHours `json:"opening_hours"`
+	IsActive     *bool        `json:"is_active"` // defaults to true
+}
+
+// SetLocationStaffRequest lists everyone who works at a location
+type SetLocationStaffRequest struct {
+	UserIDs []int `json:"user_ids" binding:"required"`
+}
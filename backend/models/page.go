@@ -0,0 +1,9 @@
+package models
+
+// Page is one page of a list. NextCursor, passed as ?cursor=, fetches the
+// next page; it is unset on the last one.
+type Page struct {
+	Items      interface{} `json:"items"`
+	Total      int         `json:"total"` // matching rows on all pages
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
@@ -11,6 +11,10 @@ type TimeSlot struct {
 	ServiceID   int       `json:"service_id"`
 	ServiceName string    `json:"service_name,omitempty"` // for responses
 	BusinessID  int       `json:"business_id"`
+	StaffID     *int      `json:"staff_id,omitempty"`
+	LocationID  *int      `json:"location_id,omitempty"`
+	Capacity    int       `json:"capacity"`
+	BookedCount int       `json:"booked_count"`
 }
 
 // GenerateSlotsRequest represents the data needed to generate time slots
@@ -21,6 +25,8 @@ type GenerateSlotsRequest struct {
 	StartTime string    `json:"start_time" binding:"required"` // e.g., "09:00"
 	EndTime   string    `json:"end_time" binding:"required"`   // e.g., "17:00"
 	Interval  int       `json:"interval" binding:"required"`   // minutes between slots (e.g., 30)
+	StaffID   *int      `json:"staff_id,omitempty"`            // staff member who takes these appointments
+	Capacity  int       `json:"capacity" binding:"min=0"`      // seats per slot; defaults to the service's capacity
 }
 
 // PublicTimeSlot represents slot data for public API (customers)
@@ -31,4 +37,31 @@ type PublicTimeSlot struct {
 	ServiceID   int       `json:"service_id"`
 	ServiceName string    `json:"service_name"`
 	Duration    int       `json:"duration"`
+	Capacity    int       `json:"capacity"`
+	SeatsLeft   int       `json:"seats_left"`
+
+	Services []BookingService `json:"services,omitempty"` // when several services were asked for
+}
+
+// SlotHold reserves a slot for a customer while they fill in their details
+type SlotHold struct {
+	SlotID    int       `json:"slot_id"`
+	Seats     int       `json:"seats"`
+	Token     string    `json:"hold_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	Services []BookingService `json:"services,omitempty"`
+}
+
+// HoldSlotRequest says how many seats to hold and, for several services
+// back to back, which ones. The body is optional and defaults to one seat
+// for the slot's own service.
+type HoldSlotRequest struct {
+	Seats      int   `json:"seats" binding:"min=0"`
+	ServiceIDs []int `json:"service_ids"` // in order, starting with the slot's service
+}
+
+// ReleaseSlotHoldRequest gives a held slot back before the hold expires
+type ReleaseSlotHoldRequest struct {
+	HoldToken string `json:"hold_token" binding:"required"`
 }
@@ -2,12 +2,16 @@ package models
 
 // User represents a user in the system
 type User struct {
-	ID           int    `json:"id"`
-	Email        string `json:"email"`
-	PasswordHash string `json:"-"` // The - means this field won't be shown in JSON
-	FullName     string `json:"full_name"`
-	Role         string `json:"role"`
-	BusinessID   *int   `json:"business_id"` // Use pointer to allow NULL values
+	ID            int    `json:"id"`
+	Email         string `json:"email"`
+	PasswordHash  string `json:"-"` // The - means this field won't be shown in JSON
+	FullName      string `json:"full_name"`
+	Role          string `json:"role"`
+	BusinessID    *int   `json:"business_id"` // Use pointer to allow NULL values
+	IsActive      bool   `json:"is_active"`
+	EmailVerified bool   `json:"email_verified"`
+	TwoFactor     bool   `json:"two_factor_enabled"`
+	APIKeyID      *int   `json:"api_key_id,omitempty"` // set when a request is made with an API key
 }
 
 // LoginRequest represents the data sent for login
@@ -16,12 +20,115 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// LoginResponse represents the data returned after successful login
+// LoginResponse represents the data returned after successful login.
+// Users with two-factor authentication get mfa_required and an mfa_token
+// instead of the tokens, to exchange at /api/v1/login/2fa with a code.
 type LoginResponse struct {
-	Message string `json:"message"`
-	Token   string `json:"token"`
-	User    User   `json:"user"`
+	Message      string `json:"message"`
+	Token        string `json:"token,omitempty"`         // short-lived access token
+	RefreshToken string `json:"refresh_token,omitempty"` // use with /api/v1/token/refresh
+	ExpiresIn    int    `json:"expires_in,omitempty"`    // access token lifetime in seconds
+	User         *User  `json:"user,omitempty"`
+
+	MFARequired      bool     `json:"mfa_required,omitempty"`
+	MFASetupRequired bool     `json:"mfa_setup_required,omitempty"` // the business requires 2FA; set it up with /api/v1/login/2fa/setup first
+	MFAToken         string   `json:"mfa_token,omitempty"`
+	RecoveryCodes    []string `json:"recovery_codes,omitempty"` // when 2FA was set up while logging in
+}
+
+// MFALoginRequest represents the second step of logging in
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"` // from the authenticator app, or a recovery code
+}
+
+// MFASetupLoginRequest represents the data sent to set up required 2FA
+// while logging in
+type MFASetupLoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
 }
+
+// TOTPSetupResponse represents the secret to add to an authenticator app
+type TOTPSetupResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"` // show as a QR code
+}
+
+// TwoFactorCodeRequest represents a code from the authenticator app (or a
+// recovery code) confirming a change to two-factor authentication
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse represents newly issued recovery codes, shown once
+type RecoveryCodesResponse struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// OIDCProvider is a provider users can sign in with
+type OIDCProvider struct {
+	Name string `json:"name"`
+}
+
+// OIDCStartResponse represents where to send the user to sign in
+type OIDCStartResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// OIDCCallbackRequest represents the data the provider sent the user back with
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// RefreshRequest represents the data sent to exchange a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse represents a new access/refresh token pair
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// LogoutRequest represents the (optional) data sent to log out
+type LogoutRequest struct {
+	AllSessions bool `json:"all_sessions"` // log out everywhere, not just this session
+}
+
+// ChangePasswordRequest represents the data sent to change a password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// ForgotPasswordRequest represents the data sent to request a password reset
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the data sent to set a new password with a reset token
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// VerifyEmailRequest represents the data sent to verify an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CreateStaffRequest represents the data needed to add a staff member
+type CreateStaffRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	FullName string `json:"full_name" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// RegistrationRequest represents the data sent to register a business
 type RegistrationRequest struct {
 	BusinessName string `json:"business_name" binding:"required"`
 	Email        string `json:"email" binding:"required,email"`
@@ -31,16 +138,19 @@ type RegistrationRequest struct {
 
 // RegistrationResponse represents the data returned after successful registration
 type RegistrationResponse struct {
-	Message  string   `json:"message"`
-	Token    string   `json:"token"`
-	User     User     `json:"user"`
-	Business Business `json:"business"`
+	Message      string   `json:"message"`
+	Token        string   `json:"token"`
+	RefreshToken string   `json:"refresh_token"`
+	ExpiresIn    int      `json:"expires_in"`
+	User         User     `json:"user"`
+	Business     Business `json:"business"`
 }
 
 // Business represents a business entity
 type Business struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
+	Slug string `json:"slug,omitempty"` // the public booking page is at /b/:slug
 }
 
 // Service represents a service offered by a business
@@ -50,6 +160,7 @@ type Service struct {
 	Description string `json:"description,omitempty"`             // optional
 	Duration    int    `json:"duration" binding:"required,min=1"` // in minutes
 	BusinessID  int    `json:"business_id"`                       // will be set from context, not from request
+	Buffer      int    `json:"buffer_minutes"`                    // time needed before the next service of a booking
 }
 
 // CreateServiceRequest represents the data needed to create a service
@@ -57,12 +168,21 @@ type CreateServiceRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description,omitempty"`
 	Duration    int    `json:"duration" binding:"required,min=1"`
+	PriceCents  int    `json:"price_cents" binding:"min=0"`    // optional, in the smallest currency unit
+	Capacity    int    `json:"capacity" binding:"min=0"`       // optional seats per slot, e.g. 12 for a class; defaults to 1
+	Buffer      int    `json:"buffer_minutes" binding:"min=0"` // optional time needed before a following service
+	LocationID  *int   `json:"location_id"`                    // defaults to the business's first location
 }
 
 // ServiceResponse represents the service data returned in responses
 type ServiceResponse struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Description string `json:"description,omitempty"`
-	Duration    int    `json:"duration"`
+	ID                 int    `json:"id"`
+	Name               string `json:"name"`
+	Description        string `json:"description,omitempty"`
+	Duration           int    `json:"duration"`
+	PriceCents         int    `json:"price_cents"`
+	Capacity           int    `json:"capacity"`
+	Buffer             int    `json:"buffer_minutes"`
+	LocationID         *int   `json:"location_id"`
+	CancellationPolicy string `json:"cancellation_policy,omitempty"` // public listing only
 }
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// WaitlistEntry is a customer waiting for a slot of a service in a time
+// window
+type WaitlistEntry struct {
+	ID             int        `json:"id"`
+	ServiceID      int        `json:"service_id"`
+	ServiceName    string     `json:"service_name"`
+	CustomerName   string     `json:"customer_name"`
+	CustomerEmail  string     `json:"customer_email"`
+	WindowStart    time.Time  `json:"window_start"`
+	WindowEnd      time.Time  `json:"window_end"`
+	Notes          string     `json:"notes,omitempty"`
+	Status         string     `json:"status"` // waiting, offered, booked, expired, left
+	OfferedSlotID  *int       `json:"offered_slot_id,omitempty"`
+	OfferedStart   *time.Time `json:"offered_start_time,omitempty"`
+	OfferExpiresAt *time.Time `json:"offer_expires_at,omitempty"`
+	BookingID      *int       `json:"booking_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// JoinWaitlistRequest represents a customer asking to be told when a slot
+// frees up. Date is a day in the business's timezone; FromTime and ToTime
+// ("HH:MM") narrow the window and default to the whole day.
+type JoinWaitlistRequest struct {
+	BusinessID    int    `json:"business_id" binding:"required"`
+	ServiceID     int    `json:"service_id" binding:"required"`
+	Date          string `json:"date" binding:"required"`
+	FromTime      string `json:"from_time,omitempty"`
+	ToTime        string `json:"to_time,omitempty"`
+	CustomerName  string `json:"customer_name" binding:"required"`
+	CustomerEmail string `json:"customer_email" binding:"required,email"`
+	CustomerPhone string `json:"customer_phone,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+}
+
+// JoinWaitlistResponse is returned to the customer after joining. The token
+// lets them check, accept an offer or leave without an account.
+type JoinWaitlistResponse struct {
+	Message string        `json:"message"`
+	Entry   WaitlistEntry `json:"entry"`
+	Token   string        `json:"token"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookEndpoint is a URL a business wants events POSTed to. The secret
+// is only returned when the endpoint is created.
+type WebhookEndpoint struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"` // e.g. ["booking.created"], or ["*"] for all
+	IsActive  bool      `json:"is_active"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateWebhookRequest represents the data needed to register an endpoint
+type CreateWebhookRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events" binding:"required"`
+}
+
+// UpdateWebhookRequest represents a partial endpoint update; omitted fields
+// keep their current value
+type UpdateWebhookRequest struct {
+	URL      *string   `json:"url" binding:"omitempty,url"`
+	Events   *[]string `json:"events"`
+	IsActive *bool     `json:"is_active"`
+}
+
+// WebhookDelivery is one attempt log entry of an event sent to an endpoint
+type WebhookDelivery struct {
+	ID             int             `json:"id"`
+	EndpointID     int             `json:"endpoint_id"`
+	Event          string          `json:"event"`
+	EventID        string          `json:"event_id"`
+	Status         string          `json:"status"` // pending, delivered, failed
+	Attempts       int             `json:"attempts"`
+	ResponseStatus *int            `json:"response_status,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/ical"
+	"booking-backend/mailer"
+)
+
+// calendarEvents are emailed with the booking attached as an .ics file
+var calendarEvents = map[string]bool{
+	EventBookingCreated:     true,
+	EventBookingRescheduled: true,
+}
+
+// Dispatcher delivers queued notifications, retrying failures with
+// exponential backoff. Several dispatchers (e.g. one per replica) can run
+// against the same database: rows are leased before they are sent.
+type Dispatcher struct {
+	DB          *database.Store
+	Notifier    Notifier
+	Interval    time.Duration // how often to poll the outbox
+	BatchSize   int
+	MaxAttempts int           // give up after this many failed attempts
+	Lease       time.Duration // how long a claimed row is reserved for this dispatcher
+	AppURL      string        // base URL of the frontend for links in .ics attachments
+}
+
+// NewDispatcher creates a Dispatcher with sensible defaults
+func NewDispatcher(db *database.Store, notifier Notifier) *Dispatcher {
+	return &Dispatcher{
+		DB:          db,
+		Notifier:    notifier,
+		Interval:    5 * time.Second,
+		BatchSize:   20,
+		MaxAttempts: 8,
+		Lease:       2 * time.Minute,
+	}
+}
+
+// Run delivers notifications until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchDue(ctx); err != nil {
+			log.Printf("notify: dispatch failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type outboxRow struct {
+	id        int
+	attempts  int
+	event     string
+	bookingID sql.NullInt64
+	n         Notification
+}
+
+// DispatchDue sends every notification that is due and returns how many
+// were delivered
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	rows, err := d.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, row := range rows {
+		d.attachCalendar(&row)
+
+		now := time.Now()
+		if err := d.Notifier.Send(ctx, row.n); err != nil {
+			attempts := row.attempts + 1
+			if attempts >= d.MaxAttempts {
+				_, err = d.DB.Exec(
+					"UPDATE notification_outbox SET attempts = $1, last_error = $2, failed_at = $3, locked_until = NULL WHERE id = $4",
+					attempts, err.Error(), now, row.id,
+				)
+			} else {
+				_, err = d.DB.Exec(
+					"UPDATE notification_outbox SET attempts = $1, last_error = $2, next_attempt_at = $3, locked_until = NULL WHERE id = $4",
+					attempts, err.Error(), now.Add(Backoff(attempts)), row.id,
+				)
+			}
+			if err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		_, err := d.DB.Exec(
+			"UPDATE notification_outbox SET attempts = attempts + 1, sent_at = $1, locked_until = NULL WHERE id = $2",
+			now, row.id,
+		)
+		if err != nil {
+			return sent, err
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// claim leases a batch of due notifications to this dispatcher
+func (d *Dispatcher) claim() ([]outboxRow, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	rows, err := tx.Query(`
+		SELECT id, event, booking_id, channel, recipient, subject, body_text, body_html, attempts
+		FROM notification_outbox
+		WHERE sent_at IS NULL AND failed_at IS NULL
+		AND next_attempt_at <= $1
+		AND (locked_until IS NULL OR locked_until < $1)
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`,
+		now, d.BatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []outboxRow
+	for rows.Next() {
+		var row outboxRow
+		if err := rows.Scan(&row.id, &row.event, &row.bookingID, &row.n.Channel, &row.n.To, &row.n.Subject, &row.n.Text, &row.n.HTML, &row.attempts); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		claimed = append(claimed, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, row := range claimed {
+		if _, err := tx.Exec("UPDATE notification_outbox SET locked_until = $1 WHERE id = $2", now.Add(d.Lease), row.id); err != nil {
+			return nil, err
+		}
+	}
+
+	return claimed, tx.Commit()
+}
+
+// attachCalendar attaches the booking's .ics file to confirmation emails.
+// It is built when the email is sent rather than stored with it, so it
+// reflects the booking as it is now. Failing to build it doesn't hold up
+// the email.
+func (d *Dispatcher) attachCalendar(row *outboxRow) {
+	if row.n.Channel != ChannelEmail || !row.bookingID.Valid || !calendarEvents[row.event] {
+		return
+	}
+	cal, err := ical.BookingFile(d.DB, int(row.bookingID.Int64), d.AppURL)
+	if err != nil {
+		log.Printf("notify: could not build calendar for booking %d: %v", row.bookingID.Int64, err)
+		return
+	}
+	row.n.Attachments = append(row.n.Attachments, mailer.Attachment{
+		Filename:    "booking.ics",
+		ContentType: ical.ContentType + "; method=PUBLISH",
+		Data:        cal.Bytes(),
+	})
+}
+
+// Backoff returns how long to wait before retry number attempt (1-based):
+// 30s, 1m, 2m, 4m ... capped at 6 hours
+func Backoff(attempt int) time.Duration {
+	delay := 30 * time.Second
+	for i := 1; i < attempt && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+	return delay
+}
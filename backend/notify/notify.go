@@ -0,0 +1,95 @@
+// Package notify delivers booking notifications (confirmations, reminders,
+// business alerts) over email and SMS.
+//
+// Handlers never send directly: they enqueue rendered messages in the
+// notification_outbox table and a Dispatcher delivers them in the
+// background, retrying failures, so a broken mail server can't fail a
+// booking request.
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	"booking-backend/mailer"
+)
+
+// Delivery channels
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+// Notification is a rendered message ready to deliver
+type Notification struct {
+	Channel     string
+	To          string // email address or phone number
+	Subject     string // email only
+	Text        string
+	HTML        string // email only, optional
+	Attachments []mailer.Attachment
+}
+
+// Notifier delivers notifications over one channel
+type Notifier interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// EmailNotifier sends notifications through a mailer (SMTP in production)
+type EmailNotifier struct {
+	Mailer mailer.Mailer
+}
+
+// NewEmailNotifier creates an EmailNotifier
+func NewEmailNotifier(m mailer.Mailer) *EmailNotifier {
+	return &EmailNotifier{Mailer: m}
+}
+
+// Send emails the notification
+func (e *EmailNotifier) Send(ctx context.Context, n Notification) error {
+	return e.Mailer.Send(mailer.Message{
+		To:          n.To,
+		Subject:     n.Subject,
+		Text:        n.Text,
+		HTML:        n.HTML,
+		Attachments: n.Attachments,
+	})
+}
+
+// SMSProvider is implemented by SMS gateways (Twilio, MessageBird, ...)
+type SMSProvider interface {
+	SendSMS(ctx context.Context, to string, body string) error
+}
+
+// SMSNotifier sends notifications as text messages through a provider
+type SMSNotifier struct {
+	Provider SMSProvider
+}
+
+// NewSMSNotifier creates an SMSNotifier
+func NewSMSNotifier(p SMSProvider) *SMSNotifier {
+	return &SMSNotifier{Provider: p}
+}
+
+// Send texts the notification body
+func (s *SMSNotifier) Send(ctx context.Context, n Notification) error {
+	return s.Provider.SendSMS(ctx, n.To, n.Text)
+}
+
+// Router picks a Notifier by channel
+type Router map[string]Notifier
+
+// Send delivers n through the notifier registered for its channel
+func (r Router) Send(ctx context.Context, n Notification) error {
+	notifier, ok := r[n.Channel]
+	if !ok {
+		return fmt.Errorf("no notifier configured for channel %q", n.Channel)
+	}
+	return notifier.Send(ctx, n)
+}
+
+// Has reports whether a channel is configured
+func (r Router) Has(channel string) bool {
+	_, ok := r[channel]
+	return ok
+}
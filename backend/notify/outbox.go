@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"booking-backend/database"
+)
+
+// businessEvents maps a customer event to the alert sent to the business
+var businessEvents = map[string]string{
+	EventBookingCreated:   EventBusinessNewBooking,
+	EventBookingCancelled: EventBusinessBookingCancelled,
+}
+
+// Outbox renders booking notifications and queues them for the Dispatcher
+type Outbox struct {
+	DB       *database.Store
+	Channels []string // channels that can be delivered, e.g. email and sms
+	AppURL   string   // base URL of the frontend for links in messages
+}
+
+// Notify queues the notifications for a booking event. It is meant to be
+// called after the booking transaction has committed; errors are logged and
+// never reach the customer.
+func (o *Outbox) Notify(event string, bookingID int) {
+	if err := o.Enqueue(o.DB, event, bookingID, nil); err != nil {
+		log.Printf("notify: could not queue %s for booking %d: %v", event, bookingID, err)
+	}
+}
+
+// NotifyRescheduled queues the notifications for a moved booking
+func (o *Outbox) NotifyRescheduled(bookingID int, previousStart time.Time) {
+	if err := o.Enqueue(o.DB, EventBookingRescheduled, bookingID, &previousStart); err != nil {
+		log.Printf("notify: could not queue %s for booking %d: %v", EventBookingRescheduled, bookingID, err)
+	}
+}
+
+// Enqueue renders and queues the notifications for a booking event using q,
+// which may be a transaction. previousStart is only used for reschedules.
+func (o *Outbox) Enqueue(q database.Querier, event string, bookingID int, previousStart *time.Time) error {
+	data, businessID, err := o.loadBookingData(q, bookingID)
+	if err != nil {
+		return err
+	}
+	if previousStart != nil {
+		loc := data.Start.Location()
+		data.PreviousDate = previousStart.In(loc).Format("Monday, 2 January 2006")
+		data.PreviousTime = previousStart.In(loc).Format("15:04")
+	}
+
+	// Customer notifications
+	for _, channel := range o.Channels {
+		recipient := data.CustomerEmail
+		if channel == ChannelSMS {
+			recipient = data.CustomerPhone
+		}
+		if recipient == "" {
+			continue
+		}
+		if err := o.enqueueOne(q, businessID, &bookingID, event, channel, recipient, data); err != nil {
+			return err
+		}
+	}
+
+	// Business alerts go to the business admins by email
+	if businessEvent, ok := businessEvents[event]; ok {
+		rows, err := q.Query(
+			"SELECT email FROM users WHERE business_id = $1 AND role = 'business_admin' AND is_active = true",
+			businessID,
+		)
+		if err != nil {
+			return err
+		}
+		var admins []string
+		for rows.Next() {
+			var email string
+			if err := rows.Scan(&email); err != nil {
+				rows.Close()
+				return err
+			}
+			admins = append(admins, email)
+		}
+		rows.Close()
+
+		for _, email := range admins {
+			if err := o.enqueueOne(q, businessID, &bookingID, businessEvent, ChannelEmail, email, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// enqueueOne renders and queues one notification. bookingID is nil for
+// notifications that aren't about a booking yet, such as waitlist offers.
+func (o *Outbox) enqueueOne(q database.Querier, businessID int, bookingID *int, event, channel, recipient string, data TemplateData) error {
+	tmpl, ok, err := LoadTemplate(q, businessID, event, channel)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// Nothing to send on this channel for this event
+		return nil
+	}
+
+	n, err := tmpl.Render(data)
+	if err != nil {
+		// A broken custom template shouldn't stop the other notifications
+		log.Printf("notify: template %s/%s for business %d: %v", event, channel, businessID, err)
+		return nil
+	}
+
+	now := time.Now()
+	_, err = q.Exec(
+		`INSERT INTO notification_outbox (business_id, booking_id, event, channel, recipient, subject, body_text, body_html, next_attempt_at, created_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)`,
+		businessID, bookingID, event, channel, recipient, n.Subject, n.Text, n.HTML, now,
+	)
+	return err
+}
+
+// NotifyWaitlistOffer queues the message offering a held slot to a
+// waitlisted customer
+func (o *Outbox) NotifyWaitlistOffer(entryID int) {
+	if err := o.EnqueueWaitlistOffer(o.DB, entryID); err != nil {
+		log.Printf("notify: could not queue %s for waitlist entry %d: %v", EventWaitlistOffer, entryID, err)
+	}
+}
+
+// EnqueueWaitlistOffer renders and queues a waitlist offer using q
+func (o *Outbox) EnqueueWaitlistOffer(q database.Querier, entryID int) error {
+	var data TemplateData
+	var businessID int
+	var timezone, token string
+	var phone sql.NullString
+	var expires time.Time
+	err := q.QueryRow(`
+		SELECT w.business_id, w.token, w.offer_expires_at, s.start_time, s.end_time,
+		       sv.name, bz.name, COALESCE(l.timezone, bz.timezone), w.customer_name, w.customer_email, w.customer_phone
+		FROM waitlist_entries w
+		JOIN appointment_slots s ON w.offered_slot_id = s.id
+		JOIN services sv ON s.service_id = sv.id
+		JOIN businesses bz ON w.business_id = bz.id
+		LEFT JOIN locations l ON s.location_id = l.id
+		WHERE w.id = $1 AND w.status = 'offered'`,
+		entryID,
+	).Scan(&businessID, &token, &expires, &data.Start, &data.End,
+		&data.ServiceName, &data.BusinessName, &timezone, &data.CustomerName, &data.CustomerEmail, &phone)
+	if err != nil {
+		return fmt.Errorf("loading waitlist entry %d: %v", entryID, err)
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+		timezone = "UTC"
+	}
+	data.Start = data.Start.In(loc)
+	data.End = data.End.In(loc)
+	data.Date = data.Start.Format("Monday, 2 January 2006")
+	data.Time = data.Start.Format("15:04")
+	data.Timezone = timezone
+	data.CustomerPhone = phone.String
+	data.OfferURL = o.AppURL + "/waitlist/" + token
+	data.OfferExpires = expires.In(loc).Format("15:04")
+
+	for _, channel := range o.Channels {
+		recipient := data.CustomerEmail
+		if channel == ChannelSMS {
+			recipient = data.CustomerPhone
+		}
+		if recipient == "" {
+			continue
+		}
+		if err := o.enqueueOne(q, businessID, nil, EventWaitlistOffer, channel, recipient, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadBookingData collects everything the templates can show about a booking
+func (o *Outbox) loadBookingData(q database.Querier, bookingID int) (TemplateData, int, error) {
+	var data TemplateData
+	var businessID int
+	var timezone string
+	var notes, phone, manageToken sql.NullString
+	var endsAt sql.NullTime
+	err := q.QueryRow(`
+		SELECT b.id, b.business_id, b.notes, b.manage_token, s.start_time, s.end_time, b.ends_at,
+		       sv.name, bz.name, COALESCE(l.timezone, bz.timezone), b.customer_name, b.customer_email, b.customer_phone
+		FROM bookings b
+		JOIN appointment_slots s ON b.slot_id = s.id
+		JOIN services sv ON s.service_id = sv.id
+		JOIN businesses bz ON b.business_id = bz.id
+		LEFT JOIN locations l ON b.location_id = l.id
+		WHERE b.id = $1`,
+		bookingID,
+	).Scan(&data.BookingID, &businessID, &notes, &manageToken, &data.Start, &data.End, &endsAt,
+		&data.ServiceName, &data.BusinessName, &timezone, &data.CustomerName, &data.CustomerEmail, &phone)
+	if err != nil {
+		return data, 0, fmt.Errorf("loading booking %d: %v", bookingID, err)
+	}
+	if endsAt.Valid {
+		data.End = endsAt.Time
+	}
+
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+		timezone = "UTC"
+	}
+	data.Start = data.Start.In(loc)
+	data.End = data.End.In(loc)
+	data.Date = data.Start.Format("Monday, 2 January 2006")
+	data.Time = data.Start.Format("15:04")
+	data.Timezone = timezone
+	data.Notes = notes.String
+	data.CustomerPhone = phone.String
+	if manageToken.Valid {
+		data.ManageURL = o.AppURL + "/booking/manage/" + manageToken.String
+	}
+
+	return data, businessID, nil
+}
@@ -0,0 +1,68 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WriterSink writes every notification to an io.Writer instead of
+// delivering it. Use ConsoleSink or NewFileSink during development.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// ConsoleSink prints notifications to stdout
+var ConsoleSink = &WriterSink{w: os.Stdout}
+
+// NewFileSink appends notifications to a file
+func NewFileSink(path string) (*WriterSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriterSink{w: f}, nil
+}
+
+// Send writes the notification
+func (s *WriterSink) Send(ctx context.Context, n Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "=== %s %s to %s\n", time.Now().UTC().Format(time.RFC3339), n.Channel, n.To)
+	if n.Subject != "" {
+		fmt.Fprintf(&b, "Subject: %s\n", n.Subject)
+	}
+	for _, a := range n.Attachments {
+		fmt.Fprintf(&b, "Attachment: %s (%s, %d bytes)\n", a.Filename, a.ContentType, len(a.Data))
+	}
+	b.WriteString("\n")
+	b.WriteString(strings.TrimRight(n.Text, "\n"))
+	b.WriteString("\n\n")
+
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+// SendSMS lets a sink stand in for an SMS provider
+func (s *WriterSink) SendSMS(ctx context.Context, to string, body string) error {
+	return s.Send(ctx, Notification{Channel: ChannelSMS, To: to, Text: body})
+}
+
+// NewSink creates a sink from "console" or "file:///path/to/file"
+func NewSink(spec string) (*WriterSink, error) {
+	switch {
+	case spec == "console":
+		return ConsoleSink, nil
+	case strings.HasPrefix(spec, "file://"):
+		return NewFileSink(strings.TrimPrefix(spec, "file://"))
+	default:
+		return nil, fmt.Errorf("unknown sink %q (use console or file:///path)", spec)
+	}
+}
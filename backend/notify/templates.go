@@ -0,0 +1,215 @@
+package notify
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+	"time"
+
+	"booking-backend/database"
+)
+
+// Booking events that produce notifications
+const (
+	EventBookingCreated     = "booking_created"
+	EventBookingRescheduled = "booking_rescheduled"
+	EventBookingCancelled   = "booking_cancelled"
+	EventBookingReminder    = "booking_reminder"
+	EventWaitlistOffer      = "waitlist_offer"
+	// Sent to the business, not the customer
+	EventBusinessNewBooking       = "business_new_booking"
+	EventBusinessBookingCancelled = "business_booking_cancelled"
+)
+
+// Events lists every event that has a template
+var Events = []string{
+	EventBookingCreated,
+	EventBookingRescheduled,
+	EventBookingCancelled,
+	EventBookingReminder,
+	EventWaitlistOffer,
+	EventBusinessNewBooking,
+	EventBusinessBookingCancelled,
+}
+
+// Template is the source of one notification. Subject and Text are
+// text/template; HTML is html/template and may be empty.
+type Template struct {
+	Event   string `json:"event"`
+	Channel string `json:"channel"`
+	Subject string `json:"subject"`
+	Text    string `json:"body_text"`
+	HTML    string `json:"body_html"`
+	Custom  bool   `json:"custom"` // false when the built-in default is used
+}
+
+// TemplateData is available to every template
+type TemplateData struct {
+	BookingID     int
+	BusinessName  string
+	CustomerName  string
+	CustomerEmail string
+	CustomerPhone string
+	ServiceName   string
+	Start         time.Time // in the business timezone
+	End           time.Time
+	Date          string // e.g. "Monday, 2 January 2006"
+	Time          string // e.g. "15:04"
+	Timezone      string
+	Notes         string
+	ManageURL     string
+	// Set for booking_rescheduled
+	PreviousDate string
+	PreviousTime string
+	// Set for waitlist_offer
+	OfferURL     string
+	OfferExpires string // e.g. "15:04"
+}
+
+type templateKey struct{ event, channel string }
+
+var defaultTemplates = map[templateKey]Template{
+	{EventBookingCreated, ChannelEmail}: {
+		Subject: "Your booking at {{.BusinessName}} is confirmed",
+		Text: "Hi {{.CustomerName}},\n\nYour {{.ServiceName}} appointment at {{.BusinessName}} is confirmed for " +
+			"{{.Date}} at {{.Time}} ({{.Timezone}}).\n\nManage your booking: {{.ManageURL}}\n",
+		HTML: "<p>Hi {{.CustomerName}},</p><p>Your <strong>{{.ServiceName}}</strong> appointment at {{.BusinessName}} " +
+			"is confirmed for <strong>{{.Date}} at {{.Time}}</strong> ({{.Timezone}}).</p>" +
+			"<p><a href=\"{{.ManageURL}}\">Manage your booking</a></p>",
+	},
+	{EventBookingCreated, ChannelSMS}: {
+		Text: "{{.BusinessName}}: your {{.ServiceName}} is booked for {{.Date}} {{.Time}}. Manage: {{.ManageURL}}",
+	},
+	{EventBookingRescheduled, ChannelEmail}: {
+		Subject: "Your booking at {{.BusinessName}} has moved",
+		Text: "Hi {{.CustomerName}},\n\nYour {{.ServiceName}} appointment has been moved from {{.PreviousDate}} at " +
+			"{{.PreviousTime}} to {{.Date}} at {{.Time}} ({{.Timezone}}).\n\nManage your booking: {{.ManageURL}}\n",
+		HTML: "<p>Hi {{.CustomerName}},</p><p>Your <strong>{{.ServiceName}}</strong> appointment has been moved from " +
+			"{{.PreviousDate}} at {{.PreviousTime}} to <strong>{{.Date}} at {{.Time}}</strong> ({{.Timezone}}).</p>" +
+			"<p><a href=\"{{.ManageURL}}\">Manage your booking</a></p>",
+	},
+	{EventBookingRescheduled, ChannelSMS}: {
+		Text: "{{.BusinessName}}: your {{.ServiceName}} has moved to {{.Date}} {{.Time}}.",
+	},
+	{EventBookingCancelled, ChannelEmail}: {
+		Subject: "Your booking at {{.BusinessName}} was cancelled",
+		Text: "Hi {{.CustomerName}},\n\nYour {{.ServiceName}} appointment on {{.Date}} at {{.Time}} " +
+			"({{.Timezone}}) has been cancelled.\n",
+		HTML: "<p>Hi {{.CustomerName}},</p><p>Your <strong>{{.ServiceName}}</strong> appointment on " +
+			"{{.Date}} at {{.Time}} ({{.Timezone}}) has been cancelled.</p>",
+	},
+	{EventBookingCancelled, ChannelSMS}: {
+		Text: "{{.BusinessName}}: your {{.ServiceName}} on {{.Date}} {{.Time}} was cancelled.",
+	},
+	{EventBookingReminder, ChannelEmail}: {
+		Subject: "Reminder: {{.ServiceName}} at {{.BusinessName}} on {{.Date}}",
+		Text: "Hi {{.CustomerName}},\n\nThis is a reminder of your {{.ServiceName}} appointment at {{.BusinessName}} " +
+			"on {{.Date}} at {{.Time}} ({{.Timezone}}).\n\nManage your booking: {{.ManageURL}}\n",
+		HTML: "<p>Hi {{.CustomerName}},</p><p>This is a reminder of your <strong>{{.ServiceName}}</strong> appointment " +
+			"at {{.BusinessName}} on <strong>{{.Date}} at {{.Time}}</strong> ({{.Timezone}}).</p>" +
+			"<p><a href=\"{{.ManageURL}}\">Manage your booking</a></p>",
+	},
+	{EventBookingReminder, ChannelSMS}: {
+		Text: "Reminder from {{.BusinessName}}: {{.ServiceName}} on {{.Date}} {{.Time}}.",
+	},
+	{EventWaitlistOffer, ChannelEmail}: {
+		Subject: "A {{.ServiceName}} slot opened up at {{.BusinessName}}",
+		Text: "Hi {{.CustomerName}},\n\nA {{.ServiceName}} slot on {{.Date}} at {{.Time}} ({{.Timezone}}) is now free " +
+			"and we're holding it for you until {{.OfferExpires}}.\n\nBook it: {{.OfferURL}}\n",
+		HTML: "<p>Hi {{.CustomerName}},</p><p>A <strong>{{.ServiceName}}</strong> slot on <strong>{{.Date}} at " +
+			"{{.Time}}</strong> ({{.Timezone}}) is now free and we're holding it for you until {{.OfferExpires}}.</p>" +
+			"<p><a href=\"{{.OfferURL}}\">Book it</a></p>",
+	},
+	{EventWaitlistOffer, ChannelSMS}: {
+		Text: "{{.BusinessName}}: a {{.ServiceName}} slot on {{.Date}} {{.Time}} is free, held for you until {{.OfferExpires}}: {{.OfferURL}}",
+	},
+	{EventBusinessNewBooking, ChannelEmail}: {
+		Subject: "New booking: {{.ServiceName}} on {{.Date}} {{.Time}}",
+		Text: "{{.CustomerName}} ({{.CustomerEmail}}{{if .CustomerPhone}}, {{.CustomerPhone}}{{end}}) booked " +
+			"{{.ServiceName}} on {{.Date}} at {{.Time}} ({{.Timezone}}).{{if .Notes}}\n\nNotes: {{.Notes}}{{end}}\n",
+	},
+	{EventBusinessBookingCancelled, ChannelEmail}: {
+		Subject: "Booking cancelled: {{.ServiceName}} on {{.Date}} {{.Time}}",
+		Text:    "{{.CustomerName}} ({{.CustomerEmail}}) cancelled {{.ServiceName}} on {{.Date}} at {{.Time}} ({{.Timezone}}).\n",
+	},
+}
+
+// DefaultTemplate returns the built-in template for an event and channel
+func DefaultTemplate(event, channel string) (Template, bool) {
+	t, ok := defaultTemplates[templateKey{event, channel}]
+	t.Event, t.Channel = event, channel
+	return t, ok
+}
+
+// LoadTemplate returns the business's own template for an event and
+// channel, falling back to the built-in default
+func LoadTemplate(q database.Querier, businessID int, event, channel string) (Template, bool, error) {
+	t := Template{Event: event, Channel: channel, Custom: true}
+	err := q.QueryRow(
+		"SELECT subject, body_text, body_html FROM notification_templates WHERE business_id = $1 AND event = $2 AND channel = $3",
+		businessID, event, channel,
+	).Scan(&t.Subject, &t.Text, &t.HTML)
+	if err == sql.ErrNoRows {
+		t, ok := DefaultTemplate(event, channel)
+		return t, ok, nil
+	}
+	if err != nil {
+		return Template{}, false, err
+	}
+	return t, true, nil
+}
+
+// Validate checks that all parts of a template parse
+func (t Template) Validate() error {
+	if _, err := template.New("subject").Parse(t.Subject); err != nil {
+		return fmt.Errorf("subject: %v", err)
+	}
+	if _, err := template.New("text").Parse(t.Text); err != nil {
+		return fmt.Errorf("body_text: %v", err)
+	}
+	if _, err := htmltemplate.New("html").Parse(t.HTML); err != nil {
+		return fmt.Errorf("body_html: %v", err)
+	}
+	// Execute against sample data to catch unknown fields
+	_, err := t.Render(TemplateData{})
+	return err
+}
+
+// Render fills in the template
+func (t Template) Render(data TemplateData) (Notification, error) {
+	n := Notification{Channel: t.Channel}
+
+	var err error
+	if n.Subject, err = renderText(t.Subject, data); err != nil {
+		return n, fmt.Errorf("subject: %v", err)
+	}
+	if n.Text, err = renderText(t.Text, data); err != nil {
+		return n, fmt.Errorf("body_text: %v", err)
+	}
+	if t.HTML != "" {
+		tmpl, err := htmltemplate.New("html").Option("missingkey=error").Parse(t.HTML)
+		if err != nil {
+			return n, fmt.Errorf("body_html: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return n, fmt.Errorf("body_html: %v", err)
+		}
+		n.HTML = buf.String()
+	}
+	return n, nil
+}
+
+func renderText(source string, data TemplateData) (string, error) {
+	tmpl, err := template.New("text").Option("missingkey=error").Parse(source)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
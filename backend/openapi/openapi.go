@@ -0,0 +1,410 @@
+// Package openapi describes the API as an OpenAPI 3 document. The
+// operations are listed by hand in Operations; the schemas of their
+// request and response bodies are read from the Go types (json tags for
+// the names, binding tags for what is required).
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/apierror"
+)
+
+// Version of the API the document describes
+const Version = "1.0.0"
+
+// Access says who may call an operation
+type Access int
+
+const (
+	Public        Access = iota
+	User                 // any logged in user of a business
+	Admin                // business admins only
+	BusinessAdmin        // admins of the whole business, not of some locations only
+)
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Type        string // integer, string or boolean
+	Description string
+	Required    bool
+}
+
+// Operation is one route of the API. Path is the gin path under the
+// version prefix, e.g. /bookings/:id/cancel; path parameters are taken
+// from it.
+type Operation struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	Access  Access
+	Scope   string // the API key scope it needs; "" for no API key access
+	Query   []Param
+
+	Body interface{} // request body, a zero value of its type
+	Form bool        // the body may also be sent as multipart/form-data
+
+	Status   int         // on success; default 200
+	Response interface{} // response body, a zero value of its type
+	Produces string      // content type of a response that isn't JSON
+}
+
+// pageOf is a page of a cursor-paginated list (models.Page) of item
+type pageOf struct{ item interface{} }
+
+func page(item interface{}) pageOf { return pageOf{item} }
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Servers    []Server                        `json:"servers"`
+	Paths      map[string]map[string]*PathItem `json:"paths"`
+	Components Components                      `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// PathItem is an operation of a path (OpenAPI's Operation Object)
+type PathItem struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Schema is the subset of JSON Schema the document uses
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// Build assembles the document from Operations
+func Build() *Document {
+	g := &generator{schemas: map[string]*Schema{}}
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:   "Booking API",
+			Version: Version,
+			Description: "Errors are RFC 7807 problem details (application/problem+json) " +
+				"with a stable `code`, see the Problem schema. The same routes are served " +
+				"without the version under /api until the date in their Sunset header. " +
+				"Requests are rate limited per client IP, user and API key; limited requests " +
+				"get a 429 with a Retry-After header.",
+		},
+		Servers: []Server{{URL: "/api/v1"}},
+		Paths:   map[string]map[string]*PathItem{},
+		Components: Components{
+			Schemas: g.schemas,
+			SecuritySchemes: map[string]SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+					Description: "The token from /login or /register"},
+				"apiKey": {Type: "http", Scheme: "bearer",
+					Description: "A business API key (bk_...) from /api-keys, for the operations its scopes allow"},
+			},
+		},
+	}
+	problem := g.schema(reflect.TypeOf(apierror.Problem{}))
+
+	for _, op := range Operations {
+		path, params := pathParams(op.Path)
+		item := &PathItem{
+			Tags:        []string{op.Tag},
+			Summary:     op.Summary,
+			OperationID: operationID(op.Method, op.Path),
+			Parameters:  params,
+			Responses: map[string]Response{
+				"default": {Description: "Error", Content: map[string]MediaType{
+					"application/problem+json": {Schema: problem},
+				}},
+			},
+		}
+		for _, q := range op.Query {
+			item.Parameters = append(item.Parameters, Parameter{
+				Name: q.Name, In: "query", Description: q.Description, Required: q.Required,
+				Schema: &Schema{Type: q.Type},
+			})
+		}
+		switch op.Access {
+		case User:
+			item.Security = []map[string][]string{{"bearerAuth": {}}}
+		case Admin:
+			item.Security = []map[string][]string{{"bearerAuth": {}}}
+			item.Description = "Business admins only."
+		case BusinessAdmin:
+			item.Security = []map[string][]string{{"bearerAuth": {}}}
+			item.Description = "Admins of the whole business only, not those of some locations."
+		}
+		if op.Scope != "" {
+			item.Security = append(item.Security, map[string][]string{"apiKey": {}})
+			item.Description = strings.TrimSpace(item.Description + " API keys need the `" + op.Scope + "` scope.")
+		}
+
+		if op.Body != nil {
+			body := g.schema(reflect.TypeOf(op.Body))
+			item.RequestBody = &RequestBody{
+				Required: len(g.resolve(body).Required) > 0, // bodies without required fields may be left out
+				Content:  map[string]MediaType{"application/json": {Schema: body}},
+			}
+			if op.Form {
+				item.RequestBody.Content["multipart/form-data"] = MediaType{Schema: g.formSchema(reflect.TypeOf(op.Body))}
+			}
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := Response{Description: http.StatusText(status)}
+		switch {
+		case op.Produces != "":
+			response.Content = map[string]MediaType{op.Produces: {Schema: &Schema{Type: "string"}}}
+		case op.Response != nil:
+			response.Content = map[string]MediaType{"application/json": {Schema: g.response(op.Response)}}
+		}
+		item.Responses[strconv.Itoa(status)] = response
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(op.Method)] = item
+	}
+	return doc
+}
+
+// JSON is the document as served at /api/v1/openapi.json
+func JSON() []byte {
+	data, err := json.MarshalIndent(Build(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+// pathParams turns /bookings/:id into /bookings/{id} and its
+// parameters
+func pathParams(ginPath string) (string, []Parameter) {
+	var params []Parameter
+	parts := strings.Split(ginPath, "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, ":") && !strings.HasPrefix(part, "*") {
+			continue
+		}
+		name := part[1:]
+		schema := &Schema{Type: "string"}
+		if name == "id" || strings.HasSuffix(name, "_id") {
+			schema.Type = "integer"
+		}
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: schema})
+		parts[i] = "{" + name + "}"
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// operationID is e.g. post_bookings_id_cancel
+func operationID(method, ginPath string) string {
+	id := strings.ToLower(method) + strings.NewReplacer("/", "_", ":", "", "-", "_", ".", "_").Replace(ginPath)
+	return strings.Trim(id, "_")
+}
+
+type generator struct {
+	schemas map[string]*Schema
+}
+
+func (g *generator) response(v interface{}) *Schema {
+	if p, ok := v.(pageOf); ok {
+		return &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"items":       {Type: "array", Items: g.schema(reflect.TypeOf(p.item))},
+				"total":       {Type: "integer"},
+				"next_cursor": {Type: "string"},
+			},
+			Required: []string{"items", "total"},
+		}
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema describes a Go type. Named structs become components and are
+// referenced.
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = &Schema{} // placeholder for recursive types
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{} // interface{}: any value
+}
+
+// resolve follows a reference to a component
+func (g *generator) resolve(s *Schema) *Schema {
+	if s.Ref == "" {
+		return s
+	}
+	return g.schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if name == "" {
+			continue
+		}
+		prop := g.schema(f.Type)
+		for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+			switch {
+			case rule == "required":
+				s.Required = append(s.Required, name)
+			case rule == "email":
+				prop.Format = "email"
+			case rule == "url":
+				prop.Format = "uri"
+			case strings.HasPrefix(rule, "min="):
+				n, _ := strconv.Atoi(strings.TrimPrefix(rule, "min="))
+				if prop.Type == "string" {
+					prop.MinLength = &n
+				} else {
+					prop.Minimum = &n
+				}
+			case strings.HasPrefix(rule, "oneof="):
+				prop.Enum = strings.Fields(strings.TrimPrefix(rule, "oneof="))
+			}
+		}
+		s.Properties[name] = prop
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+// formSchema describes a multipart body with the form fields of t and a
+// file
+func (g *generator) formSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{
+		"file": {Type: "string", Format: "binary"},
+	}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name := f.Tag.Get("form"); name != "" && name != "-" {
+			s.Properties[name] = g.schema(f.Type)
+		}
+	}
+	return s
+}
+
+func jsonName(f reflect.StructField) string {
+	if f.PkgPath != "" { // unexported
+		return ""
+	}
+	name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
@@ -0,0 +1,304 @@
+package openapi
+
+import (
+	"net/http"
+
+	"booking-backend/auth"
+	"booking-backend/models"
+	"booking-backend/notify"
+)
+
+// Bodies the handlers build with gin.H
+
+// Message is the response of operations that only confirm what they did
+type Message struct {
+	Message string `json:"message"`
+}
+
+// ProfileResponse is the response of GET /profile
+type ProfileResponse struct {
+	Message string      `json:"message"`
+	User    models.User `json:"user"`
+}
+
+// BookingChange is the response of cancelling, rescheduling or marking a
+// booking as a no-show. Outcome is set for cancellations and no-shows.
+type BookingChange struct {
+	Message string                      `json:"message"`
+	Booking models.Booking              `json:"booking"`
+	Outcome *models.CancellationOutcome `json:"outcome,omitempty"`
+}
+
+// GeneratedSlots is the response of POST /slots/generate
+type GeneratedSlots struct {
+	Message string            `json:"message"`
+	Slots   []models.TimeSlot `json:"slots"`
+}
+
+// LocationStaff is the response of PUT /locations/:id/staff
+type LocationStaff struct {
+	LocationID int   `json:"location_id"`
+	StaffIDs   []int `json:"staff_ids"`
+}
+
+// Redelivery is the response of redelivering a webhook
+type Redelivery struct {
+	Message    string `json:"message"`
+	DeliveryID int    `json:"delivery_id"`
+}
+
+// Query parameters shared by several operations
+var (
+	pageParams = []Param{
+		{Name: "limit", Type: "integer", Description: "Page size, 1 to 200 (default 50)"},
+		{Name: "cursor", Type: "string", Description: "next_cursor of the previous page"},
+	}
+	businessParams = []Param{
+		{Name: "business", Type: "string", Description: "Business slug"},
+		{Name: "business_id", Type: "integer", Description: "Business ID, if business isn't given"},
+	}
+	locationParam   = Param{Name: "location_id", Type: "integer", Description: "Only this location"}
+	serviceIDParam  = Param{Name: "service_id", Type: "integer", Description: "Only this service"}
+	timeRangeParams = []Param{
+		{Name: "from", Type: "string", Description: "Start at or after, YYYY-MM-DD or an RFC 3339 time"},
+		{Name: "to", Type: "string", Description: "Start before, YYYY-MM-DD or an RFC 3339 time"},
+	}
+	publicSlotParams = []Param{
+		{Name: "service_id", Type: "integer", Description: "Required unless service_ids is given"},
+		{Name: "service_ids", Type: "string", Description: "Several services back to back, comma separated, in order; needs date"},
+		{Name: "date", Type: "string", Description: "YYYY-MM-DD in the location's timezone"},
+		locationParam,
+	}
+)
+
+func params(groups ...[]Param) []Param {
+	var all []Param
+	for _, g := range groups {
+		all = append(all, g...)
+	}
+	return all
+}
+
+func sortParam(keys string) Param {
+	return Param{Name: "sort", Type: "string", Description: "One of " + keys + "; prefix with - for descending"}
+}
+
+// Operations are all routes of the API
+var Operations = []Operation{
+	// Meta
+	{Method: "GET", Path: "/health", Tag: "meta", Summary: "Check the server and database", Response: Message{}},
+	{Method: "GET", Path: "/openapi.json", Tag: "meta", Summary: "This document", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/docs", Tag: "meta", Summary: "API documentation", Produces: "text/html"},
+
+	// Accounts and sessions
+	{Method: "POST", Path: "/login", Tag: "auth", Summary: "Log in",
+		Body: models.LoginRequest{}, Response: models.LoginResponse{}},
+	{Method: "POST", Path: "/login/2fa", Tag: "auth", Summary: "Finish logging in with a two-factor code",
+		Body: models.MFALoginRequest{}, Response: models.LoginResponse{}},
+	{Method: "POST", Path: "/login/2fa/setup", Tag: "auth", Summary: "Set up required two-factor authentication while logging in",
+		Body: models.MFASetupLoginRequest{}, Response: models.TOTPSetupResponse{}},
+	{Method: "POST", Path: "/register", Tag: "auth", Summary: "Register a business and its admin",
+		Body: models.RegistrationRequest{}, Status: http.StatusCreated, Response: models.RegistrationResponse{}},
+	{Method: "POST", Path: "/token/refresh", Tag: "auth", Summary: "Exchange a refresh token for new tokens",
+		Body: models.RefreshRequest{}, Response: models.TokenResponse{}},
+	{Method: "GET", Path: "/auth/oidc/providers", Tag: "auth", Summary: "List the providers users can sign in with",
+		Response: []models.OIDCProvider{}},
+	{Method: "POST", Path: "/auth/oidc/:provider/start", Tag: "auth", Summary: "Start signing in with a provider",
+		Response: models.OIDCStartResponse{}},
+	{Method: "POST", Path: "/auth/oidc/:provider/callback", Tag: "auth", Summary: "Finish signing in with a provider",
+		Body: models.OIDCCallbackRequest{}, Response: models.LoginResponse{}},
+	{Method: "POST", Path: "/password/forgot", Tag: "auth", Summary: "Email a password reset link",
+		Body: models.ForgotPasswordRequest{}, Response: Message{}},
+	{Method: "POST", Path: "/password/reset", Tag: "auth", Summary: "Set a new password with a reset token",
+		Body: models.ResetPasswordRequest{}, Response: Message{}},
+	{Method: "POST", Path: "/email/verify", Tag: "auth", Summary: "Verify an email address",
+		Body: models.VerifyEmailRequest{}, Response: Message{}},
+	{Method: "GET", Path: "/profile", Tag: "auth", Summary: "The logged in user", Access: User,
+		Response: ProfileResponse{}},
+	{Method: "POST", Path: "/logout", Tag: "auth", Summary: "Log out", Access: User,
+		Body: models.LogoutRequest{}, Response: Message{}},
+	{Method: "PUT", Path: "/password", Tag: "auth", Summary: "Change the password", Access: User,
+		Body: models.ChangePasswordRequest{}, Response: Message{}},
+	{Method: "POST", Path: "/email/verify/resend", Tag: "auth", Summary: "Resend the verification email", Access: User,
+		Response: Message{}},
+	{Method: "POST", Path: "/2fa/setup", Tag: "auth", Summary: "Start turning on two-factor authentication", Access: User,
+		Response: models.TOTPSetupResponse{}},
+	{Method: "POST", Path: "/2fa/enable", Tag: "auth", Summary: "Turn on two-factor authentication", Access: User,
+		Body: models.TwoFactorCodeRequest{}, Response: models.RecoveryCodesResponse{}},
+	{Method: "POST", Path: "/2fa/disable", Tag: "auth", Summary: "Turn off two-factor authentication", Access: User,
+		Body: models.TwoFactorCodeRequest{}, Response: Message{}},
+	{Method: "POST", Path: "/2fa/recovery-codes", Tag: "auth", Summary: "Replace the recovery codes", Access: User,
+		Body: models.TwoFactorCodeRequest{}, Response: models.RecoveryCodesResponse{}},
+
+	// Services
+	{Method: "POST", Path: "/services", Tag: "services", Summary: "Create a service", Access: User, Scope: auth.ScopeWriteServices,
+		Body: models.CreateServiceRequest{}, Status: http.StatusCreated, Response: models.ServiceResponse{}},
+	{Method: "GET", Path: "/services", Tag: "services", Summary: "List services", Access: User, Scope: auth.ScopeReadServices,
+		Query:    params(pageParams, []Param{sortParam("name, duration, price_cents, id"), locationParam}),
+		Response: page(models.ServiceResponse{})},
+	{Method: "DELETE", Path: "/services/:id", Tag: "services", Summary: "Delete a service", Access: User, Scope: auth.ScopeWriteServices,
+		Response: Message{}},
+
+	// Slots
+	{Method: "POST", Path: "/slots/generate", Tag: "slots", Summary: "Generate slots for a service", Access: User, Scope: auth.ScopeWriteSlots,
+		Body: models.GenerateSlotsRequest{}, Status: http.StatusCreated, Response: GeneratedSlots{}},
+	{Method: "GET", Path: "/slots", Tag: "slots", Summary: "List slots", Access: User, Scope: auth.ScopeReadSlots,
+		Query: params(pageParams, []Param{sortParam("start_time, id"), serviceIDParam}, timeRangeParams, []Param{
+			{Name: "available", Type: "boolean", Description: "Only slots that are (or aren't) bookable"},
+			locationParam,
+		}),
+		Response: page(models.TimeSlot{})},
+
+	// Bookings
+	{Method: "GET", Path: "/bookings", Tag: "bookings", Summary: "List bookings", Access: User, Scope: auth.ScopeReadBookings,
+		Query: params(pageParams, []Param{sortParam("start_time, created_at, id"), serviceIDParam}, timeRangeParams, []Param{
+			{Name: "status", Type: "string", Description: "scheduled, completed, cancelled or no-show"},
+			locationParam,
+		}),
+		Response: page(models.Booking{})},
+	{Method: "POST", Path: "/bookings/:id/cancel", Tag: "bookings", Summary: "Cancel a booking", Access: User, Scope: auth.ScopeWriteBookings,
+		Response: BookingChange{}},
+	{Method: "POST", Path: "/bookings/:id/no-show", Tag: "bookings", Summary: "Mark a booking as a no-show", Access: User, Scope: auth.ScopeWriteBookings,
+		Response: BookingChange{}},
+	{Method: "POST", Path: "/bookings/:id/reschedule", Tag: "bookings", Summary: "Move a booking to another slot", Access: User, Scope: auth.ScopeWriteBookings,
+		Body: models.RescheduleBookingRequest{}, Response: BookingChange{}},
+	{Method: "GET", Path: "/bookings/:id/history", Tag: "bookings", Summary: "A booking's changes", Access: User, Scope: auth.ScopeReadBookings,
+		Response: []models.BookingEvent{}},
+	{Method: "GET", Path: "/waitlist", Tag: "waitlist", Summary: "List the waitlist", Access: User, Scope: auth.ScopeReadWaitlist,
+		Query: []Param{
+			{Name: "status", Type: "string", Description: "waiting, offered, booked, expired or left"},
+			locationParam,
+		},
+		Response: []models.WaitlistEntry{}},
+
+	// Calendars
+	{Method: "POST", Path: "/calendar/feeds", Tag: "calendars", Summary: "Create an iCalendar feed", Access: User,
+		Body: models.CreateCalendarFeedRequest{}, Status: http.StatusCreated, Response: models.CalendarFeed{}},
+	{Method: "GET", Path: "/calendar/feeds", Tag: "calendars", Summary: "List calendar feeds", Access: User,
+		Response: []models.CalendarFeed{}},
+	{Method: "DELETE", Path: "/calendar/feeds/:id", Tag: "calendars", Summary: "Delete a calendar feed", Access: User,
+		Response: Message{}},
+	{Method: "POST", Path: "/calendar/imports", Tag: "calendars", Summary: "Import an external calendar (URL or file)", Access: User,
+		Body: models.CreateCalendarImportRequest{}, Form: true, Status: http.StatusCreated, Response: models.CalendarImport{}},
+	{Method: "GET", Path: "/calendar/imports", Tag: "calendars", Summary: "List imported calendars", Access: User,
+		Response: []models.CalendarImport{}},
+	{Method: "POST", Path: "/calendar/imports/:id/sync", Tag: "calendars", Summary: "Sync an imported calendar now", Access: User,
+		Response: models.CalendarImport{}},
+	{Method: "DELETE", Path: "/calendar/imports/:id", Tag: "calendars", Summary: "Delete an imported calendar", Access: User,
+		Response: Message{}},
+	{Method: "GET", Path: "/calendar/:file", Tag: "calendars", Summary: "A calendar feed (<token>.ics)",
+		Produces: "text/calendar"},
+
+	// Staff
+	{Method: "POST", Path: "/staff", Tag: "staff", Summary: "Add a staff member", Access: BusinessAdmin,
+		Body: models.CreateStaffRequest{}, Status: http.StatusCreated, Response: models.User{}},
+	{Method: "GET", Path: "/staff", Tag: "staff", Summary: "List staff", Access: BusinessAdmin,
+		Response: []models.User{}},
+	{Method: "POST", Path: "/staff/:id/deactivate", Tag: "staff", Summary: "Deactivate a staff member", Access: BusinessAdmin,
+		Response: Message{}},
+	{Method: "POST", Path: "/staff/:id/activate", Tag: "staff", Summary: "Reactivate a staff member", Access: BusinessAdmin,
+		Response: Message{}},
+
+	// Locations
+	{Method: "GET", Path: "/locations", Tag: "locations", Summary: "List locations", Access: User, Scope: auth.ScopeReadLocations,
+		Response: []models.Location{}},
+	{Method: "POST", Path: "/locations", Tag: "locations", Summary: "Create a location", Access: Admin,
+		Body: models.LocationRequest{}, Status: http.StatusCreated, Response: models.Location{}},
+	{Method: "PUT", Path: "/locations/:id", Tag: "locations", Summary: "Replace a location", Access: Admin,
+		Body: models.LocationRequest{}, Response: models.Location{}},
+	{Method: "PUT", Path: "/locations/:id/staff", Tag: "locations", Summary: "Set who works at a location", Access: Admin,
+		Body: models.SetLocationStaffRequest{}, Response: LocationStaff{}},
+
+	// Business
+	{Method: "GET", Path: "/business/settings", Tag: "business", Summary: "Business settings", Access: BusinessAdmin,
+		Response: models.BusinessSettings{}},
+	{Method: "PUT", Path: "/business/settings", Tag: "business", Summary: "Update business settings", Access: BusinessAdmin,
+		Body: models.UpdateBusinessSettingsRequest{}, Response: models.BusinessSettings{}},
+	{Method: "GET", Path: "/business/profile", Tag: "business", Summary: "Public profile", Access: Admin,
+		Response: models.BusinessProfile{}},
+	{Method: "PUT", Path: "/business/profile", Tag: "business", Summary: "Update the public profile", Access: Admin,
+		Body: models.UpdateBusinessProfileRequest{}, Response: models.BusinessProfile{}},
+
+	// Notification templates
+	{Method: "GET", Path: "/notification-templates", Tag: "notifications", Summary: "List notification templates", Access: BusinessAdmin,
+		Response: []notify.Template{}},
+	{Method: "PUT", Path: "/notification-templates/:event/:channel", Tag: "notifications", Summary: "Customize a template", Access: BusinessAdmin,
+		Body: models.NotificationTemplateRequest{}, Response: notify.Template{}},
+	{Method: "DELETE", Path: "/notification-templates/:event/:channel", Tag: "notifications", Summary: "Reset a template to the default", Access: BusinessAdmin,
+		Response: Message{}},
+
+	// Webhooks
+	{Method: "POST", Path: "/webhooks", Tag: "webhooks", Summary: "Register a webhook endpoint", Access: BusinessAdmin,
+		Body: models.CreateWebhookRequest{}, Status: http.StatusCreated, Response: models.WebhookEndpoint{}},
+	{Method: "GET", Path: "/webhooks", Tag: "webhooks", Summary: "List webhook endpoints", Access: BusinessAdmin,
+		Response: []models.WebhookEndpoint{}},
+	{Method: "PUT", Path: "/webhooks/:id", Tag: "webhooks", Summary: "Update a webhook endpoint", Access: BusinessAdmin,
+		Body: models.UpdateWebhookRequest{}, Response: models.WebhookEndpoint{}},
+	{Method: "DELETE", Path: "/webhooks/:id", Tag: "webhooks", Summary: "Delete a webhook endpoint", Access: BusinessAdmin,
+		Response: Message{}},
+	{Method: "GET", Path: "/webhooks/:id/deliveries", Tag: "webhooks", Summary: "List an endpoint's deliveries", Access: BusinessAdmin,
+		Query: []Param{
+			{Name: "limit", Type: "integer", Description: "1 to 200 (default 50)"},
+			{Name: "status", Type: "string", Description: "pending, delivered or failed"},
+		},
+		Response: []models.WebhookDelivery{}},
+	{Method: "POST", Path: "/webhooks/:id/deliveries/:delivery_id/redeliver", Tag: "webhooks", Summary: "Send a delivery again", Access: BusinessAdmin,
+		Status: http.StatusAccepted, Response: Redelivery{}},
+
+	// API keys
+	{Method: "POST", Path: "/api-keys", Tag: "api keys", Summary: "Create an API key", Access: BusinessAdmin,
+		Body: models.CreateAPIKeyRequest{}, Status: http.StatusCreated, Response: models.APIKey{}},
+	{Method: "GET", Path: "/api-keys", Tag: "api keys", Summary: "List API keys", Access: BusinessAdmin,
+		Response: []models.APIKey{}},
+	{Method: "DELETE", Path: "/api-keys/:id", Tag: "api keys", Summary: "Revoke an API key", Access: BusinessAdmin,
+		Response: Message{}},
+
+	// Public booking
+	{Method: "GET", Path: "/public/businesses", Tag: "public", Summary: "Search the business directory",
+		Query: []Param{
+			{Name: "q", Type: "string", Description: "Search terms"},
+			{Name: "category", Type: "string"},
+			{Name: "city", Type: "string"},
+			{Name: "date", Type: "string", Description: "Only businesses with an open slot that day, YYYY-MM-DD"},
+			{Name: "tz", Type: "string", Description: "Timezone of date (default UTC)"},
+			{Name: "limit", Type: "integer", Description: "1 to 50 (default 20)"},
+			{Name: "offset", Type: "integer"},
+		},
+		Response: models.BusinessSearchResponse{}},
+	{Method: "GET", Path: "/public/businesses/:slug", Tag: "public", Summary: "A business's public profile",
+		Response: models.BusinessProfile{}},
+	{Method: "GET", Path: "/public/businesses/:slug/services", Tag: "public", Summary: "A business's services",
+		Query: []Param{locationParam}, Response: []models.ServiceResponse{}},
+	{Method: "GET", Path: "/public/businesses/:slug/slots", Tag: "public", Summary: "A business's open slots",
+		Query: publicSlotParams, Response: []models.PublicTimeSlot{}},
+	{Method: "GET", Path: "/public/businesses/:slug/locations", Tag: "public", Summary: "A business's locations",
+		Response: []models.Location{}},
+	{Method: "GET", Path: "/public/services", Tag: "public", Summary: "A business's services",
+		Query: params(businessParams, []Param{locationParam}), Response: []models.ServiceResponse{}},
+	{Method: "GET", Path: "/public/slots", Tag: "public", Summary: "A business's open slots",
+		Query: params(businessParams, publicSlotParams), Response: []models.PublicTimeSlot{}},
+	{Method: "GET", Path: "/public/locations", Tag: "public", Summary: "A business's locations",
+		Query: businessParams, Response: []models.Location{}},
+	{Method: "POST", Path: "/public/slots/:id/hold", Tag: "public", Summary: "Hold a slot while booking",
+		Body: models.HoldSlotRequest{}, Status: http.StatusCreated, Response: models.SlotHold{}},
+	{Method: "DELETE", Path: "/public/slots/:id/hold", Tag: "public", Summary: "Release a held slot",
+		Body: models.ReleaseSlotHoldRequest{}, Response: Message{}},
+	{Method: "POST", Path: "/public/bookings", Tag: "public", Summary: "Book a held slot",
+		Body: models.CreateBookingRequest{}, Status: http.StatusCreated, Response: models.PublicBookingResponse{}},
+	{Method: "GET", Path: "/public/bookings/:token", Tag: "public", Summary: "A booking by its manage token",
+		Response: models.Booking{}},
+	{Method: "POST", Path: "/public/bookings/:token/cancel", Tag: "public", Summary: "Cancel a booking",
+		Response: BookingChange{}},
+	{Method: "POST", Path: "/public/bookings/:token/reschedule", Tag: "public", Summary: "Move a booking to another slot",
+		Body: models.RescheduleBookingRequest{}, Response: BookingChange{}},
+	{Method: "GET", Path: "/public/bookings/:token/calendar.ics", Tag: "public", Summary: "A booking as an .ics file",
+		Produces: "text/calendar"},
+	{Method: "POST", Path: "/public/waitlist", Tag: "public", Summary: "Join the waitlist",
+		Body: models.JoinWaitlistRequest{}, Status: http.StatusCreated, Response: models.JoinWaitlistResponse{}},
+	{Method: "GET", Path: "/public/waitlist/:token", Tag: "public", Summary: "A waitlist entry",
+		Response: models.WaitlistEntry{}},
+	{Method: "POST", Path: "/public/waitlist/:token/accept", Tag: "public", Summary: "Book the slot offered from the waitlist",
+		Status: http.StatusCreated, Response: models.PublicBookingResponse{}},
+	{Method: "DELETE", Path: "/public/waitlist/:token", Tag: "public", Summary: "Leave the waitlist",
+		Response: Message{}},
+}
@@ -0,0 +1,151 @@
+// Package page implements cursor pagination and sorting for list
+// endpoints. A cursor holds the sort key and ID of the last row of a page,
+// so the next page starts right after it even while rows are added or
+// removed.
+package page
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// Kind is the type of a sort column, needed to read it back from a cursor
+type Kind int
+
+const (
+	Time Kind = iota
+	String
+	Int
+)
+
+// Key is a column a list can be sorted by
+type Key struct {
+	Column string
+	Kind   Kind
+}
+
+// Request is a parsed ?limit=&cursor=&sort= query. sort is a key name,
+// descending when prefixed with "-", e.g. sort=-start_time.
+type Request struct {
+	Limit int
+
+	sort     string
+	key      Key
+	desc     bool
+	idColumn string
+	after    *cursor
+}
+
+type cursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"id"`
+}
+
+// Parse reads the paging parameters of a list sorted by one of keys (by
+// defaultSort if none is asked for). Ties are broken by idColumn.
+func Parse(query url.Values, keys map[string]Key, defaultSort, idColumn string) (Request, error) {
+	r := Request{Limit: DefaultLimit, sort: defaultSort, idColumn: idColumn}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > MaxLimit {
+			return r, fmt.Errorf("limit must be between 1 and %d", MaxLimit)
+		}
+		r.Limit = limit
+	}
+
+	if s := query.Get("sort"); s != "" {
+		r.sort = s
+	}
+	name := strings.TrimPrefix(r.sort, "-")
+	key, ok := keys[name]
+	if !ok {
+		names := make([]string, 0, len(keys))
+		for n := range keys {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return r, fmt.Errorf("sort must be one of %s, optionally prefixed with -", strings.Join(names, ", "))
+	}
+	r.key, r.desc = key, strings.HasPrefix(r.sort, "-")
+
+	if s := query.Get("cursor"); s != "" {
+		data, err := base64.RawURLEncoding.DecodeString(s)
+		var after cursor
+		if err != nil || json.Unmarshal(data, &after) != nil {
+			return r, fmt.Errorf("invalid cursor")
+		}
+		if after.Sort != r.sort {
+			return r, fmt.Errorf("cursor is for sort=%s", after.Sort)
+		}
+		r.after = &after
+	}
+	return r, nil
+}
+
+// Where restricts a query to the rows after the cursor, if any, and
+// returns the condition and the extended args
+func (r Request) Where(args []interface{}) (string, []interface{}, error) {
+	if r.after == nil {
+		return "", args, nil
+	}
+	var value interface{}
+	var err error
+	switch r.key.Kind {
+	case Time:
+		var t time.Time
+		err = json.Unmarshal(r.after.Value, &t)
+		value = t
+	case Int:
+		var n int
+		err = json.Unmarshal(r.after.Value, &n)
+		value = n
+	default:
+		var s string
+		err = json.Unmarshal(r.after.Value, &s)
+		value = s
+	}
+	if err != nil {
+		return "", args, fmt.Errorf("invalid cursor")
+	}
+
+	op := ">"
+	if r.desc {
+		op = "<"
+	}
+	args = append(args, value, r.after.ID)
+	v, id := len(args)-1, len(args)
+	return fmt.Sprintf(" AND (%[1]s %[2]s $%[3]d OR (%[1]s = $%[3]d AND %[4]s %[2]s $%[5]d))",
+		r.key.Column, op, v, r.idColumn, id), args, nil
+}
+
+// OrderBy sorts the query and fetches one row more than the page, which
+// tells whether there is a next page
+func (r Request) OrderBy() string {
+	dir := "ASC"
+	if r.desc {
+		dir = "DESC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT %d", r.key.Column, dir, r.idColumn, dir, r.Limit+1)
+}
+
+// Next is the cursor of the page after a row, given the row's values of
+// the sort keys by name (only the one sorted by is used) and its ID
+func (r Request) Next(values map[string]interface{}, id int) string {
+	raw, _ := json.Marshal(values[strings.TrimPrefix(r.sort, "-")])
+	data, _ := json.Marshal(cursor{Sort: r.sort, Value: raw, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
@@ -0,0 +1,137 @@
+package page
+
+import (
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+)
+
+var testKeys = map[string]Key{
+	"name":       {Column: "name", Kind: String},
+	"start_time": {Column: "start_time", Kind: Time},
+	"seats":      {Column: "seats", Kind: Int},
+}
+
+func TestParse(t *testing.T) {
+	valid := Request{}.Next(map[string]interface{}{"name": "b"}, 2)
+	tests := []struct {
+		query     string
+		wantLimit int
+		wantErr   bool
+	}{
+		{"", DefaultLimit, false},
+		{"limit=10&sort=-seats", 10, false},
+		{"limit=0", 0, true},
+		{"limit=201", 0, true},
+		{"limit=x", 0, true},
+		{"sort=price", 0, true},
+		{"sort=-", 0, true},
+		{"cursor=not-base64!", 0, true},
+		{"cursor=" + valid, 0, true}, // made for another sort
+	}
+	for _, tt := range tests {
+		query, _ := url.ParseQuery(tt.query)
+		r, err := Parse(query, testKeys, "start_time", "id")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parse(%q) error = %v, want error: %v", tt.query, err, tt.wantErr)
+			continue
+		}
+		if err == nil && r.Limit != tt.wantLimit {
+			t.Errorf("Parse(%q) limit = %d, want %d", tt.query, r.Limit, tt.wantLimit)
+		}
+	}
+}
+
+// TestPages reads a table page by page in every order, with ties in each
+// sort key, and checks the pages add up to the whole table in order
+func TestPages(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT, start_time TIMESTAMP, seats INTEGER)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nine := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	items := []struct {
+		name  string
+		start time.Time
+		seats int
+	}{
+		{"b", nine, 2},
+		{"a", nine.Add(time.Hour), 1},
+		{"b", nine, 1},
+		{"c", nine.Add(-time.Hour), 2},
+		{"a", nine, 3},
+	}
+	for _, it := range items {
+		if _, err := db.Exec("INSERT INTO items (name, start_time, seats) VALUES ($1, $2, $3)", it.name, it.start, it.seats); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{"name", []int{2, 5, 1, 3, 4}},
+		{"-name", []int{4, 3, 1, 5, 2}},
+		{"start_time", []int{4, 1, 3, 5, 2}},
+		{"-start_time", []int{2, 5, 3, 1, 4}},
+		{"seats", []int{2, 3, 1, 4, 5}},
+		{"-seats", []int{5, 4, 1, 3, 2}},
+	}
+	for _, tt := range tests {
+		var got []int
+		cursor := ""
+		for pages := 0; pages < 10; pages++ {
+			query := url.Values{"limit": {"2"}, "sort": {tt.sort}}
+			if cursor != "" {
+				query.Set("cursor", cursor)
+			}
+			r, err := Parse(query, testKeys, "start_time", "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			where, args, err := r.Where(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, err := db.Query("SELECT id, name, start_time, seats FROM items WHERE 1 = 1"+where+r.OrderBy(), args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			var last map[string]interface{}
+			for rows.Next() {
+				var id, seats int
+				var name string
+				var start time.Time
+				if err := rows.Scan(&id, &name, &start, &seats); err != nil {
+					t.Fatal(err)
+				}
+				if len(ids) < r.Limit {
+					last = map[string]interface{}{"name": name, "start_time": start, "seats": seats}
+				}
+				ids = append(ids, id)
+			}
+			rows.Close()
+
+			if len(ids) <= r.Limit {
+				got = append(got, ids...)
+				break
+			}
+			got = append(got, ids[:r.Limit]...)
+			cursor = r.Next(last, ids[r.Limit-1])
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort=%s: pages give %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
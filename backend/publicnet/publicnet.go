@@ -0,0 +1,85 @@
+// Package publicnet is for requests to URLs that users give us (calendar
+// feeds, webhook endpoints). They may only reach public addresses:
+// otherwise they could make the server request its own network or cloud
+// metadata.
+package publicnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MaxRedirects is how many redirects a request may go through
+const MaxRedirects = 5
+
+// NewClient is an HTTP client that only connects to public addresses
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: Control}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= MaxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to %s URL", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// sharedAddressSpace is 100.64.0.0/10 (RFC 6598), carrier-grade NAT and
+// some clouds' metadata services
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublic reports whether ip is a public unicast address: not loopback,
+// private, link-local (e.g. 169.254.169.254) or otherwise reserved
+func IsPublic(ip net.IP) bool {
+	return ip != nil && ip.IsGlobalUnicast() && !ip.IsPrivate() && !sharedAddressSpace.Contains(ip)
+}
+
+// Control is a net.Dialer Control function that refuses connections to
+// addresses that aren't public. It runs on the resolved address, so host
+// names and redirects pointing there are refused too.
+func Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(net.ParseIP(host)) {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
+
+// ValidURL accepts absolute http(s) URLs whose host could be public. Host
+// names are only resolved when connecting, but addresses that aren't
+// public, localhost and single-label names (which only resolve inside a
+// network) are refused up front.
+func ValidURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return IsPublic(ip)
+	}
+	return strings.Contains(host, ".") && host != "localhost" && !strings.HasSuffix(host, ".localhost")
+}
@@ -0,0 +1,55 @@
+package publicnet
+
+import "testing"
+
+func TestControl(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1::1]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"10.0.0.5:8080", false},
+		{"172.16.0.1:80", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false}, // cloud metadata
+		{"100.100.100.200:80", false}, // shared address space
+		{"0.0.0.0:80", false},
+		{"[fd00::1]:80", false},
+		{"[fe80::1]:80", false},
+	}
+	for _, tt := range tests {
+		if err := Control("tcp", tt.address, nil); (err == nil) != tt.public {
+			t.Errorf("Control(%s) = %v, want public %v", tt.address, err, tt.public)
+		}
+	}
+}
+
+func TestValidURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://example.com/hooks", true},
+		{"http://hooks.example.com:8080/in", true},
+		{"https://93.184.216.34/hooks", true},
+		{"ftp://example.com/hooks", false},
+		{"/hooks", false},
+		{"http://127.0.0.1:9000/", false},
+		{"http://[::1]/", false},
+		{"http://169.254.169.254/latest/meta-data/", false},
+		{"http://10.1.2.3/", false},
+		{"http://localhost:8080/", false},
+		{"http://LocalHost./", false},
+		{"http://api.localhost/", false},
+		{"http://redis:6379/", false},
+	}
+	for _, tt := range tests {
+		if got := ValidURL(tt.url); got != tt.valid {
+			t.Errorf("ValidURL(%q) = %v, want %v", tt.url, got, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package ratelimit limits how often clients may do something, with token
+// buckets: each key (a client IP, a user, an API key) has a bucket of up
+// to Burst tokens that refills at Rate, and every request takes a token.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"booking-backend/database"
+)
+
+// Limit is the size and refill rate of a bucket
+type Limit struct {
+	Rate  float64 // tokens per second
+	Burst int     // bucket size
+}
+
+// PerMinute is a limit of n requests a minute with bursts of up to burst
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Result is the outcome of taking a token
+type Result struct {
+	Allowed    bool
+	Remaining  int           // tokens left
+	RetryAfter time.Duration // when not allowed, until the next token
+}
+
+// Store keeps the buckets. Memory serves one instance; a shared store
+// such as DB makes several instances enforce one limit. Other backends
+// (e.g. Redis) only need to implement Take.
+type Store interface {
+	// Take takes a token from the bucket of key
+	Take(ctx context.Context, key string, limit Limit, now time.Time) (Result, error)
+}
+
+// New creates a Store from a name: memory (the default) or database (the
+// app's database, shared by all instances)
+func New(name string, db *database.Store) (Store, error) {
+	switch name {
+	case "", "memory":
+		return NewMemory(), nil
+	case "database":
+		return &DB{DB: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q (use memory or database)", name)
+	}
+}
+
+// refill is the bucket's tokens at now, taking one if there is one
+func refill(tokens float64, updated time.Time, limit Limit, now time.Time) (float64, Result) {
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(float64(limit.Burst), tokens+elapsed*limit.Rate)
+	}
+	if tokens >= 1 {
+		tokens--
+		return tokens, Result{Allowed: true, Remaining: int(tokens)}
+	}
+	wait := time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	return tokens, Result{RetryAfter: wait}
+}
+
+// Memory keeps buckets in this process
+type Memory struct {
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	lastSweep  time.Time
+	sweepEvery time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket is full again and can be forgotten
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, sweepEvery: time.Minute}
+}
+
+// Take implements Store
+func (m *Memory) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Full buckets are the same as no bucket, so they are dropped now and
+	// then to keep memory bounded
+	if now.Sub(m.lastSweep) > m.sweepEvery {
+		for k, b := range m.buckets {
+			if now.After(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		m.buckets[key] = b
+	}
+	var result Result
+	b.tokens, result = refill(b.tokens, b.updated, limit, now)
+	b.updated = now
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / limit.Rate * float64(time.Second)))
+	return result, nil
+}
+
+// DB keeps buckets in the rate_limits table, so all instances using the
+// database share them
+type DB struct {
+	DB *database.Store
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// Take implements Store
+func (s *DB) Take(_ context.Context, key string, limit Limit, now time.Time) (Result, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO rate_limits (bucket, tokens, updated_at) VALUES ($1, $2, $3)
+		 ON CONFLICT (bucket) DO NOTHING`,
+		key, float64(limit.Burst), now,
+	)
+	if err != nil {
+		return Result{}, err
+	}
+	var tokens float64
+	var updated time.Time
+	err = tx.QueryRow("SELECT tokens, updated_at FROM rate_limits WHERE bucket = $1 FOR UPDATE", key).Scan(&tokens, &updated)
+	if err != nil {
+		return Result{}, err
+	}
+
+	tokens, result := refill(tokens, updated, limit, now)
+	if _, err := tx.Exec("UPDATE rate_limits SET tokens = $1, updated_at = $2 WHERE bucket = $3", tokens, now, key); err != nil {
+		return Result{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Result{}, err
+	}
+	if err := s.sweep(now); err != nil {
+		log.Printf("rate limits: sweep: %v", err)
+	}
+	return result, nil
+}
+
+// sweep deletes buckets untouched for a day, which are full again, once an
+// hour per instance
+func (s *DB) sweep(now time.Time) error {
+	s.mu.Lock()
+	due := now.Sub(s.lastSweep) > time.Hour
+	if due {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+	_, err := s.DB.Exec("DELETE FROM rate_limits WHERE updated_at < $1", now.Add(-24*time.Hour))
+	return err
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryBucket(t *testing.T) {
+	store := NewMemory()
+	limit := PerMinute(60, 3) // a token a second
+	now := time.Date(2026, time.October, 18, 12, 0, 0, 0, time.UTC)
+	take := func(key string) Result {
+		t.Helper()
+		result, err := store.Take(context.Background(), key, limit, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	// A burst empties the bucket
+	for i := 0; i < 3; i++ {
+		if result := take("a"); !result.Allowed || result.Remaining != 2-i {
+			t.Fatalf("take %d = %+v, want allowed with %d left", i, result, 2-i)
+		}
+	}
+	result := take("a")
+	if result.Allowed || result.RetryAfter != time.Second {
+		t.Fatalf("take from empty bucket = %+v, want retry after 1s", result)
+	}
+
+	// Other keys have their own bucket
+	if !take("b").Allowed {
+		t.Error("bucket b is limited by bucket a")
+	}
+
+	// It refills at the rate, up to the burst
+	now = now.Add(1500 * time.Millisecond)
+	if !take("a").Allowed {
+		t.Error("no token after a second")
+	}
+	if result := take("a"); result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("second take = %+v, want retry after 0.5s", result)
+	}
+	now = now.Add(time.Hour)
+	if result := take("a"); result.Remaining != 2 {
+		t.Errorf("after an hour %d tokens left, want 2", result.Remaining)
+	}
+}
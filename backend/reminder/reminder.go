@@ -0,0 +1,246 @@
+// Package reminder sends booking reminders at configurable offsets before
+// each booking's start time.
+package reminder
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/notify"
+)
+
+// MaxOffset is the longest a reminder can be sent before a booking
+const MaxOffset = 7 * 24 * time.Hour
+
+const leaseName = "reminders"
+
+// Scheduler periodically queues due reminders. Only the replica holding the
+// "reminders" lease does the work; the booking_reminders primary key makes
+// each reminder exactly-once even if two schedulers overlap.
+type Scheduler struct {
+	DB       *database.Store
+	Outbox   *notify.Outbox
+	Interval time.Duration
+	Holder   string // lease holder ID of this process
+}
+
+// NewScheduler creates a Scheduler that checks for due reminders every minute
+func NewScheduler(db *database.Store, outbox *notify.Outbox) *Scheduler {
+	return &Scheduler{
+		DB:       db,
+		Outbox:   outbox,
+		Interval: time.Minute,
+		Holder:   database.NewHolderID(),
+	}
+}
+
+// Run queues reminders until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	defer database.ReleaseLease(s.DB, leaseName, s.Holder)
+
+	for {
+		if err := s.tick(); err != nil {
+			log.Printf("reminder: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick() error {
+	// Hold the lease for a few intervals so a short stall doesn't hand it over
+	ok, err := database.AcquireLease(s.DB, leaseName, s.Holder, 3*s.Interval)
+	if err != nil || !ok {
+		return err
+	}
+	_, err = s.QueueDue(time.Now())
+	return err
+}
+
+type candidate struct {
+	bookingID int
+	createdAt time.Time
+	startTime time.Time
+	offsets   []int
+}
+
+// QueueDue queues every reminder that is due at now and returns how many
+// were queued
+func (s *Scheduler) QueueDue(now time.Time) (int, error) {
+	rows, err := s.DB.Query(`
+		SELECT b.id, b.created_at, b.rescheduled_at, s.start_time, bz.reminder_offsets
+		FROM bookings b
+		JOIN appointment_slots s ON b.slot_id = s.id
+		JOIN businesses bz ON b.business_id = bz.id
+		WHERE b.status = 'scheduled'
+		AND s.start_time > $1 AND s.start_time <= $2
+		ORDER BY s.start_time`,
+		now, now.Add(MaxOffset),
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	var candidates []candidate
+	for rows.Next() {
+		var cand candidate
+		var offsets string
+		var rescheduledAt sql.NullTime
+		if err := rows.Scan(&cand.bookingID, &cand.createdAt, &rescheduledAt, &cand.startTime, &offsets); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if rescheduledAt.Valid {
+			// Reminders the new time would have had before the move don't count
+			cand.createdAt = rescheduledAt.Time
+		}
+		cand.offsets, _ = ParseOffsets(offsets)
+		candidates = append(candidates, cand)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, cand := range candidates {
+		sendOffset, skipOffsets := dueOffsets(cand, now)
+		if sendOffset == 0 {
+			continue
+		}
+		sent, err := s.queueReminder(cand.bookingID, sendOffset, skipOffsets)
+		if err != nil {
+			return queued, fmt.Errorf("booking %d: %v", cand.bookingID, err)
+		}
+		if sent {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// dueOffsets works out which reminder to send for a booking. Only the
+// latest due reminder is sent; older ones that were missed (for example
+// because the booking was made 3 hours before a 24 hour reminder) are
+// recorded as skipped so the customer doesn't get several at once.
+func dueOffsets(cand candidate, now time.Time) (send int, skip []int) {
+	for _, offset := range cand.offsets { // sorted largest first
+		remindAt := cand.startTime.Add(-time.Duration(offset) * time.Minute)
+		if remindAt.After(now) {
+			continue
+		}
+		if remindAt.Before(cand.createdAt) {
+			// The booking didn't exist yet at reminder time
+			skip = append(skip, offset)
+			continue
+		}
+		if send != 0 {
+			skip = append(skip, send)
+		}
+		send = offset
+	}
+	return send, skip
+}
+
+// queueReminder records the reminder and queues its notification in one
+// transaction. It returns false if another scheduler already sent it.
+func (s *Scheduler) queueReminder(bookingID, offset int, skipOffsets []int) (bool, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	for _, skipped := range skipOffsets {
+		_, err := tx.Exec(
+			`INSERT INTO booking_reminders (booking_id, offset_minutes, skipped, created_at) VALUES ($1, $2, true, $3)
+			 ON CONFLICT (booking_id, offset_minutes) DO NOTHING`,
+			bookingID, skipped, time.Now(),
+		)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	result, err := tx.Exec(
+		`INSERT INTO booking_reminders (booking_id, offset_minutes, skipped, created_at) VALUES ($1, $2, false, $3)
+		 ON CONFLICT (booking_id, offset_minutes) DO NOTHING`,
+		bookingID, offset, time.Now(),
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return false, tx.Commit()
+	}
+
+	if err := s.Outbox.Enqueue(tx, notify.EventBookingReminder, bookingID, nil); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// ParseOffsets parses a comma separated list of minutes ("1440,120") and
+// returns it sorted largest first
+func ParseOffsets(value string) ([]int, error) {
+	var offsets []int
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		minutes, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reminder offset %q", part)
+		}
+		offsets = append(offsets, minutes)
+	}
+	if err := ValidateOffsets(offsets); err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	return offsets, nil
+}
+
+// FormatOffsets is the inverse of ParseOffsets
+func FormatOffsets(offsets []int) string {
+	sorted := append([]int(nil), offsets...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	parts := make([]string, len(sorted))
+	for i, minutes := range sorted {
+		parts[i] = strconv.Itoa(minutes)
+	}
+	return strings.Join(parts, ",")
+}
+
+// ValidateOffsets checks that offsets are positive, unique and within MaxOffset
+func ValidateOffsets(offsets []int) error {
+	if len(offsets) > 5 {
+		return fmt.Errorf("at most 5 reminder offsets are allowed")
+	}
+	seen := map[int]bool{}
+	for _, minutes := range offsets {
+		if minutes <= 0 || time.Duration(minutes)*time.Minute > MaxOffset {
+			return fmt.Errorf("reminder offsets must be between 1 and %d minutes", int(MaxOffset.Minutes()))
+		}
+		if seen[minutes] {
+			return fmt.Errorf("duplicate reminder offset %d", minutes)
+		}
+		seen[minutes] = true
+	}
+	return nil
+}
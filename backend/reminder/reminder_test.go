@@ -0,0 +1,88 @@
+package reminder
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/notify"
+)
+
+func TestDueOffsets(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)
+	offsets := []int{1440, 120}
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		now       time.Time
+		wantSend  int
+		wantSkip  []int
+	}{
+		{"nothing due yet", start.Add(-72 * time.Hour), start.Add(-25 * time.Hour), 0, nil},
+		{"day before", start.Add(-72 * time.Hour), start.Add(-24 * time.Hour), 1440, nil},
+		{"both due: only the latest", start.Add(-72 * time.Hour), start.Add(-time.Hour), 120, []int{1440}},
+		{"booked after the day before", start.Add(-3 * time.Hour), start.Add(-2 * time.Hour), 120, []int{1440}},
+		{"booked after both", start.Add(-time.Hour), start.Add(-time.Minute), 0, []int{1440, 120}},
+	}
+	for _, tt := range tests {
+		send, skip := dueOffsets(candidate{createdAt: tt.createdAt, startTime: start, offsets: offsets}, tt.now)
+		if send != tt.wantSend || !reflect.DeepEqual(skip, tt.wantSkip) {
+			t.Errorf("%s: send %d, skip %v; want %d, %v", tt.name, send, skip, tt.wantSend, tt.wantSkip)
+		}
+	}
+}
+
+// Each reminder is queued once, however often QueueDue runs
+func TestQueueDueOnce(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)
+	exec("INSERT INTO businesses (name) VALUES ('Acme')")
+	exec("INSERT INTO services (name, duration, business_id) VALUES ('Haircut', 30, 1)")
+	exec("INSERT INTO appointment_slots (start_time, end_time, service_id, business_id) VALUES ($1, $2, 1, 1)",
+		start, start.Add(30*time.Minute))
+	exec("INSERT INTO bookings (customer_name, customer_email, slot_id, business_id, created_at) VALUES ('Ann', 'ann@example.com', 1, 1, $1)",
+		start.Add(-72*time.Hour))
+
+	s := &Scheduler{DB: db, Outbox: &notify.Outbox{DB: db, Channels: []string{notify.ChannelEmail}}}
+	for _, tt := range []struct {
+		now  time.Time
+		want int
+	}{
+		{start.Add(-24 * time.Hour), 1},
+		{start.Add(-23 * time.Hour), 0},
+		{start.Add(-2 * time.Hour), 1},
+		{start.Add(-time.Hour), 0},
+	} {
+		queued, err := s.QueueDue(tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if queued != tt.want {
+			t.Errorf("QueueDue(%v) queued %d, want %d", tt.now, queued, tt.want)
+		}
+	}
+
+	var notifications int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notification_outbox WHERE event = $1", notify.EventBookingReminder).Scan(&notifications); err != nil {
+		t.Fatal(err)
+	}
+	if notifications != 2 {
+		t.Errorf("%d notifications queued, want 2", notifications)
+	}
+}
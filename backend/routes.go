@@ -0,0 +1,312 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"booking-backend/apierror"
+	"booking-backend/auth"
+	"booking-backend/calsync"
+	"booking-backend/database"
+	"booking-backend/handlers"
+	"booking-backend/middleware"
+	"booking-backend/notify"
+	"booking-backend/oidc"
+	"booking-backend/openapi"
+	"booking-backend/ratelimit"
+	"booking-backend/waitlist"
+	"booking-backend/webhook"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// The unversioned /api routes are v1 under its old paths. They answer with
+// Deprecation and Sunset headers and go away at the sunset.
+var (
+	legacyDeprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset     = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// Rate limits (token buckets, see package ratelimit). Every client IP has
+// an allowance for all requests and a smaller one for the public routes;
+// the routes that check credentials or send email share a much smaller
+// one. Logged in users and API keys are limited by account instead of IP.
+var (
+	ipLimit         = ratelimit.PerMinute(600, 200)
+	publicLimit     = ratelimit.PerMinute(120, 60)
+	credentialLimit = ratelimit.PerMinute(10, 10)
+	userLimit       = ratelimit.PerMinute(300, 100)
+	apiKeyLimit     = ratelimit.PerMinute(600, 200)
+)
+
+// credentialRoutes are the routes credentialLimit applies to (v1 paths)
+var credentialRoutes = map[string]bool{
+	"POST /login":                        true,
+	"POST /login/2fa":                    true,
+	"POST /login/2fa/setup":              true,
+	"POST /register":                     true,
+	"POST /auth/oidc/:provider/callback": true,
+	"POST /password/forgot":              true,
+	"POST /password/reset":               true,
+	"POST /email/verify":                 true,
+}
+
+// routerDeps are the services the handlers use besides the database
+type routerDeps struct {
+	accountOpts handlers.AccountOptions
+	outbox      *notify.Outbox
+	hooks       *webhook.Publisher
+	waitlist    *waitlist.Waitlist
+	syncer      *calsync.Syncer
+	oidc        oidc.Providers
+	limits      ratelimit.Store // in memory if nil
+	// trustedProxies may set X-Forwarded-For, which decides the client IP
+	// requests are rate limited by
+	trustedProxies []string
+}
+
+// route is one route of an API version; path is relative to the version
+// prefix. scope is the API key scope the route needs; routes without one
+// can't be called with an API key.
+type route struct {
+	method  string
+	path    string
+	access  openapi.Access
+	scope   string
+	handler gin.HandlerFunc
+}
+
+// apiVersion is a version of the API, served under /api/<name>
+type apiVersion struct {
+	name   string
+	routes []route
+}
+
+// newRouter registers all routes of the API. Every route must also be
+// described in openapi.Operations (see routes_test.go).
+func newRouter(db *database.Store, deps routerDeps) *gin.Engine {
+	router := gin.New()
+	router.Use(gin.Logger(), middleware.Recovery(), middleware.Errors())
+	router.HandleMethodNotAllowed = true
+	if err := router.SetTrustedProxies(deps.trustedProxies); err != nil {
+		panic(err) // checked by main
+	}
+	router.NoRoute(middleware.NoRoute)
+	router.NoMethod(middleware.NoMethod)
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		apierror.JSONFieldNames(v)
+	}
+
+	// === ADD CORS MIDDLEWARE RIGHT HERE ===
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:3000"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "Accept"},
+		ExposeHeaders:    []string{"Content-Length", "Deprecation", "Sunset", "Link", "Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+	limits := deps.limits
+	if limits == nil {
+		limits = ratelimit.NewMemory()
+	}
+	router.Use(middleware.RateLimit(limits, ipLimit, middleware.ByIP("all")))
+
+	// A version with breaking changes starts from the routes of the one
+	// before and replaces the handlers whose requests or responses change,
+	// e.g. {"v2", override(v1, route{"GET", "/bookings", openapi.User, auth.ScopeReadBookings, handlers.GetBookingsV2(db)})}.
+	// Both are then served side by side.
+	v1 := v1Routes(db, deps)
+	versions := []apiVersion{
+		{"v1", v1},
+	}
+	for _, version := range versions {
+		register(router.Group("/api/"+version.name), db, limits, version.routes)
+	}
+	register(router.Group("/api", middleware.Deprecated(legacyDeprecated, legacySunset, "/api", "/api/v1")), db, limits, v1)
+
+	return router
+}
+
+// register adds routes to a version's group behind the authentication
+// and rate limits they need. Versions share the buckets.
+func register(group *gin.RouterGroup, db *database.Store, limits ratelimit.Store, routes []route) {
+	authenticate := middleware.AuthMiddleware(db)
+	adminOnly := middleware.RequireRole("business_admin", "super_admin")
+	wholeBusiness := middleware.RequireWholeBusiness(db)
+	perAccount := []gin.HandlerFunc{
+		authenticate,
+		middleware.RateLimit(limits, userLimit, middleware.ByUser("api")),
+		middleware.RateLimit(limits, apiKeyLimit, middleware.ByAPIKey("api")),
+	}
+	perIP := middleware.RateLimit(limits, publicLimit, middleware.ByIP("public"))
+	credentials := middleware.RateLimit(limits, credentialLimit, middleware.ByIP("credentials"))
+	for _, r := range routes {
+		switch r.access {
+		case openapi.User:
+			group.Handle(r.method, r.path, append(perAccount, middleware.RequireScope(r.scope), r.handler)...)
+		case openapi.Admin:
+			group.Handle(r.method, r.path, append(perAccount, middleware.RequireScope(r.scope), adminOnly, r.handler)...)
+		case openapi.BusinessAdmin:
+			group.Handle(r.method, r.path, append(perAccount, middleware.RequireScope(r.scope), adminOnly, wholeBusiness, r.handler)...)
+		default:
+			if credentialRoutes[r.method+" "+r.path] {
+				group.Handle(r.method, r.path, perIP, credentials, r.handler)
+			} else {
+				group.Handle(r.method, r.path, perIP, r.handler)
+			}
+		}
+	}
+}
+
+// override is routes with changes replacing the routes of the same method
+// and path; changes to routes that don't exist yet are added
+func override(routes []route, changes ...route) []route {
+	result := append([]route(nil), routes...)
+next:
+	for _, change := range changes {
+		for i, r := range result {
+			if r.method == change.method && r.path == change.path {
+				result[i] = change
+				continue next
+			}
+		}
+		result = append(result, change)
+	}
+	return result
+}
+
+// v1Routes are the routes of version 1
+func v1Routes(db *database.Store, deps routerDeps) []route {
+	return []route{
+		// The API description, browsable at /docs
+		{"GET", "/openapi.json", openapi.Public, "", handlers.GetOpenAPISpec()},
+		{"GET", "/docs", openapi.Public, "", handlers.GetAPIDocs},
+		{"GET", "/health", openapi.Public, "", health(db)},
+
+		// Accounts and sessions
+		{"POST", "/login", openapi.Public, "", handlers.Login(db, deps.accountOpts)},
+		{"POST", "/login/2fa", openapi.Public, "", handlers.LoginMFA(db)},
+		{"POST", "/login/2fa/setup", openapi.Public, "", handlers.SetupLoginMFA(db)},
+		{"POST", "/register", openapi.Public, "", handlers.Register(db, deps.accountOpts)},
+		{"POST", "/token/refresh", openapi.Public, "", handlers.RefreshToken(db)},
+		{"GET", "/auth/oidc/providers", openapi.Public, "", handlers.GetOIDCProviders(deps.oidc)},
+		{"POST", "/auth/oidc/:provider/start", openapi.Public, "", handlers.StartOIDCLogin(db, deps.oidc)},
+		{"POST", "/auth/oidc/:provider/callback", openapi.Public, "", handlers.OIDCCallback(db, deps.accountOpts, deps.oidc)},
+		{"POST", "/password/forgot", openapi.Public, "", handlers.ForgotPassword(db, deps.accountOpts)},
+		{"POST", "/password/reset", openapi.Public, "", handlers.ResetPassword(db)},
+		{"POST", "/email/verify", openapi.Public, "", handlers.VerifyEmail(db)},
+
+		// The logged in user's own routes
+		{"GET", "/profile", openapi.User, "", handlers.ProtectedProfile},
+		{"POST", "/logout", openapi.User, "", handlers.Logout(db)},
+		{"PUT", "/password", openapi.User, "", handlers.ChangePassword(db)},
+		{"POST", "/email/verify/resend", openapi.User, "", handlers.ResendVerification(db, deps.accountOpts)},
+		{"POST", "/2fa/setup", openapi.User, "", handlers.SetupTwoFactor(db)},
+		{"POST", "/2fa/enable", openapi.User, "", handlers.EnableTwoFactor(db)},
+		{"POST", "/2fa/disable", openapi.User, "", handlers.DisableTwoFactor(db)},
+		{"POST", "/2fa/recovery-codes", openapi.User, "", handlers.RegenerateRecoveryCodes(db)},
+
+		// Services, slots and bookings
+		{"POST", "/services", openapi.User, auth.ScopeWriteServices, handlers.CreateService(db)},
+		{"GET", "/services", openapi.User, auth.ScopeReadServices, handlers.GetServices(db)},
+		{"DELETE", "/services/:id", openapi.User, auth.ScopeWriteServices, handlers.DeleteService(db, deps.hooks)},
+		{"POST", "/slots/generate", openapi.User, auth.ScopeWriteSlots, handlers.GenerateSlots(db, deps.hooks)},
+		{"GET", "/slots", openapi.User, auth.ScopeReadSlots, handlers.GetBusinessSlots(db)},
+		{"GET", "/bookings", openapi.User, auth.ScopeReadBookings, handlers.GetBookings(db)},
+		{"POST", "/bookings/:id/cancel", openapi.User, auth.ScopeWriteBookings, handlers.CancelBooking(db, deps.outbox, deps.hooks, deps.waitlist)},
+		{"POST", "/bookings/:id/no-show", openapi.User, auth.ScopeWriteBookings, handlers.MarkNoShow(db, deps.hooks)},
+		{"POST", "/bookings/:id/reschedule", openapi.User, auth.ScopeWriteBookings, handlers.RescheduleBooking(db, deps.outbox, deps.hooks, deps.waitlist)},
+		{"GET", "/bookings/:id/history", openapi.User, auth.ScopeReadBookings, handlers.GetBookingHistory(db)},
+		{"GET", "/waitlist", openapi.User, auth.ScopeReadWaitlist, handlers.GetWaitlist(db)},
+
+		// Calendar feeds and imports
+		{"POST", "/calendar/feeds", openapi.User, "", handlers.CreateCalendarFeed(db)},
+		{"GET", "/calendar/feeds", openapi.User, "", handlers.GetCalendarFeeds(db)},
+		{"DELETE", "/calendar/feeds/:id", openapi.User, "", handlers.DeleteCalendarFeed(db)},
+		{"POST", "/calendar/imports", openapi.User, "", handlers.CreateCalendarImport(db, deps.syncer)},
+		{"GET", "/calendar/imports", openapi.User, "", handlers.GetCalendarImports(db)},
+		{"POST", "/calendar/imports/:id/sync", openapi.User, "", handlers.SyncCalendarImport(db, deps.syncer)},
+		{"DELETE", "/calendar/imports/:id", openapi.User, "", handlers.DeleteCalendarImport(db)},
+
+		// Staff management (admins of the whole business only)
+		{"POST", "/staff", openapi.BusinessAdmin, "", handlers.CreateStaff(db)},
+		{"GET", "/staff", openapi.BusinessAdmin, "", handlers.GetStaff(db)},
+		{"POST", "/staff/:id/deactivate", openapi.BusinessAdmin, "", handlers.SetStaffActive(db, false)},
+		{"POST", "/staff/:id/activate", openapi.BusinessAdmin, "", handlers.SetStaffActive(db, true)},
+
+		// Locations; admins assigned to locations only manage those
+		{"GET", "/locations", openapi.User, auth.ScopeReadLocations, handlers.GetLocations(db)},
+		{"POST", "/locations", openapi.Admin, "", handlers.CreateLocation(db)},
+		{"PUT", "/locations/:id", openapi.Admin, "", handlers.UpdateLocation(db)},
+		{"PUT", "/locations/:id/staff", openapi.Admin, "", handlers.SetLocationStaff(db)},
+
+		// Business settings (timezone, reminder offsets)
+		{"GET", "/business/settings", openapi.BusinessAdmin, "", handlers.GetBusinessSettings(db)},
+		{"PUT", "/business/settings", openapi.BusinessAdmin, "", handlers.UpdateBusinessSettings(db)},
+		{"GET", "/business/profile", openapi.Admin, "", handlers.GetBusinessProfile(db)},
+		{"PUT", "/business/profile", openapi.Admin, "", handlers.UpdateBusinessProfile(db)},
+
+		// Notification templates
+		{"GET", "/notification-templates", openapi.BusinessAdmin, "", handlers.GetNotificationTemplates(db)},
+		{"PUT", "/notification-templates/:event/:channel", openapi.BusinessAdmin, "", handlers.UpdateNotificationTemplate(db)},
+		{"DELETE", "/notification-templates/:event/:channel", openapi.BusinessAdmin, "", handlers.DeleteNotificationTemplate(db)},
+
+		// Outbound webhooks
+		{"POST", "/webhooks", openapi.BusinessAdmin, "", handlers.CreateWebhook(db)},
+		{"GET", "/webhooks", openapi.BusinessAdmin, "", handlers.GetWebhooks(db)},
+		{"PUT", "/webhooks/:id", openapi.BusinessAdmin, "", handlers.UpdateWebhook(db)},
+		{"DELETE", "/webhooks/:id", openapi.BusinessAdmin, "", handlers.DeleteWebhook(db)},
+		{"GET", "/webhooks/:id/deliveries", openapi.BusinessAdmin, "", handlers.GetWebhookDeliveries(db)},
+		{"POST", "/webhooks/:id/deliveries/:delivery_id/redeliver", openapi.BusinessAdmin, "", handlers.RedeliverWebhook(db)},
+
+		// API keys for partners' integrations
+		{"POST", "/api-keys", openapi.BusinessAdmin, "", handlers.CreateAPIKey(db)},
+		{"GET", "/api-keys", openapi.BusinessAdmin, "", handlers.GetAPIKeys(db)},
+		{"DELETE", "/api-keys/:id", openapi.BusinessAdmin, "", handlers.RevokeAPIKey(db)},
+
+		// Public routes for customers (no authentication needed)
+		{"GET", "/public/slots", openapi.Public, "", handlers.GetPublicSlots(db)},
+		{"POST", "/public/slots/:id/hold", openapi.Public, "", handlers.HoldSlot(db)},
+		{"DELETE", "/public/slots/:id/hold", openapi.Public, "", handlers.ReleaseSlotHold(db, deps.waitlist)},
+		{"GET", "/public/services", openapi.Public, "", handlers.GetPublicServices(db)},
+		{"GET", "/public/locations", openapi.Public, "", handlers.GetPublicLocations(db)},
+
+		// The marketplace directory and a business's booking page by its slug
+		{"GET", "/public/businesses", openapi.Public, "", handlers.SearchBusinesses(db)},
+		{"GET", "/public/businesses/:slug", openapi.Public, "", handlers.GetPublicBusiness(db)},
+		{"GET", "/public/businesses/:slug/services", openapi.Public, "", handlers.GetPublicServices(db)},
+		{"GET", "/public/businesses/:slug/slots", openapi.Public, "", handlers.GetPublicSlots(db)},
+		{"GET", "/public/businesses/:slug/locations", openapi.Public, "", handlers.GetPublicLocations(db)},
+
+		// Bookings and waitlist entries, by the customer's secret token
+		{"POST", "/public/bookings", openapi.Public, "", handlers.CreatePublicBooking(db, deps.outbox, deps.hooks)},
+		{"GET", "/public/bookings/:token", openapi.Public, "", handlers.GetPublicBooking(db)},
+		{"POST", "/public/bookings/:token/cancel", openapi.Public, "", handlers.CancelPublicBooking(db, deps.outbox, deps.hooks, deps.waitlist)},
+		{"POST", "/public/bookings/:token/reschedule", openapi.Public, "", handlers.ReschedulePublicBooking(db, deps.outbox, deps.hooks, deps.waitlist)},
+		{"GET", "/public/bookings/:token/calendar.ics", openapi.Public, "", handlers.GetPublicBookingCalendar(db, deps.accountOpts.AppURL)},
+		{"POST", "/public/waitlist", openapi.Public, "", handlers.JoinWaitlist(db)},
+		{"GET", "/public/waitlist/:token", openapi.Public, "", handlers.GetPublicWaitlistEntry(db)},
+		{"POST", "/public/waitlist/:token/accept", openapi.Public, "", handlers.AcceptWaitlistOffer(db, deps.outbox, deps.hooks)},
+		{"DELETE", "/public/waitlist/:token", openapi.Public, "", handlers.LeaveWaitlist(db, deps.waitlist)},
+
+		// iCalendar feeds, authenticated by the secret token in the URL
+		{"GET", "/calendar/:file", openapi.Public, "", handlers.GetCalendarFeed(db)},
+	}
+}
+
+// health reports whether the database is reachable
+func health(db *database.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := db.Ping()
+		if err != nil {
+			c.Error(apierror.Internal(err, "Database is down"))
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Server and database are running!"})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"booking-backend/openapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Every registered route must be in the OpenAPI document (which
+// describes v1; the unversioned /api routes are its aliases) and the
+// document must not describe routes that don't exist
+func TestRoutesMatchOpenAPISpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newRouter(nil, routerDeps{})
+
+	documented := map[string]openapi.Operation{}
+	for _, op := range openapi.Operations {
+		key := op.Method + " " + op.Path
+		if _, ok := documented[key]; ok {
+			t.Errorf("%s is described twice in openapi.Operations", key)
+		}
+		documented[key] = op
+	}
+
+	registered := map[string]bool{}
+	for _, route := range router.Routes() {
+		path := strings.TrimPrefix(route.Path, "/api")
+		if v1 := strings.TrimPrefix(path, "/v1"); v1 != path {
+			registered[route.Method+" "+v1] = true
+			path = v1
+		}
+		key := route.Method + " " + path
+		if _, ok := documented[key]; !ok {
+			t.Errorf("%s %s is missing from the OpenAPI spec; add it to openapi.Operations", route.Method, route.Path)
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			t.Errorf("%s is in the OpenAPI spec but isn't a v1 route", key)
+		}
+	}
+
+	// A typo in credentialRoutes would leave a route without its limit
+	for key := range credentialRoutes {
+		if !registered[key] {
+			t.Errorf("credentialRoutes has %s, which isn't a v1 route", key)
+		}
+	}
+
+	// The spec says who may call each route
+	for _, r := range v1Routes(nil, routerDeps{}) {
+		op, ok := documented[r.method+" "+r.path]
+		if ok && (op.Access != r.access || op.Scope != r.scope) {
+			t.Errorf("%s %s has different access or scope in openapi.Operations", r.method, r.path)
+		}
+	}
+}
+
+// Every schema reference in the document must resolve
+func TestOpenAPISpecReferences(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openapi.JSON(), &doc); err != nil {
+		t.Fatalf("spec is not valid JSON: %v", err)
+	}
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				if _, ok := schemas[strings.TrimPrefix(ref, "#/components/schemas/")]; !ok {
+					t.Errorf("unresolved reference %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
@@ -0,0 +1,161 @@
+// Package slothold releases the slots customers held during checkout but
+// never booked.
+//
+// Holding seats in a slot takes them off public availability under a hold
+// token; booking them requires the token. A Sweeper puts seats whose hold
+// expired back on sale and offers them to the waitlist first.
+package slothold
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/slots"
+	"booking-backend/waitlist"
+)
+
+// Duration is how long a slot is held for a customer filling in their
+// details
+const Duration = 10 * time.Minute
+
+const leaseName = "slot-holds"
+
+// Sweeper periodically releases expired holds. Only the replica holding
+// the "slot-holds" lease does the work.
+type Sweeper struct {
+	DB       *database.Store
+	Waitlist *waitlist.Waitlist
+	Interval time.Duration
+	Holder   string // lease holder ID of this process
+}
+
+// NewSweeper creates a Sweeper that looks for expired holds every 30 seconds
+func NewSweeper(db *database.Store, wl *waitlist.Waitlist) *Sweeper {
+	return &Sweeper{
+		DB:       db,
+		Waitlist: wl,
+		Interval: 30 * time.Second,
+		Holder:   database.NewHolderID(),
+	}
+}
+
+// Run releases expired holds until ctx is cancelled
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	defer database.ReleaseLease(s.DB, leaseName, s.Holder)
+
+	for {
+		if err := s.tick(); err != nil {
+			log.Printf("slothold: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sweeper) tick() error {
+	ok, err := database.AcquireLease(s.DB, leaseName, s.Holder, 3*s.Interval)
+	if err != nil || !ok {
+		return err
+	}
+	_, err = s.ReleaseExpired(time.Now())
+	return err
+}
+
+// ReleaseExpired deletes the holds that expired before now, makes their
+// slots available again and returns how many were released. Holds booked
+// while it runs are skipped.
+func (s *Sweeper) ReleaseExpired(now time.Time) (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, slot_id, seats FROM slot_holds WHERE expires_at <= $1", now)
+	if err != nil {
+		return 0, err
+	}
+	var holdIDs, slotIDs, seats []int
+	for rows.Next() {
+		var holdID, slotID, n int
+		if err := rows.Scan(&holdID, &slotID, &n); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		holdIDs = append(holdIDs, holdID)
+		slotIDs = append(slotIDs, slotID)
+		seats = append(seats, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	var freed []int
+	for i, holdID := range holdIDs {
+		ids, err := release(tx, holdID, slotIDs[i], seats[i],
+			"DELETE FROM slot_holds WHERE id = $1 AND expires_at <= $2", holdID, now)
+		if err != nil {
+			return 0, err
+		}
+		if len(ids) > 0 {
+			released++
+		}
+		freed = append(freed, ids...)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// Customers on the waitlist get the first chance at them
+	for _, slotID := range freed {
+		s.Waitlist.SlotFreed(slotID)
+	}
+	return released, nil
+}
+
+// Release ends a hold: its seats and any time held for following services
+// go back on sale. It returns the IDs of the slots freed, none if the hold
+// is gone already (booked, released or swept).
+func Release(q database.Querier, holdID, slotID, seats int) ([]int, error) {
+	return release(q, holdID, slotID, seats, "DELETE FROM slot_holds WHERE id = $1", holdID)
+}
+
+// release frees what a hold took if query deletes it. Only the delete that
+// removed the hold gives its seats back: a booking made with the hold at
+// the same time deletes it too, and keeps them. The hold's blocks are read
+// first because they are deleted with it (ON DELETE CASCADE).
+func release(q database.Querier, holdID, slotID, seats int, query string, args ...interface{}) ([]int, error) {
+	blocks, err := slots.Blocks(q, slots.Hold(holdID))
+	if err != nil {
+		return nil, err
+	}
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+
+	if err := slots.Release(q, slotID, seats); err != nil {
+		return nil, err
+	}
+	freed := []int{slotID}
+	for _, b := range blocks {
+		if err := slots.Release(q, b.SlotID, b.Seats); err != nil {
+			return nil, err
+		}
+		freed = append(freed, b.SlotID)
+	}
+	return freed, nil
+}
@@ -0,0 +1,90 @@
+package slothold
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/notify"
+	"booking-backend/slots"
+	"booking-backend/waitlist"
+)
+
+// TestReleaseExpired holds two slots, one of them with the time of a
+// following service, and sweeps after only the first hold has expired
+func TestReleaseExpired(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Date(2026, time.March, 2, 8, 0, 0, 0, time.UTC)
+	exec("INSERT INTO businesses (name) VALUES ('Acme')")
+	exec("INSERT INTO services (name, duration, business_id, capacity) VALUES ('Class', 30, 1, 2)")
+	for i := 0; i < 3; i++ {
+		start := now.Add(time.Hour + time.Duration(i)*30*time.Minute)
+		exec("INSERT INTO appointment_slots (start_time, end_time, service_id, business_id, capacity) VALUES ($1, $2, 1, 1, 2)",
+			start, start.Add(30*time.Minute))
+	}
+
+	// Hold 1 takes a seat in slot 1 and blocks slot 2 after it; hold 2
+	// takes a seat in slot 3 and expires later
+	hold := func(slotID int, expires time.Time) {
+		t.Helper()
+		if _, ok, err := slots.Take(db, slotID, 1, now); err != nil || !ok {
+			t.Fatalf("Take(%d): %v, %v", slotID, ok, err)
+		}
+		exec("INSERT INTO slot_holds (slot_id, token, seats, expires_at) VALUES ($1, $2, 1, $3)",
+			slotID, expires.String(), expires)
+	}
+	hold(1, now.Add(Duration))
+	if ok, err := slots.Block(db, slots.Hold(1), 1, now.Add(90*time.Minute), now.Add(2*time.Hour), now); err != nil || !ok {
+		t.Fatalf("Block: %v, %v", ok, err)
+	}
+	hold(3, now.Add(2*Duration))
+
+	sweeper := &Sweeper{DB: db, Waitlist: waitlist.New(db, &notify.Outbox{DB: db})}
+	released, err := sweeper.ReleaseExpired(now.Add(Duration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if released != 1 {
+		t.Errorf("released %d holds, want 1", released)
+	}
+
+	for slotID, want := range map[int]int{1: 0, 2: 0, 3: 1} {
+		var booked int
+		if err := db.QueryRow("SELECT booked_count FROM appointment_slots WHERE id = $1", slotID).Scan(&booked); err != nil {
+			t.Fatal(err)
+		}
+		if booked != want {
+			t.Errorf("slot %d has %d seats taken after the sweep, want %d", slotID, booked, want)
+		}
+	}
+	var holds, blocks int
+	if err := db.QueryRow("SELECT COUNT(*) FROM slot_holds").Scan(&holds); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM slot_blocks").Scan(&blocks); err != nil {
+		t.Fatal(err)
+	}
+	if holds != 1 || blocks != 0 {
+		t.Errorf("%d holds and %d blocks left, want 1 and 0", holds, blocks)
+	}
+
+	// A hold that is gone already isn't released twice
+	if ids, err := Release(db, 1, 1, 1); err != nil || len(ids) != 0 {
+		t.Errorf("Release of a swept hold freed %v, %v", ids, err)
+	}
+}
@@ -0,0 +1,269 @@
+package slots
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/models"
+)
+
+// MaxServices is the most services one booking can combine
+const MaxServices = 5
+
+// Errors returned by Plan for service lists that can't be booked
+var (
+	ErrNotSlotService  = errors.New("service_ids must start with the slot's service")
+	ErrUnknownService  = errors.New("service_ids contains an unknown service")
+	ErrTooManyServices = errors.New("too many services in one booking")
+)
+
+// Plan lays out services back to back from a slot of the first of them:
+// each following service starts when the one before it ends plus that
+// one's buffer
+func Plan(q database.Querier, slot models.TimeSlot, serviceIDs []int) ([]models.BookingService, error) {
+	if len(serviceIDs) > MaxServices {
+		return nil, ErrTooManyServices
+	}
+	if len(serviceIDs) == 0 || serviceIDs[0] != slot.ServiceID {
+		return nil, ErrNotSlotService
+	}
+
+	plan := make([]models.BookingService, 0, len(serviceIDs))
+	var end time.Time
+	var buffer int
+	for i, serviceID := range serviceIDs {
+		item := models.BookingService{Position: i, ServiceID: serviceID}
+		var duration, nextBuffer int
+		err := q.QueryRow(
+			"SELECT name, duration, buffer_minutes FROM services WHERE id = $1 AND business_id = $2",
+			serviceID, slot.BusinessID,
+		).Scan(&item.ServiceName, &duration, &nextBuffer)
+		if err == sql.ErrNoRows {
+			return nil, ErrUnknownService
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			item.StartTime, item.EndTime = slot.StartTime, slot.EndTime
+		} else {
+			item.StartTime = end.Add(time.Duration(buffer) * time.Minute)
+			item.EndTime = item.StartTime.Add(time.Duration(duration) * time.Minute)
+		}
+		plan = append(plan, item)
+		end, buffer = item.EndTime, nextBuffer
+	}
+	return plan, nil
+}
+
+// End is when the last service of a plan ends
+func End(plan []models.BookingService) time.Time {
+	return plan[len(plan)-1].EndTime
+}
+
+// Owner is the hold or booking that slot blocks and a plan belong to
+type Owner struct {
+	column string
+	id     int
+}
+
+// Hold owns what a slot hold blocks until it is booked
+func Hold(holdID int) Owner { return Owner{column: "hold_id", id: holdID} }
+
+// Booking owns what a booking blocks
+func Booking(bookingID int) Owner { return Owner{column: "booking_id", id: bookingID} }
+
+// overlapping finds the other slots of slotID's staff member (or of the
+// business, for slots without one) that overlap [from, until). free is
+// false unless they cover all of it without gaps, none has seats taken and
+// the time doesn't clash with busy time from the external calendars: time
+// without slots isn't working time.
+func overlapping(q database.Querier, slotID int, from, until time.Time) (ids, capacities []int, free bool, err error) {
+	var busy int
+	err = q.QueryRow(
+		`SELECT COUNT(*) FROM busy_blocks bb
+		 JOIN calendar_imports ci ON bb.import_id = ci.id
+		 JOIN appointment_slots s ON s.id = $1
+		 WHERE ci.business_id = s.business_id
+		 AND (ci.staff_id IS NULL OR ci.staff_id = s.staff_id)
+		 AND bb.start_time < $3 AND bb.end_time > $2`,
+		slotID, from, until,
+	).Scan(&busy)
+	if err != nil || busy > 0 {
+		return nil, nil, false, err
+	}
+
+	rows, err := q.Query(
+		`SELECT o.id, o.capacity, o.booked_count, o.is_available, o.start_time, o.end_time
+		 FROM appointment_slots o
+		 JOIN appointment_slots s ON s.id = $1
+		 WHERE o.business_id = s.business_id AND COALESCE(o.staff_id, 0) = COALESCE(s.staff_id, 0)
+		 AND o.id <> s.id AND o.start_time < $3 AND o.end_time > $2
+		 ORDER BY o.start_time`,
+		slotID, from, until,
+	)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer rows.Close()
+
+	free = true
+	covered := from
+	for rows.Next() {
+		var id, capacity, booked int
+		var available bool
+		var start, end time.Time
+		if err := rows.Scan(&id, &capacity, &booked, &available, &start, &end); err != nil {
+			return nil, nil, false, err
+		}
+		if booked > 0 || !available || start.After(covered) {
+			free = false
+		}
+		if end.After(covered) {
+			covered = end
+		}
+		ids = append(ids, id)
+		capacities = append(capacities, capacity)
+	}
+	if covered.Before(until) {
+		free = false
+	}
+	return ids, capacities, free, rows.Err()
+}
+
+// Fits reports whether [from, until) after a slot is free working time
+// for the same staff member
+func Fits(q database.Querier, slotID int, from, until time.Time) (bool, error) {
+	_, _, free, err := overlapping(q, slotID, from, until)
+	return free, err
+}
+
+// Block takes every seat of the staff member's slots that overlap
+// [from, until) after slotID so nobody else can book that time, and
+// records them against owner. It returns false if the time isn't free.
+func Block(q database.Querier, owner Owner, slotID int, from, until, now time.Time) (bool, error) {
+	ids, capacities, free, err := overlapping(q, slotID, from, until)
+	if err != nil || !free {
+		return false, err
+	}
+	for i, id := range ids {
+		_, ok, err := Take(q, id, capacities[i], now)
+		if err != nil || !ok {
+			return false, err
+		}
+		_, err = q.Exec(
+			"INSERT INTO slot_blocks (slot_id, "+owner.column+", seats) VALUES ($1, $2, $3)",
+			id, owner.id, capacities[i],
+		)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Blocked is the seats Block took in one slot
+type Blocked struct {
+	SlotID int
+	Seats  int
+}
+
+// Blocks reads what Block took for owner
+func Blocks(q database.Querier, owner Owner) ([]Blocked, error) {
+	rows, err := q.Query("SELECT slot_id, seats FROM slot_blocks WHERE "+owner.column+" = $1", owner.id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var blocks []Blocked
+	for rows.Next() {
+		var b Blocked
+		if err := rows.Scan(&b.SlotID, &b.Seats); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// ReleaseBlocks gives back the slots owner blocked and returns their IDs
+func ReleaseBlocks(q database.Querier, owner Owner) ([]int, error) {
+	blocks, err := Blocks(q, owner)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, b := range blocks {
+		if err := Release(q, b.SlotID, b.Seats); err != nil {
+			return nil, err
+		}
+		ids = append(ids, b.SlotID)
+	}
+	_, err = q.Exec("DELETE FROM slot_blocks WHERE "+owner.column+" = $1", owner.id)
+	return ids, err
+}
+
+// SavePlan replaces owner's plan. A booking's end moves to the end of the
+// last service.
+func SavePlan(q database.Querier, owner Owner, plan []models.BookingService) error {
+	if _, err := q.Exec("DELETE FROM booking_services WHERE "+owner.column+" = $1", owner.id); err != nil {
+		return err
+	}
+	for _, item := range plan {
+		_, err := q.Exec(
+			`INSERT INTO booking_services (`+owner.column+`, position, service_id, start_time, end_time)
+			 VALUES ($1, $2, $3, $4, $5)`,
+			owner.id, item.Position, item.ServiceID, item.StartTime, item.EndTime,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if owner.column == "booking_id" && len(plan) > 0 {
+		_, err := q.Exec("UPDATE bookings SET ends_at = $1 WHERE id = $2", End(plan), owner.id)
+		return err
+	}
+	return nil
+}
+
+// Transfer hands what a hold blocked and its plan to the booking made
+// with it
+func Transfer(q database.Querier, holdID, bookingID int) error {
+	if _, err := q.Exec("UPDATE slot_blocks SET booking_id = $1, hold_id = NULL WHERE hold_id = $2", bookingID, holdID); err != nil {
+		return err
+	}
+	plan, err := LoadPlan(q, Hold(holdID))
+	if err != nil || len(plan) == 0 {
+		return err
+	}
+	return SavePlan(q, Booking(bookingID), plan)
+}
+
+// LoadPlan reads owner's plan; single-service bookings have none
+func LoadPlan(q database.Querier, owner Owner) ([]models.BookingService, error) {
+	rows, err := q.Query(
+		`SELECT bs.position, bs.service_id, sv.name, bs.start_time, bs.end_time
+		 FROM booking_services bs
+		 JOIN services sv ON bs.service_id = sv.id
+		 WHERE bs.`+owner.column+` = $1
+		 ORDER BY bs.position`,
+		owner.id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plan []models.BookingService
+	for rows.Next() {
+		var item models.BookingService
+		if err := rows.Scan(&item.Position, &item.ServiceID, &item.ServiceName, &item.StartTime, &item.EndTime); err != nil {
+			return nil, err
+		}
+		plan = append(plan, item)
+	}
+	return plan, rows.Err()
+}
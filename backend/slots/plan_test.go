@@ -0,0 +1,161 @@
+package slots
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+)
+
+// openTestStore opens a migrated SQLite store with a business, a 30 minute
+// service and slots 9:00-10:30 and 11:00-11:30 on 2 March 2026 (UTC), each
+// with capacity seats
+func openTestStore(t *testing.T, capacity int) *database.Store {
+	t.Helper()
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("INSERT INTO businesses (name) VALUES ('Acme')")
+	exec("INSERT INTO services (name, duration, business_id, capacity) VALUES ('Haircut', 30, 1, $1)", capacity)
+	for _, start := range []string{"09:00", "09:30", "10:00", "11:00"} {
+		from := at(t, start)
+		exec(
+			"INSERT INTO appointment_slots (start_time, end_time, service_id, business_id, capacity) VALUES ($1, $2, 1, 1, $3)",
+			from, from.Add(30*time.Minute), capacity,
+		)
+	}
+	return db
+}
+
+// at is a time on the test day
+func at(t *testing.T, clock string) time.Time {
+	t.Helper()
+	tm, err := time.Parse("2006-01-02 15:04", "2026-03-02 "+clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tm
+}
+
+func TestFits(t *testing.T) {
+	db := openTestStore(t, 1)
+
+	tests := []struct {
+		name        string
+		slotID      int
+		from, until string
+		want        bool
+	}{
+		{"covered by the next slots", 1, "09:30", "10:30", true},
+		{"within one slot", 1, "09:30", "09:45", true},
+		{"across a gap", 1, "09:30", "11:30", false},
+		{"running past the last slot", 4, "11:30", "12:00", false},
+		{"ending after the last slot", 3, "10:30", "10:45", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Fits(db, tt.slotID, at(t, tt.from), at(t, tt.until))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Fits(%d, %s, %s) = %v, want %v", tt.slotID, tt.from, tt.until, got, tt.want)
+			}
+		})
+	}
+
+	// A booked slot in the way
+	if _, err := db.Exec("UPDATE appointment_slots SET booked_count = 1, is_available = false WHERE id = 3"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Fits(db, 1, at(t, "09:30"), at(t, "10:30")); err != nil || ok {
+		t.Errorf("Fits over a booked slot = %v, %v; want false", ok, err)
+	}
+}
+
+// TestBlockAndTransfer plans a haircut and a one hour beard trim from
+// slot 1, blocks the time for a hold, hands it to the booking made with the
+// hold and gives it back
+func TestBlockAndTransfer(t *testing.T) {
+	db := openTestStore(t, 1)
+	now := at(t, "08:00")
+	exec := func(query string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(query, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exec("INSERT INTO services (name, duration, business_id) VALUES ('Beard trim', 60, 1)")
+
+	slot, ok, err := Take(db, 1, 1, now)
+	if err != nil || !ok {
+		t.Fatalf("Take: %v, %v", ok, err)
+	}
+	plan, err := Plan(db, slot, []int{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !End(plan).Equal(at(t, "10:30")) {
+		t.Fatalf("plan ends at %v, want 10:30", End(plan))
+	}
+
+	exec("INSERT INTO slot_holds (slot_id, token, seats, expires_at) VALUES (1, 'token', 1, $1)", now.Add(time.Hour))
+	if ok, err := Block(db, Hold(1), 1, slot.EndTime, End(plan), now); err != nil || !ok {
+		t.Fatalf("Block: %v, %v", ok, err)
+	}
+	if err := SavePlan(db, Hold(1), plan); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := Take(db, 2, 1, now); err != nil || ok {
+		t.Errorf("took a seat in a blocked slot: %v, %v", ok, err)
+	}
+	if fits, err := Fits(db, 1, slot.EndTime, End(plan)); err != nil || fits {
+		t.Errorf("Fits over blocked time = %v, %v; want false", fits, err)
+	}
+
+	exec("INSERT INTO bookings (customer_name, customer_email, slot_id, business_id) VALUES ('Ann', 'ann@example.com', 1, 1)")
+	if err := Transfer(db, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if blocks, err := Blocks(db, Hold(1)); err != nil || len(blocks) != 0 {
+		t.Errorf("the hold still has blocks %v, %v", blocks, err)
+	}
+	booked, err := LoadPlan(db, Booking(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(booked) != 2 || booked[1].ServiceName != "Beard trim" {
+		t.Errorf("booking's plan is %+v, want the haircut and the beard trim", booked)
+	}
+	var endsAt time.Time
+	if err := db.QueryRow("SELECT ends_at FROM bookings WHERE id = 1").Scan(&endsAt); err != nil {
+		t.Fatal(err)
+	}
+	if !endsAt.Equal(End(plan)) {
+		t.Errorf("booking ends at %v, want %v", endsAt, End(plan))
+	}
+
+	freed, err := ReleaseBlocks(db, Booking(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(freed) != 2 {
+		t.Errorf("released slots %v, want 2 and 3", freed)
+	}
+	if fits, err := Fits(db, 1, slot.EndTime, End(plan)); err != nil || !fits {
+		t.Errorf("Fits after ReleaseBlocks = %v, %v; want true", fits, err)
+	}
+}
@@ -0,0 +1,56 @@
+// Package slots reserves and frees seats in appointment slots.
+//
+// A slot has a capacity (1 for one-to-one appointments, more for classes
+// and group sessions) and a booked_count of the seats that are booked, held
+// during checkout or offered to the waitlist. Both change together in one
+// conditional update so concurrent customers can never overbook a slot;
+// is_available turns false when the last seat goes.
+package slots
+
+import (
+	"database/sql"
+	"time"
+
+	"booking-backend/calsync"
+	"booking-backend/database"
+	"booking-backend/models"
+)
+
+// Take reserves seats in a slot that starts after now, has that many seats
+// left and doesn't clash with the staff member's busy time. It returns the
+// slot, or ok == false when the seats are no longer free.
+func Take(q database.Querier, slotID, seats int, now time.Time) (slot models.TimeSlot, ok bool, err error) {
+	slot.ID = slotID
+	var staffID sql.NullInt64
+	err = q.QueryRow(
+		`UPDATE appointment_slots AS s
+		 SET booked_count = booked_count + $2, is_available = (booked_count + $2 < capacity)
+		 WHERE s.id = $1 AND s.is_available = true AND s.booked_count + $2 <= s.capacity AND s.start_time > $3
+		 AND `+calsync.NotBusy+`
+		 RETURNING start_time, end_time, business_id, service_id, staff_id, capacity, booked_count`,
+		slotID, seats, now,
+	).Scan(&slot.StartTime, &slot.EndTime, &slot.BusinessID, &slot.ServiceID, &staffID, &slot.Capacity, &slot.BookedCount)
+	if err == sql.ErrNoRows {
+		return slot, false, nil
+	}
+	if err != nil {
+		return slot, false, err
+	}
+	if staffID.Valid {
+		id := int(staffID.Int64)
+		slot.StaffID = &id
+	}
+	slot.IsAvailable = slot.BookedCount < slot.Capacity
+	return slot, true, nil
+}
+
+// Release gives seats back to a slot
+func Release(q database.Querier, slotID, seats int) error {
+	_, err := q.Exec(
+		`UPDATE appointment_slots
+		 SET booked_count = CASE WHEN booked_count > $2 THEN booked_count - $2 ELSE 0 END, is_available = true
+		 WHERE id = $1`,
+		slotID, seats,
+	)
+	return err
+}
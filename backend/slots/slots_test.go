@@ -0,0 +1,117 @@
+package slots
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTakeAndRelease(t *testing.T) {
+	db := openTestStore(t, 3)
+	now := at(t, "08:00")
+
+	seatsLeft := func(slotID int) (left int, available bool) {
+		t.Helper()
+		err := db.QueryRow("SELECT capacity - booked_count, is_available FROM appointment_slots WHERE id = $1", slotID).Scan(&left, &available)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return left, available
+	}
+
+	tests := []struct {
+		name       string
+		seats      int
+		now        time.Time
+		wantOK     bool
+		wantLeft   int
+		wantOnSale bool
+	}{
+		{"two of three seats", 2, now, true, 1, true},
+		{"more seats than are left", 2, now, false, 1, true},
+		{"the last seat", 1, now, true, 0, false},
+		{"from a full slot", 1, now, false, 0, false},
+	}
+	for _, tt := range tests {
+		_, ok, err := Take(db, 1, tt.seats, tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		left, onSale := seatsLeft(1)
+		if ok != tt.wantOK || left != tt.wantLeft || onSale != tt.wantOnSale {
+			t.Errorf("%s: ok %v, %d left, available %v; want %v, %d, %v",
+				tt.name, ok, left, onSale, tt.wantOK, tt.wantLeft, tt.wantOnSale)
+		}
+	}
+
+	if _, ok, err := Take(db, 2, 1, at(t, "09:30")); err != nil || ok {
+		t.Errorf("took a seat in a slot that has started: %v, %v", ok, err)
+	}
+
+	// Released seats go back on sale, and never below zero
+	if err := Release(db, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	if left, onSale := seatsLeft(1); left != 2 || !onSale {
+		t.Errorf("after releasing 2 seats: %d left, available %v; want 2, true", left, onSale)
+	}
+	if err := Release(db, 1, 5); err != nil {
+		t.Fatal(err)
+	}
+	if left, _ := seatsLeft(1); left != 3 {
+		t.Errorf("releasing more seats than were taken left %d seats, want 3", left)
+	}
+}
+
+// Customers racing for the last seat: exactly one gets it
+func TestTakeLastSeatRace(t *testing.T) {
+	db := openTestStore(t, 2)
+	now := at(t, "08:00")
+	if _, ok, err := Take(db, 1, 1, now); err != nil || !ok {
+		t.Fatalf("Take: %v, %v", ok, err)
+	}
+
+	const customers = 8
+	var wg sync.WaitGroup
+	results := make(chan bool, customers)
+	for i := 0; i < customers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx, err := db.Begin()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer tx.Rollback()
+			_, ok, err := Take(tx, 1, 1, now)
+			if err == nil {
+				err = tx.Commit()
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			results <- ok
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	won := 0
+	for ok := range results {
+		if ok {
+			won++
+		}
+	}
+	if won != 1 {
+		t.Errorf("%d customers got the last seat, want 1", won)
+	}
+	var booked int
+	if err := db.QueryRow("SELECT booked_count FROM appointment_slots WHERE id = 1").Scan(&booked); err != nil {
+		t.Fatal(err)
+	}
+	if booked != 2 {
+		t.Errorf("booked_count is %d, want the capacity 2", booked)
+	}
+}
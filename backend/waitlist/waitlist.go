@@ -0,0 +1,203 @@
+// Package waitlist offers freed slots to customers waiting for a fully
+// booked service. A freed slot is held for the earliest waiting customer
+// whose time window it falls in; if they don't take it before the hold
+// expires it moves on to the next one, and back to public availability
+// when nobody is left.
+package waitlist
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/notify"
+	"booking-backend/slots"
+)
+
+const leaseName = "waitlist"
+
+// Waitlist holds freed slots for waiting customers and expires the holds
+// nobody took. Only the replica holding the "waitlist" lease expires holds.
+type Waitlist struct {
+	DB       *database.Store
+	Outbox   *notify.Outbox
+	Hold     time.Duration // how long an offered slot is held
+	Interval time.Duration // how often to look for expired holds
+	Holder   string        // lease holder ID of this process
+}
+
+// New creates a Waitlist that holds offered slots for 30 minutes
+func New(db *database.Store, outbox *notify.Outbox) *Waitlist {
+	return &Waitlist{
+		DB:       db,
+		Outbox:   outbox,
+		Hold:     30 * time.Minute,
+		Interval: time.Minute,
+		Holder:   database.NewHolderID(),
+	}
+}
+
+// SlotFreed offers a slot that has just become available to the waitlist.
+// It is meant to be called after the transaction that freed the slot has
+// committed; errors are logged.
+func (w *Waitlist) SlotFreed(slotID int) {
+	if _, err := w.Offer(slotID, time.Now()); err != nil {
+		log.Printf("waitlist: could not offer slot %d: %v", slotID, err)
+	}
+}
+
+// Offer holds a seat in an available slot for the earliest waiting customer
+// whose window it falls in and queues the offer. It returns the entry the slot
+// was offered to, or 0 when nobody is waiting for it (the slot stays
+// available).
+func (w *Waitlist) Offer(slotID int, now time.Time) (int, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// 1. Take a seat, if one is still free
+	slot, ok, err := slots.Take(tx, slotID, 1, now)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	// 2. Find the first customer waiting for it
+	var entryID int
+	err = tx.QueryRow(
+		`SELECT id FROM waitlist_entries
+		 WHERE business_id = $1 AND service_id = $2 AND status = 'waiting'
+		 AND window_start <= $3 AND window_end > $3
+		 ORDER BY created_at, id
+		 LIMIT 1
+		 FOR UPDATE SKIP LOCKED`,
+		slot.BusinessID, slot.ServiceID, slot.StartTime,
+	).Scan(&entryID)
+	if err == sql.ErrNoRows {
+		// Nobody is waiting: leave the slot available (nothing to commit)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// 3. Hold it for them
+	_, err = tx.Exec(
+		`UPDATE waitlist_entries SET status = 'offered', offered_slot_id = $1, offered_at = $2, offer_expires_at = $3
+		 WHERE id = $4`,
+		slotID, now, now.Add(w.Hold), entryID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Outbox.EnqueueWaitlistOffer(tx, entryID); err != nil {
+		return 0, err
+	}
+
+	return entryID, tx.Commit()
+}
+
+// Release ends an offer that wasn't taken (declined or expired) and passes
+// the slot on. status is the entry's new status.
+func (w *Waitlist) Release(entryID int, status string, now time.Time) error {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var slotID sql.NullInt64
+	err = tx.QueryRow(
+		`UPDATE waitlist_entries SET status = $1 WHERE id = $2 AND status = 'offered'
+		 RETURNING offered_slot_id`,
+		status, entryID,
+	).Scan(&slotID)
+	if err == sql.ErrNoRows {
+		// Taken or released meanwhile
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if slotID.Valid {
+		if err := slots.Release(tx, int(slotID.Int64), 1); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if slotID.Valid {
+		_, err = w.Offer(int(slotID.Int64), now)
+	}
+	return err
+}
+
+// Run expires holds until ctx is cancelled
+func (w *Waitlist) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	defer database.ReleaseLease(w.DB, leaseName, w.Holder)
+
+	for {
+		if err := w.tick(ctx); err != nil {
+			log.Printf("waitlist: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Waitlist) tick(ctx context.Context) error {
+	ok, err := database.AcquireLease(w.DB, leaseName, w.Holder, 3*w.Interval)
+	if err != nil || !ok {
+		return err
+	}
+	_, err = w.ExpireOffers(ctx, time.Now())
+	return err
+}
+
+// ExpireOffers releases every hold that has run out, offering the slots to
+// the next customers, and returns how many expired
+func (w *Waitlist) ExpireOffers(ctx context.Context, now time.Time) (int, error) {
+	rows, err := w.DB.Query(
+		"SELECT id FROM waitlist_entries WHERE status = 'offered' AND offer_expires_at <= $1 ORDER BY offer_expires_at",
+		now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := w.Release(id, "expired", now); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
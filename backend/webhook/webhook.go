@@ -0,0 +1,223 @@
+// Package webhook delivers booking and slot events to HTTP endpoints
+// registered by each business. Events are queued in webhook_deliveries and
+// sent in the background by a Worker, which signs every request and retries
+// failures with exponential backoff.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"booking-backend/database"
+)
+
+// Events that can be subscribed to
+const (
+	EventBookingCreated     = "booking.created"
+	EventBookingRescheduled = "booking.rescheduled"
+	EventBookingCancelled   = "booking.cancelled"
+	EventBookingNoShow      = "booking.no_show"
+	EventSlotGenerated      = "slot.generated"
+	EventServiceDeleted     = "service.deleted"
+
+	// AllEvents subscribes an endpoint to every event
+	AllEvents = "*"
+)
+
+// Events lists every event that can be subscribed to
+var Events = []string{
+	EventBookingCreated,
+	EventBookingRescheduled,
+	EventBookingCancelled,
+	EventBookingNoShow,
+	EventSlotGenerated,
+	EventServiceDeleted,
+}
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderEventID   = "X-Webhook-Id"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Payload is the JSON body POSTed to an endpoint
+type Payload struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	BusinessID int         `json:"business_id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Publisher queues events for the endpoints subscribed to them
+type Publisher struct {
+	DB *database.Store
+}
+
+// Publish queues an event for delivery. Like notify.Outbox.Notify it is
+// meant to be called after the change has committed; errors are logged and
+// never reach the caller.
+func (p *Publisher) Publish(businessID int, event string, data interface{}) {
+	if err := Enqueue(p.DB, businessID, event, data); err != nil {
+		log.Printf("webhook: could not queue %s for business %d: %v", event, businessID, err)
+	}
+}
+
+// Enqueue queues an event for every active endpoint of the business that is
+// subscribed to it, using q, which may be a transaction
+func Enqueue(q database.Querier, businessID int, event string, data interface{}) error {
+	rows, err := q.Query(
+		"SELECT id, events FROM webhook_endpoints WHERE business_id = $1 AND is_active = true",
+		businessID,
+	)
+	if err != nil {
+		return err
+	}
+	var endpoints []int
+	for rows.Next() {
+		var id int
+		var events string
+		if err := rows.Scan(&id, &events); err != nil {
+			rows.Close()
+			return err
+		}
+		if Subscribed(ParseEvents(events), event) {
+			endpoints = append(endpoints, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	eventID, err := newID()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	body, err := json.Marshal(Payload{
+		ID:         eventID,
+		Event:      event,
+		BusinessID: businessID,
+		CreatedAt:  now.UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, endpointID := range endpoints {
+		_, err := q.Exec(
+			`INSERT INTO webhook_deliveries (endpoint_id, event, event_id, payload, next_attempt_at, created_at)
+			 VALUES ($1, $2, $3, $4, $5, $5)`,
+			endpointID, event, eventID, string(body), now,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Redeliver queues a new delivery with the same payload as an earlier one.
+// The event ID is kept so receivers can recognise the duplicate.
+func Redeliver(q database.Querier, deliveryID int) (int, error) {
+	var newID int
+	now := time.Now()
+	err := q.QueryRow(
+		`INSERT INTO webhook_deliveries (endpoint_id, event, event_id, payload, next_attempt_at, created_at)
+		 SELECT endpoint_id, event, event_id, payload, $1, $1 FROM webhook_deliveries WHERE id = $2
+		 RETURNING id`,
+		now, deliveryID,
+	).Scan(&newID)
+	return newID, err
+}
+
+// Sign returns the value of the signature header for a request body sent at
+// t: "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<unix seconds>.<body>">".
+// Receivers recompute the HMAC with their endpoint secret and should reject
+// old timestamps to prevent replays.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := fmt.Sprintf("%d", t.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewSecret returns a random signing secret for an endpoint
+func NewSecret() (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + id, nil
+}
+
+// ParseEvents parses the comma-separated event list stored for an endpoint
+func ParseEvents(s string) []string {
+	var events []string
+	for _, event := range strings.Split(s, ",") {
+		if event = strings.TrimSpace(event); event != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// FormatEvents is the inverse of ParseEvents
+func FormatEvents(events []string) string {
+	return strings.Join(events, ",")
+}
+
+// ValidateEvents checks that every subscribed event exists
+func ValidateEvents(events []string) error {
+	if len(events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	for _, event := range events {
+		if event != AllEvents && !known(event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+// Subscribed reports whether an endpoint with these events receives event
+func Subscribed(events []string, event string) bool {
+	for _, e := range events {
+		if e == event || e == AllEvents {
+			return true
+		}
+	}
+	return false
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/notify"
+)
+
+func TestSign(t *testing.T) {
+	at := time.Date(2026, time.March, 2, 0, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"1"}`)
+	want := "t=1772409600,v1=71074048ef84801b904b0648a8c77f5491b3e205693792bed7fa84d68d3d38be"
+
+	tests := []struct {
+		name   string
+		secret string
+		at     time.Time
+		body   []byte
+		same   bool
+	}{
+		{"same request", "whsec_test", at, body, true},
+		{"other secret", "whsec_other", at, body, false},
+		{"other time", "whsec_test", at.Add(time.Second), body, false},
+		{"other body", "whsec_test", at, []byte(`{"id":"2"}`), false},
+	}
+	for _, tt := range tests {
+		got := Sign(tt.secret, tt.at, tt.body)
+		if (got == want) != tt.same {
+			t.Errorf("%s: signature %q, want same as %q: %v", tt.name, got, want, tt.same)
+		}
+	}
+}
+
+// TestDeliverDue fails a delivery until the worker gives up, redelivers it
+// and checks the new delivery arrives signed, with the same event ID
+func TestDeliverDue(t *testing.T) {
+	db, err := database.Open("sqlite://" + filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var up int32
+	var mu sync.Mutex
+	var received http.Header
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&up) == 0 {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = r.Header
+		receivedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	if _, err := db.Exec("INSERT INTO businesses (name) VALUES ('Acme')"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("INSERT INTO webhook_endpoints (business_id, url, secret, events) VALUES (1, $1, 'whsec_test', $2)",
+		server.URL, EventBookingCreated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, 1, EventBookingCreated, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Enqueue(db, 1, EventBookingCancelled, map[string]int{"id": 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &Worker{DB: db, Client: server.Client(), BatchSize: 10, MaxAttempts: 3, Lease: time.Minute}
+	for attempt := 1; attempt <= w.MaxAttempts; attempt++ {
+		before := time.Now()
+		if delivered, err := w.DeliverDue(context.Background()); err != nil || delivered != 0 {
+			t.Fatalf("attempt %d: delivered %d, %v; want 0", attempt, delivered, err)
+		}
+
+		var attempts, status int
+		var next time.Time
+		var failed bool
+		err := db.QueryRow(
+			"SELECT attempts, response_status, next_attempt_at, failed_at IS NOT NULL FROM webhook_deliveries WHERE id = 1",
+		).Scan(&attempts, &status, &next, &failed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attempts != attempt || status != http.StatusInternalServerError || failed != (attempt == w.MaxAttempts) {
+			t.Errorf("after attempt %d: attempts %d, status %d, failed %v", attempt, attempts, status, failed)
+		}
+		if !failed {
+			if wait := next.Sub(before); wait < notify.Backoff(attempt) || wait > notify.Backoff(attempt)+time.Minute {
+				t.Errorf("after attempt %d the retry is in %v, want %v", attempt, wait, notify.Backoff(attempt))
+			}
+			// Make it due again
+			if _, err := db.Exec("UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id = 1", before); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	atomic.StoreInt32(&up, 1)
+	id, err := Redeliver(db, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered, err := w.DeliverDue(context.Background()); err != nil || delivered != 1 {
+		t.Fatalf("redelivery: delivered %d, %v; want 1", delivered, err)
+	}
+
+	var eventID string
+	var deliveredAt bool
+	err = db.QueryRow("SELECT event_id, delivered_at IS NOT NULL FROM webhook_deliveries WHERE id = $1", id).Scan(&eventID, &deliveredAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !deliveredAt {
+		t.Error("the redelivery isn't marked delivered")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if received.Get(HeaderEventID) != eventID || received.Get(HeaderEvent) != EventBookingCreated {
+		t.Errorf("received event %s %s, want %s %s",
+			received.Get(HeaderEvent), received.Get(HeaderEventID), EventBookingCreated, eventID)
+	}
+	signature := received.Get(HeaderSignature)
+	var unix int64
+	if _, err := fmt.Sscanf(signature, "t=%d,", &unix); err != nil {
+		t.Fatalf("bad signature header %q", signature)
+	}
+	if want := Sign("whsec_test", time.Unix(unix, 0), receivedBody); signature != want {
+		t.Errorf("signature %q doesn't match the body, want %q", signature, want)
+	}
+
+	var deliveries int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webhook_deliveries").Scan(&deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if deliveries != 2 {
+		t.Errorf("%d deliveries queued, want 2 (the endpoint isn't subscribed to cancellations)", deliveries)
+	}
+}
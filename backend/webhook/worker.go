@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"booking-backend/database"
+	"booking-backend/notify"
+	"booking-backend/publicnet"
+)
+
+// Worker sends queued webhook deliveries. Like notify.Dispatcher, several
+// workers can share a database: rows are leased before they are sent.
+type Worker struct {
+	DB          *database.Store
+	Client      *http.Client
+	Interval    time.Duration // how often to poll for due deliveries
+	BatchSize   int
+	MaxAttempts int           // give up after this many failed attempts
+	Lease       time.Duration // how long a claimed row is reserved for this worker
+}
+
+// NewWorker creates a Worker with sensible defaults
+func NewWorker(db *database.Store) *Worker {
+	return &Worker{
+		DB:          db,
+		Client:      publicnet.NewClient(10 * time.Second),
+		Interval:    5 * time.Second,
+		BatchSize:   20,
+		MaxAttempts: 10,
+		Lease:       2 * time.Minute,
+	}
+}
+
+// Run sends deliveries until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.DeliverDue(ctx); err != nil {
+			log.Printf("webhook: delivery failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type delivery struct {
+	id       int
+	attempts int
+	event    string
+	eventID  string
+	payload  string
+	url      string
+	secret   string
+}
+
+// DeliverDue sends every delivery that is due and returns how many
+// succeeded
+func (w *Worker) DeliverDue(ctx context.Context) (int, error) {
+	deliveries, err := w.claim()
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, d := range deliveries {
+		status, err := w.send(ctx, d)
+		now := time.Now()
+		var response interface{}
+		if status != 0 {
+			response = status
+		}
+
+		if err != nil {
+			attempts := d.attempts + 1
+			if attempts >= w.MaxAttempts {
+				_, err = w.DB.Exec(
+					`UPDATE webhook_deliveries SET attempts = $1, response_status = $2, last_error = $3, failed_at = $4, locked_until = NULL
+					 WHERE id = $5`,
+					attempts, response, err.Error(), now, d.id,
+				)
+			} else {
+				_, err = w.DB.Exec(
+					`UPDATE webhook_deliveries SET attempts = $1, response_status = $2, last_error = $3, next_attempt_at = $4, locked_until = NULL
+					 WHERE id = $5`,
+					attempts, response, err.Error(), now.Add(notify.Backoff(attempts)), d.id,
+				)
+			}
+			if err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		_, err = w.DB.Exec(
+			`UPDATE webhook_deliveries SET attempts = attempts + 1, response_status = $1, last_error = NULL, delivered_at = $2, locked_until = NULL
+			 WHERE id = $3`,
+			response, now, d.id,
+		)
+		if err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+// errConnection is recorded for deliveries that got no response
+var errConnection = errors.New("connection failed")
+
+// send POSTs one delivery and returns the response status. Anything but a
+// 2xx response counts as a failure.
+func (w *Worker) send(ctx context.Context, d delivery) (int, error) {
+	body := []byte(d.payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "booking-webhooks/1.0")
+	req.Header.Set(HeaderEvent, d.event)
+	req.Header.Set(HeaderEventID, d.eventID)
+	req.Header.Set(HeaderSignature, Sign(d.secret, time.Now(), body))
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		// The delivery log is shown to the business; why a connection
+		// failed could tell them what the server can reach
+		log.Printf("webhook: delivery %d: %v", d.id, err)
+		return 0, errConnection
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// claim leases a batch of due deliveries to this worker
+func (w *Worker) claim() ([]delivery, error) {
+	tx, err := w.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	rows, err := tx.Query(`
+		SELECT d.id, d.attempts, d.event, d.event_id, d.payload, e.url, e.secret
+		FROM webhook_deliveries d
+		JOIN webhook_endpoints e ON d.endpoint_id = e.id
+		WHERE d.delivered_at IS NULL AND d.failed_at IS NULL
+		AND d.next_attempt_at <= $1
+		AND (d.locked_until IS NULL OR d.locked_until < $1)
+		AND e.is_active = true
+		ORDER BY d.id
+		LIMIT $2
+		FOR UPDATE OF d SKIP LOCKED`,
+		now, w.BatchSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []delivery
+	for rows.Next() {
+		var d delivery
+		if err := rows.Scan(&d.id, &d.attempts, &d.event, &d.eventID, &d.payload, &d.url, &d.secret); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		claimed = append(claimed, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range claimed {
+		if _, err := tx.Exec("UPDATE webhook_deliveries SET locked_until = $1 WHERE id = $2", now.Add(w.Lease), d.id); err != nil {
+			return nil, err
+		}
+	}
+
+	return claimed, tx.Commit()
+}
@@ -6,9 +6,11 @@ import Box from '@mui/material/Box';
 
 // Components
 import Login from './components/Login';
+import OIDCCallback from './components/OIDCCallback';
 import Register from './components/Register';
 import BusinessAdmin from './components/BusinessAdmin';
 import PublicBooking from './components/PublicBooking';
+import { authAPI } from './services/api';
 
 const theme = createTheme({
   palette: {
@@ -37,14 +39,17 @@ function App() {
     setLoading(false);
   }, []);
 
-  const handleLogin = (userData, token) => {
+  const handleLogin = (userData, token, refreshToken) => {
     localStorage.setItem('token', token);
+    localStorage.setItem('refresh_token', refreshToken);
     localStorage.setItem('user', JSON.stringify(userData));
     setUser(userData);
   };
 
   const handleLogout = () => {
+    authAPI.logout().catch(() => {});
     localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
     localStorage.removeItem('user');
     setUser(null);
   };
@@ -63,6 +68,10 @@ function App() {
               path="/login" 
               element={!user ? <Login onLogin={handleLogin} /> : <Navigate to="/admin" />} 
             />
+            <Route
+              path="/login/:provider/callback"
+              element={!user ? <OIDCCallback onLogin={handleLogin} /> : <Navigate to="/admin" />}
+            />
             <Route 
               path="/register" 
               element={!user ? <Register onLogin={handleLogin} /> : <Navigate to="/admin" />} 
@@ -27,7 +27,7 @@ import { servicesAPI, slotsAPI } from '../services/api';
 
 const BusinessAdmin = ({ user, onLogout }) => {
   const [services, setServices] = useState([]); // Initialize as empty array
-  const [slots, setSlots] = useState([]); // Initialize as empty array
+  const [slotCounts, setSlotCounts] = useState({ total: 0, available: 0 });
   const [openServiceDialog, setOpenServiceDialog] = useState(false);
   const [openSlotDialog, setOpenSlotDialog] = useState(false);
   const [error, setError] = useState('');
@@ -59,8 +59,9 @@ const BusinessAdmin = ({ user, onLogout }) => {
   const loadServices = async () => {
     try {
       setLoading(true);
-      const response = await servicesAPI.list();
-      setServices(response.data || []); // Ensure it's always an array
+      // All services fit on one page; the slot form lists them
+      const response = await servicesAPI.list({ limit: 200 });
+      setServices(response.data?.items || []); // Ensure it's always an array
     } catch (error) {
       setError('Failed to load services');
       setServices([]); // Set to empty array on error
@@ -72,11 +73,15 @@ const BusinessAdmin = ({ user, onLogout }) => {
   const loadSlots = async () => {
     try {
       setLoading(true);
-      const response = await slotsAPI.list();
-      setSlots(response.data || []); // Ensure it's always an array
+      // Only the counts are shown, so one row per list is enough
+      const [all, available] = await Promise.all([
+        slotsAPI.list({ limit: 1 }),
+        slotsAPI.list({ limit: 1, available: true }),
+      ]);
+      setSlotCounts({ total: all.data.total, available: available.data.total });
     } catch (error) {
       setError('Failed to load slots');
-      setSlots([]); // Set to empty array on error
+      setSlotCounts({ total: 0, available: 0 });
     } finally {
       setLoading(false);
     }
@@ -90,7 +95,7 @@ const BusinessAdmin = ({ user, onLogout }) => {
       setServiceForm({ name: '', description: '', duration: 30 });
       loadServices();
     } catch (error) {
-      setError(error.response?.data?.error || 'Failed to create service');
+      setError(error.response?.data?.detail || 'Failed to create service');
     }
   };
 
@@ -101,7 +106,7 @@ const BusinessAdmin = ({ user, onLogout }) => {
         setSuccess('Service deleted successfully!');
         loadServices();
       } catch (error) {
-        setError(error.response?.data?.error || 'Failed to delete service');
+        setError(error.response?.data?.detail || 'Failed to delete service');
       }
     }
   };
@@ -117,7 +122,7 @@ const BusinessAdmin = ({ user, onLogout }) => {
       setOpenSlotDialog(false);
       loadSlots();
     } catch (error) {
-      setError(error.response?.data?.error || 'Failed to generate slots');
+      setError(error.response?.data?.detail || 'Failed to generate slots');
     }
   };
 
@@ -183,7 +188,7 @@ const BusinessAdmin = ({ user, onLogout }) => {
                 <Typography variant="h6" gutterBottom>
                   Time Slots
                 </Typography>
-                <Typography variant="h4">{slots.length}</Typography>
+                <Typography variant="h4">{slotCounts.total}</Typography>
                 <Button
                   startIcon={<AddIcon />}
                   variant="outlined"
@@ -203,7 +208,7 @@ const BusinessAdmin = ({ user, onLogout }) => {
                   Available Slots
                 </Typography>
                 <Typography variant="h4">
-                  {slots.filter(slot => slot.is_available).length}
+                  {slotCounts.available}
                 </Typography>
               </CardContent>
             </Card>
@@ -1,4 +1,4 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import {
   Container,
   Paper,
@@ -7,16 +7,49 @@ import {
   Typography,
   Box,
   Alert,
+  Divider,
 } from '@mui/material';
+import { useLocation } from 'react-router-dom';
 import { authAPI } from '../services/api';
 
 const Login = ({ onLogin }) => {
+  const location = useLocation();
   const [credentials, setCredentials] = useState({
     email: '',
     password: '',
   });
   const [error, setError] = useState('');
   const [loading, setLoading] = useState(false);
+  const [providers, setProviders] = useState([]);
+  // The second step, when the account has (or must set up) two-factor
+  // authentication; provider sign-ins arrive here with it
+  const [mfa, setMfa] = useState(location.state?.mfa || null);
+  const [setup, setSetup] = useState(null);
+  const [code, setCode] = useState('');
+  const [recoveryCodes, setRecoveryCodes] = useState(null);
+
+  useEffect(() => {
+    authAPI.oidcProviders()
+      .then((response) => setProviders(response.data))
+      .catch(() => setProviders([]));
+  }, []);
+
+  const handleProviderLogin = async (provider) => {
+    setError('');
+    try {
+      const response = await authAPI.oidcStart(provider);
+      window.location.href = response.data.authorization_url;
+    } catch (err) {
+      setError(err.response?.data?.detail || 'Sign-in failed');
+    }
+  };
+
+  useEffect(() => {
+    if (!mfa?.mfa_setup_required || setup) return;
+    authAPI.setupLoginMFA(mfa.mfa_token)
+      .then((response) => setSetup(response.data))
+      .catch((err) => setError(err.response?.data?.detail || 'Could not set up two-factor authentication'));
+  }, [mfa, setup]);
 
   const handleSubmit = async (e) => {
     e.preventDefault();
@@ -25,14 +58,110 @@ const Login = ({ onLogin }) => {
 
     try {
       const response = await authAPI.login(credentials);
-      onLogin(response.data.user, response.data.token);
+      if (response.data.mfa_required) {
+        setMfa(response.data);
+      } else {
+        onLogin(response.data.user, response.data.token, response.data.refresh_token);
+      }
+    } catch (err) {
+      setError(err.response?.data?.detail || 'Login failed');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleCode = async (e) => {
+    e.preventDefault();
+    setLoading(true);
+    setError('');
+
+    try {
+      const response = await authAPI.loginMFA(mfa.mfa_token, code);
+      if (response.data.recovery_codes) {
+        // Show the codes once before going on
+        setRecoveryCodes(response.data);
+      } else {
+        onLogin(response.data.user, response.data.token, response.data.refresh_token);
+      }
     } catch (err) {
-      setError(err.response?.data?.error || 'Login failed');
+      setError(err.response?.data?.detail || 'Invalid code');
     } finally {
       setLoading(false);
     }
   };
 
+  if (recoveryCodes) {
+    return (
+      <Container maxWidth="sm" sx={{ py: 4 }}>
+        <Paper elevation={3} sx={{ p: 4 }}>
+          <Typography variant="h5" component="h1" gutterBottom>
+            Save your recovery codes
+          </Typography>
+          <Typography variant="body2" sx={{ mb: 2 }}>
+            Each code logs you in once if you lose your authenticator app. They won't be shown again.
+          </Typography>
+          <Box component="pre" sx={{ fontFamily: 'monospace', bgcolor: 'grey.100', p: 2 }}>
+            {recoveryCodes.recovery_codes.join('\n')}
+          </Box>
+          <Button
+            fullWidth
+            variant="contained"
+            sx={{ mt: 2 }}
+            onClick={() => onLogin(recoveryCodes.user, recoveryCodes.token, recoveryCodes.refresh_token)}
+          >
+            Continue
+          </Button>
+        </Paper>
+      </Container>
+    );
+  }
+
+  if (mfa) {
+    return (
+      <Container maxWidth="sm" sx={{ py: 4 }}>
+        <Paper elevation={3} sx={{ p: 4 }}>
+          <Typography variant="h5" component="h1" gutterBottom align="center">
+            Two-factor authentication
+          </Typography>
+
+          {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+          {mfa.mfa_setup_required ? (
+            setup && (
+              <Typography variant="body2" sx={{ mb: 2 }}>
+                Your business requires two-factor authentication. Add this key to your authenticator
+                app (or <a href={setup.otpauth_uri}>open it in the app</a>), then enter the code it shows:
+                <Box component="code" sx={{ display: 'block', mt: 1, wordBreak: 'break-all' }}>
+                  {setup.secret}
+                </Box>
+              </Typography>
+            )
+          ) : (
+            <Typography variant="body2" sx={{ mb: 2 }}>
+              Enter the code from your authenticator app, or one of your recovery codes.
+            </Typography>
+          )}
+
+          <Box component="form" onSubmit={handleCode}>
+            <TextField
+              fullWidth
+              label="Code"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              margin="normal"
+              autoComplete="one-time-code"
+              autoFocus
+              required
+            />
+            <Button type="submit" fullWidth variant="contained" sx={{ mt: 2 }} disabled={loading}>
+              {loading ? 'Checking...' : 'Verify'}
+            </Button>
+          </Box>
+        </Paper>
+      </Container>
+    );
+  }
+
   return (
     <Container maxWidth="sm" sx={{ py: 4 }}>
       <Paper elevation={3} sx={{ p: 4 }}>
@@ -73,6 +202,23 @@ const Login = ({ onLogin }) => {
             {loading ? 'Logging in...' : 'Login'}
           </Button>
         </Box>
+
+        {providers.length > 0 && (
+          <>
+            <Divider sx={{ my: 2 }}>or</Divider>
+            {providers.map((provider) => (
+              <Button
+                key={provider.name}
+                fullWidth
+                variant="outlined"
+                sx={{ mb: 1 }}
+                onClick={() => handleProviderLogin(provider.name)}
+              >
+                Sign in with {provider.name.charAt(0).toUpperCase() + provider.name.slice(1)}
+              </Button>
+            ))}
+          </>
+        )}
       </Paper>
     </Container>
   );
@@ -0,0 +1,57 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { useParams, useSearchParams, useNavigate, Link } from 'react-router-dom';
+import { Container, Paper, Typography, Alert, CircularProgress, Box } from '@mui/material';
+import { authAPI } from '../services/api';
+
+// The provider sends the user back here with a code and state after they
+// signed in
+const OIDCCallback = ({ onLogin }) => {
+  const { provider } = useParams();
+  const [searchParams] = useSearchParams();
+  const navigate = useNavigate();
+  const [error, setError] = useState('');
+  const started = useRef(false);
+
+  useEffect(() => {
+    // The code can only be redeemed once
+    if (started.current) return;
+    started.current = true;
+
+    if (searchParams.get('error')) {
+      setError(searchParams.get('error_description') || 'Sign-in was cancelled');
+      return;
+    }
+    authAPI.oidcCallback(provider, searchParams.get('code'), searchParams.get('state'))
+      .then((response) => {
+        if (response.data.mfa_required) {
+          // The login page asks for the second factor
+          navigate('/login', { replace: true, state: { mfa: response.data } });
+        } else {
+          onLogin(response.data.user, response.data.token, response.data.refresh_token);
+        }
+      })
+      .catch((err) => setError(err.response?.data?.detail || 'Sign-in failed'));
+  }, [provider, searchParams, onLogin, navigate]);
+
+  return (
+    <Container maxWidth="sm" sx={{ py: 4 }}>
+      <Paper elevation={3} sx={{ p: 4 }}>
+        <Typography variant="h5" component="h1" gutterBottom align="center">
+          Signing in
+        </Typography>
+        {error ? (
+          <>
+            <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>
+            <Link to="/login">Back to login</Link>
+          </>
+        ) : (
+          <Box sx={{ display: 'flex', justifyContent: 'center' }}>
+            <CircularProgress />
+          </Box>
+        )}
+      </Paper>
+    </Container>
+  );
+};
+
+export default OIDCCallback;
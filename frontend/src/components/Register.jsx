@@ -27,9 +27,9 @@ const Register = ({ onLogin }) => {
 
     try {
       const response = await authAPI.register(formData);
-      onLogin(response.data.user, response.data.token);
+      onLogin(response.data.user, response.data.token, response.data.refresh_token);
     } catch (err) {
-      setError(err.response?.data?.error || 'Registration failed');
+      setError(err.response?.data?.detail || 'Registration failed');
     } finally {
       setLoading(false);
     }
@@ -1,6 +1,6 @@
 import axios from 'axios';
 
-const API_BASE_URL = 'http://localhost:8080/api';
+const API_BASE_URL = 'http://localhost:8080/api/v1';
 
 const api = axios.create({
   baseURL: API_BASE_URL,
@@ -15,23 +15,98 @@ api.interceptors.request.use((config) => {
   return config;
 });
 
+// Access tokens are short-lived: on a 401, swap the refresh token for a new
+// pair once and retry the request
+let refreshing = null;
+api.interceptors.response.use(
+  (response) => response,
+  async (error) => {
+    const original = error.config;
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (error.response?.status !== 401 || !refreshToken || original._retried || original.url === '/token/refresh') {
+      return Promise.reject(error);
+    }
+    original._retried = true;
+
+    try {
+      refreshing = refreshing || api.post('/token/refresh', { refresh_token: refreshToken });
+      const { data } = await refreshing;
+      localStorage.setItem('token', data.token);
+      localStorage.setItem('refresh_token', data.refresh_token);
+      original.headers.Authorization = `Bearer ${data.token}`;
+      return api(original);
+    } catch (refreshError) {
+      localStorage.removeItem('token');
+      localStorage.removeItem('refresh_token');
+      localStorage.removeItem('user');
+      return Promise.reject(error);
+    } finally {
+      refreshing = null;
+    }
+  }
+);
+
 export const authAPI = {
   login: (credentials) => api.post('/login', credentials),
   register: (businessData) => api.post('/register', businessData),
+  loginMFA: (mfaToken, code) => api.post('/login/2fa', { mfa_token: mfaToken, code }),
+  setupLoginMFA: (mfaToken) => api.post('/login/2fa/setup', { mfa_token: mfaToken }),
+  oidcProviders: () => api.get('/auth/oidc/providers'),
+  // The sign-in's state is kept in a cookie, checked by the callback
+  oidcStart: (provider) => api.post(`/auth/oidc/${provider}/start`, null, { withCredentials: true }),
+  oidcCallback: (provider, code, state) =>
+    api.post(`/auth/oidc/${provider}/callback`, { code, state }, { withCredentials: true }),
+  // The token is read now because the caller clears storage right after
+  logout: () => api.post('/logout', null, { headers: { Authorization: `Bearer ${localStorage.getItem('token')}` } }),
+};
+
+// Public endpoints take a business's slug or, from older links, its ID
+const businessQuery = (business) =>
+  /^\d+$/.test(String(business)) ? `business_id=${business}` : `business=${encodeURIComponent(business)}`;
+
+export const businessAPI = {
+  getProfile: () => api.get('/business/profile'),
+  updateProfile: (profileData) => api.put('/business/profile', profileData),
+  getPublic: (slug) => api.get(`/public/businesses/${encodeURIComponent(slug)}`),
+  // params: { q, category, city, date, tz, limit, offset }
+  search: (params) => api.get('/public/businesses', { params }),
 };
 
 export const servicesAPI = {
   create: (serviceData) => api.post('/services', serviceData),
-  list: () => api.get('/services'),
+  // Lists return { items, total, next_cursor }; params: { limit, cursor, sort, location_id }
+  list: (params) => api.get('/services', { params }),
   delete: (id) => api.delete(`/services/${id}`),
-  getPublic: (businessId) => api.get(`/public/services?business_id=${businessId}`), // Add this line
+  getPublic: (business) => api.get(`/public/services?${businessQuery(business)}`),
+};
+
+export const locationsAPI = {
+  list: () => api.get('/locations'),
+  create: (locationData) => api.post('/locations', locationData),
+  update: (id, locationData) => api.put(`/locations/${id}`, locationData),
+  setStaff: (id, userIds) => api.put(`/locations/${id}/staff`, { user_ids: userIds }),
+  getPublic: (business) => api.get(`/public/locations?${businessQuery(business)}`),
 };
 
 export const slotsAPI = {
   generate: (slotData) => api.post('/slots/generate', slotData),
-  list: () => api.get('/slots'),
-  getPublic: (businessId, serviceId, date) => 
-    api.get(`/public/slots?business_id=${businessId}&service_id=${serviceId}${date ? `&date=${date}` : ''}`),
+  // params: { limit, cursor, sort, service_id, from, to, available, location_id }
+  list: (params) => api.get('/slots', { params }),
+  getPublic: (business, serviceId, date) => 
+    api.get(`/public/slots?${businessQuery(business)}&service_id=${serviceId}${date ? `&date=${date}` : ''}`),
+  // Holds keep a slot for a few minutes while the customer fills in the
+  // booking form; bookingsAPI.create needs the hold_token
+  hold: (slotId, seats = 1, serviceIds) => api.post(`/public/slots/${slotId}/hold`, { seats, service_ids: serviceIds }),
+  releaseHold: (slotId, holdToken) => api.delete(`/public/slots/${slotId}/hold`, { data: { hold_token: holdToken } }),
+};
+
+export const bookingsAPI = {
+  create: (bookingData) => api.post('/public/bookings', bookingData),
+  getByToken: (token) => api.get(`/public/bookings/${token}`),
+  cancelByToken: (token) => api.post(`/public/bookings/${token}/cancel`),
+  // params: { limit, cursor, sort, status, service_id, from, to, location_id }
+  list: (params) => api.get('/bookings', { params }),
+  cancel: (id) => api.post(`/bookings/${id}/cancel`),
 };
 
 export default api;
\ No newline at end of file